@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/corpus"
+)
+
+const defaultCorpus = "internal/bank/testdata"
+
+func main() {
+	var (
+		bank      string
+		name      string
+		names     string
+		recipient string
+		dir       string
+		force     bool
+	)
+
+	flag.StringVar(&bank, "bank", "", "bank of the message, it is written to the corpus along with -name")
+	flag.StringVar(&name, "name", "", "name of the case in the corpus")
+	flag.StringVar(&names, "scrub", "", "comma separated names to replace in the message, such as the account holder")
+	flag.StringVar(&recipient, "recipient", corpus.DefaultRecipient, "address that replaces the recipients")
+	flag.StringVar(&dir, "corpus", defaultCorpus, "directory of the corpus")
+	flag.BoolVar(&force, "force", false, "overwrite the case when it exists")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [message.eml]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Anonymizes a message read from a file or stdin, and prints it or adds it to the corpus.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if (bank == "") != (name == "") {
+		log.Fatal("-bank and -name go together")
+	}
+
+	in := io.Reader(os.Stdin)
+	if flag.NArg() > 0 {
+		f, err := os.Open(flag.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	raw, err := io.ReadAll(in)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var opts corpus.Options
+	opts.Recipient = recipient
+	if names != "" {
+		opts.Names = strings.Split(names, ",")
+	}
+
+	anonymized, err := corpus.Anonymize(raw, opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if bank == "" {
+		if _, err := os.Stdout.Write(anonymized); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	path := filepath.Join(dir, strings.ToLower(bank), name+corpus.MessageExt)
+	if _, err := os.Stat(path); err == nil && !force {
+		log.Fatalf("%s exists, use -force to overwrite it", path)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(path, anonymized, 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("wrote %s, review it and run `go test ./internal/bank -update` to write its expected result\n", path)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -11,15 +10,15 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 	"go.uber.org/zap"
 
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/configloader"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
 )
 
-const (
-	credentialsFile = "credentials.json"
-	versionFile     = "version"
-)
+const versionFile = "version"
 
 func getVersion() (string, error) {
 	f, err := os.Open(versionFile)
@@ -36,27 +35,6 @@ func getVersion() (string, error) {
 	return string(raw), nil
 }
 
-func getConfig() (types.Config, error) {
-	credFile, err := os.Open(credentialsFile)
-	if err != nil {
-		return types.Config{}, err
-	}
-	defer credFile.Close()
-
-	authBytes, err := io.ReadAll(credFile)
-	if err != nil {
-		return types.Config{}, err
-	}
-
-	var config types.Config
-	err = json.Unmarshal(authBytes, &config)
-	if err != nil {
-		return types.Config{}, err
-	}
-
-	return config, nil
-}
-
 func configureLogger() error {
 	config := zap.NewProductionConfig()
 
@@ -74,16 +52,20 @@ func configureLogger() error {
 	return nil
 }
 
-func HandleRequest(ctx context.Context) error {
-	config, err := getConfig()
+func HandleRequest(ctx context.Context) (sync.RunReport, error) {
+	config, err := configloader.Load(ctx, configloader.Flags{})
 	if err != nil {
-		return err
+		return sync.RunReport{}, err
+	}
+	if err := configloader.Validate(config); err != nil {
+		return sync.RunReport{}, err
 	}
 
 	if err := configureLogger(); err != nil {
-		return fmt.Errorf("could not configure logger: %w", err)
+		return sync.RunReport{}, fmt.Errorf("could not configure logger: %w", err)
 	}
 
+	var report sync.RunReport
 	sync := sync.Sync{
 		Config: config,
 		DryRun: false,
@@ -103,7 +85,20 @@ func HandleRequest(ctx context.Context) error {
 	ctx, cancel := context.WithTimeout(ctx, awsLambdaTimeout)
 	defer cancel()
 
-	return sync.Run(ctx)
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing, "toshl-sync-lambda", version)
+	if err != nil {
+		return report, err
+	}
+
+	report, err = sync.Run(ctx)
+	if exportErr := metrics.Export(context.WithoutCancel(ctx), config.Metrics); exportErr != nil {
+		log.Error("could not export metrics", logging.Error(exportErr))
+	}
+	if traceErr := shutdownTracing(context.WithoutCancel(ctx)); traceErr != nil {
+		log.Error("could not flush traces", logging.Error(traceErr))
+	}
+
+	return report, err
 }
 
 func main() {
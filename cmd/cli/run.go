@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -11,37 +12,18 @@ import (
 
 	zap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v3"
 
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/configloader"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
 )
 
-const credentialsFile = "credentials.json"
-
 var GitCommit string
 
-func getConfig() (types.Config, error) {
-	credFile, err := os.Open(credentialsFile)
-	if err != nil {
-		return types.Config{}, err
-	}
-	defer credFile.Close()
-
-	raw, err := io.ReadAll(credFile)
-	if err != nil {
-		return types.Config{}, err
-	}
-
-	var config types.Config
-	err = json.Unmarshal(raw, &config)
-	if err != nil {
-		return types.Config{}, err
-	}
-
-	return config, nil
-}
-
 func configureLogger(execute, verbose bool) error {
 	config := zap.NewDevelopmentConfig()
 	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
@@ -75,13 +57,36 @@ func main() {
 		execute bool
 		verbose bool
 		timeout string
+		report  string
+		review  bool
+		plan    string
 	)
 
 	flag.BoolVar(&execute, "execute", false, "execute actual changes")
 	flag.BoolVar(&verbose, "verbose", false, "print debug lines")
 	flag.StringVar(&timeout, "timeout", "", "timeout for sync to cancel")
+	flag.StringVar(&report, "report", "table", "format of the run report: table, json or none")
+	flag.BoolVar(&review, "review", false, "review every entry before it is created, only the approved ones are created")
+	flag.StringVar(&plan, "plan", "", "print what a dry run would do as json or yaml, instead of the report")
+	var cfgFlags configloader.Flags
+	cfgFlags.Register(flag.CommandLine)
 	flag.Parse()
 
+	if report != "table" && report != "json" && report != "none" {
+		log.Fatalf("unknown report format %q", report)
+	}
+	if plan != "" && plan != "json" && plan != "yaml" {
+		log.Fatalf("unknown plan format %q", plan)
+	}
+	if plan != "" && (execute || review) {
+		log.Fatal("a plan can only be printed on dry runs")
+	}
+
+	// reviewing is confirming each change, so it executes the approved ones
+	if review {
+		execute = true
+	}
+
 	if err := configureLogger(execute, verbose); err != nil {
 		log.Fatal(err)
 	}
@@ -94,14 +99,40 @@ func main() {
 
 	log := logging.New()
 
-	config, err := getConfig()
+	config, err := configloader.Load(ctx, cfgFlags)
 	if err != nil {
 		log.Fatal("failed to get config", logging.Error(err))
 	}
+	if cfgFlags.Print {
+		if err := configloader.WriteRedacted(os.Stdout, config); err != nil {
+			log.Fatal("failed to print config", logging.Error(err))
+		}
+		return
+	}
+	if err := configloader.Validate(config); err != nil {
+		log.Fatal("invalid config", logging.Error(err))
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing, "toshl-sync", commit)
+	if err != nil {
+		log.Fatal("failed to set up tracing", logging.Error(err))
+	}
+
+	var reviewer sync.Reviewer
+	if review {
+		reviewer = sync.NewPromptReviewer(os.Stdin, os.Stderr)
+	}
+
+	var runPlan *sync.Plan
+	if plan != "" {
+		runPlan = &sync.Plan{}
+	}
 
 	sync := sync.Sync{
-		Config: config,
-		DryRun: !execute,
+		Config:   config,
+		DryRun:   !execute,
+		Reviewer: reviewer,
+		Plan:     runPlan,
 	}
 
 	if timeout != "" {
@@ -117,8 +148,77 @@ func main() {
 		defer cancel()
 	}
 
-	err = sync.Run(ctx)
+	runReport, err := sync.Run(ctx)
+	if runPlan != nil {
+		if printErr := printPlan(os.Stdout, plan, runPlan); printErr != nil {
+			log.Error("failed to print plan", zap.Error(printErr))
+		}
+	} else if printErr := printReport(os.Stdout, report, runReport); printErr != nil {
+		log.Error("failed to print report", zap.Error(printErr))
+	}
+	// the run may have used up the timeout
+	if exportErr := metrics.Export(context.WithoutCancel(ctx), config.Metrics); exportErr != nil {
+		log.Error("failed to export metrics", zap.Error(exportErr))
+	}
+	if traceErr := shutdownTracing(context.WithoutCancel(ctx)); traceErr != nil {
+		log.Error("failed to flush traces", zap.Error(traceErr))
+	}
 	if err != nil {
 		log.Fatal("failed to run sync", zap.Error(err))
 	}
 }
+
+func printReport(out io.Writer, format string, report sync.RunReport) error {
+	switch format {
+	case "table":
+		return report.WriteTable(out)
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "none":
+		return nil
+	}
+
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+// printPlan writes the plan with the json names of its fields in both
+// formats, so that plans can be converted between them.
+func printPlan(out io.Writer, format string, plan *sync.Plan) error {
+	raw, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		_, err = fmt.Fprintf(out, "%s\n", raw)
+		return err
+	case "yaml":
+		// json is yaml, parsing it into a node keeps the order of the fields
+		// and the numbers as they are
+		var node yaml.Node
+		if err := yaml.Unmarshal(raw, &node); err != nil {
+			return err
+		}
+		blockStyle(&node)
+
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	return fmt.Errorf("unknown plan format %q", format)
+}
+
+// blockStyle drops the json flow style of a parsed node.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, n := range node.Content {
+		blockStyle(n)
+	}
+}
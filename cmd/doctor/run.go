@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	zap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/configloader"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+// exit codes, so that the command can be used as a monitoring probe
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitError  = 2
+)
+
+var GitCommit string
+
+func configureLogger(verbose bool) error {
+	config := zap.NewDevelopmentConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if verbose {
+		config.Level.SetLevel(zapcore.DebugLevel)
+	} else {
+		config.Level.SetLevel(zapcore.WarnLevel)
+	}
+
+	opts := []zap.Option{
+		zap.AddCallerSkip(1),
+	}
+
+	logger, err := config.Build(opts...)
+	if err != nil {
+		return err
+	}
+	logging.SetCustomGlobalLogger(logger)
+
+	return nil
+}
+
+// askToCreate asks on in whether a missing mailbox should be created, it
+// answers no when there is no input, such as when run by a monitor.
+func askToCreate(in *bufio.Reader, out io.Writer) func(string) bool {
+	return func(name string) bool {
+		fmt.Fprintf(out, "mailbox %q does not exist, create it? [y/N] ", name)
+
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			fmt.Fprintln(out)
+			return false
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+func main() {
+	var (
+		verbose bool
+		create  string
+		format  string
+		timeout time.Duration
+	)
+
+	flag.BoolVar(&verbose, "verbose", false, "print debug lines")
+	flag.StringVar(&create, "create-mailboxes", "ask", "whether to create missing mailboxes: ask, yes or no")
+	flag.StringVar(&format, "format", "table", "format of the results: table or json")
+	flag.DurationVar(&timeout, "timeout", time.Minute, "timeout for all the checks")
+	var cfgFlags configloader.Flags
+	cfgFlags.Register(flag.CommandLine)
+	flag.Parse()
+
+	if create != "ask" && create != "yes" && create != "no" {
+		log.Printf("unknown value for -create-mailboxes %q", create)
+		os.Exit(exitError)
+	}
+	if format != "table" && format != "json" {
+		log.Printf("unknown format %q", format)
+		os.Exit(exitError)
+	}
+
+	if err := configureLogger(verbose); err != nil {
+		log.Print(err)
+		os.Exit(exitError)
+	}
+
+	commit := "dev"
+	if GitCommit != "" {
+		commit = GitCommit
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, types.VersionCtxKey{}, commit)
+
+	config, err := configloader.Load(ctx, cfgFlags)
+	if err != nil {
+		log.Printf("failed to get config: %v", err)
+		os.Exit(exitError)
+	}
+	if cfgFlags.Print {
+		if err := configloader.WriteRedacted(os.Stdout, config); err != nil {
+			log.Printf("failed to print config: %v", err)
+			os.Exit(exitError)
+		}
+		return
+	}
+
+	var opts sync.DoctorOptions
+	switch create {
+	case "ask":
+		opts.CreateMailbox = askToCreate(bufio.NewReader(os.Stdin), os.Stderr)
+	case "yes":
+		opts.CreateMailbox = func(string) bool { return true }
+	}
+
+	s := &sync.Sync{
+		Config: config,
+	}
+	checks := s.Doctor(ctx, opts)
+
+	if format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(checks)
+	} else {
+		err = sync.WriteChecks(os.Stdout, checks)
+	}
+	if err != nil {
+		log.Printf("failed to print results: %v", err)
+		os.Exit(exitError)
+	}
+
+	if sync.ChecksFailed(checks) {
+		os.Exit(exitFailed)
+	}
+	os.Exit(exitOK)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+	_ "time/tzdata"
+
+	zap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/statement"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/configloader"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
+)
+
+var GitCommit string
+
+func configureLogger(execute, verbose bool) error {
+	config := zap.NewDevelopmentConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if verbose {
+		config.Level.SetLevel(zapcore.DebugLevel)
+	} else {
+		config.Level.SetLevel(zapcore.InfoLevel)
+	}
+
+	opts := []zap.Option{
+		zap.AddCallerSkip(1),
+	}
+
+	logger, err := config.Build(opts...)
+	if err != nil {
+		return err
+	}
+
+	if !execute {
+		logger = logger.With(zap.Bool("dryrun", true))
+	}
+	logging.SetCustomGlobalLogger(logger)
+
+	return nil
+}
+
+// getImporter returns the statement importer configured with the given name,
+// OFX and QFX files can also be imported without configuration.
+func getImporter(config types.Config, name, file string) (*statement.Importer, error) {
+	loc, err := time.LoadLocation(config.Timezone)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, c := range config.Statements {
+		if strings.EqualFold(c.Name, name) {
+			return statement.New(c, loc)
+		}
+	}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	if ext == ".ofx" || ext == ".qfx" {
+		return statement.New(statement.Config{
+			Name:   name,
+			Format: statement.FormatOFX,
+		}, loc)
+	}
+
+	return nil, fmt.Errorf("there is no statement importer named %q for %s", name, file)
+}
+
+func main() {
+	ctx := context.Background()
+
+	var (
+		execute bool
+		verbose bool
+		email   string
+		bank    string
+	)
+
+	flag.BoolVar(&execute, "execute", false, "execute actual changes")
+	flag.BoolVar(&verbose, "verbose", false, "print debug lines")
+	flag.StringVar(&email, "user", "", "email of the user to import the transactions for")
+	flag.StringVar(&bank, "bank", "", "name of the statement importer, or bank name for OFX/QFX files")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s -user email -bank name [flags] file...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	var cfgFlags configloader.Flags
+	cfgFlags.Register(flag.CommandLine)
+	flag.Parse()
+
+	if email == "" || bank == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := configureLogger(execute, verbose); err != nil {
+		log.Fatal(err)
+	}
+
+	commit := "dev"
+	if GitCommit != "" {
+		commit = GitCommit
+	}
+	ctx = context.WithValue(ctx, types.VersionCtxKey{}, commit)
+
+	log := logging.New()
+	defer func() { _ = log.Sync() }()
+
+	config, err := configloader.Load(ctx, cfgFlags)
+	if err != nil {
+		log.Fatal("failed to get config", logging.Error(err))
+	}
+	if cfgFlags.Print {
+		if err := configloader.WriteRedacted(os.Stdout, config); err != nil {
+			log.Fatal("failed to print config", logging.Error(err))
+		}
+		return
+	}
+
+	var trxs []*banktypes.TrxInfo
+	for _, file := range flag.Args() {
+		importer, err := getImporter(config, bank, file)
+		if err != nil {
+			log.Fatal("failed to get importer", logging.Error(err))
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			log.Fatal("failed to read file", logging.String("file", file), logging.Error(err))
+		}
+
+		ts, err := importer.Import(data)
+		if err != nil {
+			log.Fatal("failed to import file", logging.String("file", file), logging.Error(err))
+		}
+
+		trxs = append(trxs, ts...)
+	}
+
+	shutdownTracing, err := tracing.Setup(ctx, config.Tracing, "toshl-sync-import", commit)
+	if err != nil {
+		log.Fatal("failed to set up tracing", logging.Error(err))
+	}
+
+	sync := sync.Sync{
+		Config: config,
+		DryRun: !execute,
+	}
+
+	results, err := sync.Import(ctx, email, trxs)
+	if traceErr := shutdownTracing(ctx); traceErr != nil {
+		log.Error("failed to flush traces", logging.Error(traceErr))
+	}
+	if err != nil {
+		log.Fatal("failed to import transactions", logging.Error(err))
+	}
+
+	failed := printResults(os.Stdout, results)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func printResults(out io.Writer, results []sync.IngestResult) (failed int) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	fmt.Fprintln(w, "DATE\tACCOUNT\tAMOUNT\tDESCRIPTION\tSTATUS")
+	for _, r := range results {
+		status := "registered"
+		switch {
+		case sync.ErrDuplicateEntry.Has(r.Err):
+			status = "duplicate"
+		case r.Err != nil:
+			status = "failed: " + r.Err.Error()
+			failed++
+		}
+
+		sign := ""
+		if r.Trx.Type == banktypes.Expense {
+			sign = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s%.2f\t%s\t%s\n",
+			r.Trx.Date.Format("2006-01-02"),
+			r.Trx.Account,
+			sign,
+			r.Trx.Value.Number,
+			r.Trx.Description,
+			status,
+		)
+	}
+
+	return failed
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	_ "time/tzdata"
+
+	zap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/configloader"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+var GitCommit string
+
+func configureLogger(execute, verbose bool) error {
+	config := zap.NewDevelopmentConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if verbose {
+		config.Level.SetLevel(zapcore.DebugLevel)
+	} else {
+		config.Level.SetLevel(zapcore.InfoLevel)
+	}
+
+	opts := []zap.Option{
+		zap.AddCallerSkip(1),
+	}
+
+	logger, err := config.Build(opts...)
+	if err != nil {
+		return err
+	}
+
+	if !execute {
+		logger = logger.With(zap.Bool("dryrun", true))
+	}
+	logging.SetCustomGlobalLogger(logger)
+
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	var (
+		execute bool
+		verbose bool
+	)
+
+	flag.BoolVar(&execute, "execute", false, "execute actual changes")
+	flag.BoolVar(&verbose, "verbose", false, "print debug lines")
+	var cfgFlags configloader.Flags
+	cfgFlags.Register(flag.CommandLine)
+	flag.Parse()
+
+	if err := configureLogger(execute, verbose); err != nil {
+		log.Fatal(err)
+	}
+
+	commit := "dev"
+	if GitCommit != "" {
+		commit = GitCommit
+	}
+	ctx = context.WithValue(ctx, types.VersionCtxKey{}, commit)
+
+	log := logging.New()
+	defer func() { _ = log.Sync() }()
+
+	config, err := configloader.Load(ctx, cfgFlags)
+	if err != nil {
+		log.Fatal("failed to get config", logging.Error(err))
+	}
+	if cfgFlags.Print {
+		if err := configloader.WriteRedacted(os.Stdout, config); err != nil {
+			log.Fatal("failed to print config", logging.Error(err))
+		}
+		return
+	}
+
+	sync := sync.Sync{
+		Config: config,
+		DryRun: !execute,
+	}
+
+	n, err := sync.ReencryptUsers(ctx)
+	if err != nil {
+		log.Fatal("failed to encrypt user configs", logging.Error(err))
+	}
+
+	if execute {
+		fmt.Printf("encrypted %d user configs\n", n)
+	} else {
+		fmt.Printf("%d user configs would be encrypted\n", n)
+	}
+}
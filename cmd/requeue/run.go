@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	_ "time/tzdata"
+
+	zap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/configloader"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+var GitCommit string
+
+// reasons are the names of the failure keywords accepted by -reason.
+var reasons = map[string]string{
+	"user-not-found":   sync.KeywordUserNotFound,
+	"unmapped-account": sync.KeywordUnmappedAccount,
+	"accounting-error": sync.KeywordAccountingError,
+}
+
+func configureLogger(execute, verbose bool) error {
+	config := zap.NewDevelopmentConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	if verbose {
+		config.Level.SetLevel(zapcore.DebugLevel)
+	} else {
+		config.Level.SetLevel(zapcore.InfoLevel)
+	}
+
+	opts := []zap.Option{
+		zap.AddCallerSkip(1),
+	}
+
+	logger, err := config.Build(opts...)
+	if err != nil {
+		return err
+	}
+
+	if !execute {
+		logger = logger.With(zap.Bool("dryrun", true))
+	}
+	logging.SetCustomGlobalLogger(logger)
+
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	var (
+		execute bool
+		verbose bool
+		reason  string
+	)
+
+	flag.BoolVar(&execute, "execute", false, "execute actual changes")
+	flag.BoolVar(&verbose, "verbose", false, "print debug lines")
+	flag.StringVar(&reason, "reason", "", "comma separated failures to requeue: user-not-found, unmapped-account or accounting-error, all of them by default")
+	var cfgFlags configloader.Flags
+	cfgFlags.Register(flag.CommandLine)
+	flag.Parse()
+
+	var keywords []string
+	if reason != "" {
+		for _, r := range strings.Split(reason, ",") {
+			kw, ok := reasons[strings.TrimSpace(r)]
+			if !ok {
+				log.Fatalf("unknown reason %q", r)
+			}
+			keywords = append(keywords, kw)
+		}
+	}
+
+	if err := configureLogger(execute, verbose); err != nil {
+		log.Fatal(err)
+	}
+
+	commit := "dev"
+	if GitCommit != "" {
+		commit = GitCommit
+	}
+	ctx = context.WithValue(ctx, types.VersionCtxKey{}, commit)
+
+	log := logging.New()
+	defer func() { _ = log.Sync() }()
+
+	config, err := configloader.Load(ctx, cfgFlags)
+	if err != nil {
+		log.Fatal("failed to get config", logging.Error(err))
+	}
+	if cfgFlags.Print {
+		if err := configloader.WriteRedacted(os.Stdout, config); err != nil {
+			log.Fatal("failed to print config", logging.Error(err))
+		}
+		return
+	}
+	if err := configloader.Validate(config); err != nil {
+		log.Fatal("invalid config", logging.Error(err))
+	}
+
+	sync := sync.Sync{
+		Config: config,
+		DryRun: !execute,
+	}
+
+	n, err := sync.Requeue(ctx, keywords...)
+	if err != nil {
+		log.Fatal("failed to requeue messages", logging.Error(err))
+	}
+
+	if execute {
+		fmt.Printf("requeued %d messages\n", n)
+	} else {
+		fmt.Printf("%d messages would be requeued\n", n)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	zap "go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/configloader"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/external/twilio"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/webhook"
+)
+
+var GitCommit string
+
+func configureLogger(execute, verbose bool) error {
+	config := zap.NewProductionConfig()
+	if verbose {
+		config.Level.SetLevel(zapcore.DebugLevel)
+	}
+
+	opts := []zap.Option{
+		zap.AddCallerSkip(1),
+	}
+
+	logger, err := config.Build(opts...)
+	if err != nil {
+		return err
+	}
+
+	if !execute {
+		logger = logger.With(zap.Bool("dryrun", true))
+	}
+	logging.SetCustomGlobalLogger(logger)
+
+	return nil
+}
+
+func main() {
+	var (
+		execute bool
+		verbose bool
+		addr    string
+		url     string
+
+		allowUnsignedSMS bool
+	)
+
+	flag.BoolVar(&execute, "execute", false, "execute actual changes")
+	flag.BoolVar(&verbose, "verbose", false, "print debug lines")
+	flag.StringVar(&addr, "addr", ":8080", "address to listen on")
+	flag.StringVar(&url, "public-url", "", "public url of the server, used to validate twilio signatures")
+	flag.BoolVar(&allowUnsignedSMS, "allow-unsigned-sms", false, "accept inbound sms without a public url to validate their twilio signatures")
+	var cfgFlags configloader.Flags
+	cfgFlags.Register(flag.CommandLine)
+	flag.Parse()
+
+	if err := configureLogger(execute, verbose); err != nil {
+		log.Fatal(err)
+	}
+
+	commit := "dev"
+	if GitCommit != "" {
+		commit = GitCommit
+	}
+
+	log := logging.New()
+	defer func() { _ = log.Sync() }()
+
+	config, err := configloader.Load(context.Background(), cfgFlags)
+	if err != nil {
+		log.Fatal("failed to get config", logging.Error(err))
+	}
+	if cfgFlags.Print {
+		if err := configloader.WriteRedacted(os.Stdout, config); err != nil {
+			log.Fatal("failed to print config", logging.Error(err))
+		}
+		return
+	}
+	if err := configloader.Validate(config); err != nil {
+		log.Fatal("invalid config", logging.Error(err))
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Tracing, "toshl-sync-webhook", commit)
+	if err != nil {
+		log.Fatal("failed to set up tracing", logging.Error(err))
+	}
+	defer func() { _ = shutdownTracing(context.Background()) }()
+
+	srv := &webhook.Server{
+		Ingester: &sync.Sync{
+			Config: config,
+			DryRun: !execute,
+		},
+		PublicURL:        url,
+		AllowUnsignedSMS: allowUnsignedSMS,
+	}
+
+	switch {
+	case url != "":
+		srv.TwilioValidator = &twilio.Client{
+			AccountSid: config.Twilio.AccountSid,
+			Token:      config.Twilio.AuthToken,
+		}
+	case allowUnsignedSMS:
+		log.Warn("twilio signatures are not validated, anyone with an api key can send sms alerts to /sms/twilio, set -public-url to validate them")
+	default:
+		log.Warn("inbound sms to /sms/twilio are refused, set -public-url to validate their twilio signatures")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	baseCtx := context.WithValue(ctx, types.VersionCtxKey{}, commit)
+	baseCtx = log.With(zap.String("version", commit)).GetContext(baseCtx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", srv.Handler())
+
+	httpSrv := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		BaseContext: func(_ net.Listener) context.Context {
+			return baseCtx
+		},
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = httpSrv.Shutdown(shutdownCtx)
+	}()
+
+	log.Info("listening for alerts", logging.String("addr", addr))
+
+	if err := httpSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		_ = shutdownTracing(context.Background())
+		log.Fatal("server failed", logging.Error(err))
+	}
+}
@@ -1,16 +1,18 @@
 package bancolombia
 
 import (
-	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/zeebo/errs"
 
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/validation"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilparse"
 	regexp_util "github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilregexp"
 )
 
@@ -35,6 +37,17 @@ func (b Bancolombia) ComesFrom(from []string) bool {
 	return false
 }
 
+func (b Bancolombia) ComesFromSMS(sender string) bool {
+	sender = strings.TrimPrefix(strings.ReplaceAll(sender, " ", ""), "+")
+
+	switch sender {
+	case "87400", "85540", "891333":
+		return true
+	}
+
+	return false
+}
+
 func (b Bancolombia) FilterMessage(msg banktypes.Message) bool {
 	text := string(msg.Body())
 	_, keep := regexp_util.MatchesAnyRegexp(regexMatching, text)
@@ -42,34 +55,41 @@ func (b Bancolombia) FilterMessage(msg banktypes.Message) bool {
 	return keep
 }
 
+// The date and time of the transaction are written after most alerts, and
+// override the date that the message was sent.
+const (
+	dateThenTime = `(?: (?:el )?(?P<date>\d{1,2}/\d{1,2}/\d{4})(?: a las)? (?P<time>\d{1,2}:\d{2}))?`
+	timeThenDate = `(?: (?P<time>\d{1,2}:\d{2}) (?P<date>\d{1,2}/\d{1,2}/\d{4}))?`
+)
+
 var regexMatching = []*regexp_util.Match[banktypes.TrxType]{
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) a (?P<place>.+) desde (?:cta|T\.CRED) \*(?P<account>\d{4})\.`,
+			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) a (?P<place>.+) desde (?:cta|T\.CRED) \*(?P<account>\d{4})\.` + dateThenTime,
 		),
 		Value: banktypes.Expense,
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) en (?P<place>[^\.]+)\..+T\.Cred \*(?P<account>\d{4})\.`,
+			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) en (?P<place>[^\.]+ (?P<time>\d{1,2}:\d{2})|[^\.]+)\.(?: (?P<date>\d{1,2}/\d{1,2}/\d{4}))?.+T\.Cred \*(?P<account>\d{4})\.`,
 		),
 		Value: banktypes.Expense,
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) en (?P<place>.+)\..+T\.(?:Cred|Deb) \*(?P<account>\d{4})\.`,
+			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) en (?P<place>.+ (?P<time>\d{1,2}:\d{2})|.+)\.(?: (?P<date>(?:Hora )?(?:\d{1,2}:\d{2} )?\d{1,2}/\d{1,2}/\d{4}))?.+T\.(?:Cred|Deb) \*(?P<account>\d{4})\.`,
 		),
 		Value: banktypes.Expense,
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) desde cta \*(?P<account>\d{4}).+cta (?P<place>\d{9,16})\.`,
+			`Bancolombia le informa (?P<type>\w+) por \$(?P<value>[0-9,\.]+) desde cta \*(?P<account>\d{4}).+cta (?P<place>\d{9,16})\.` + dateThenTime,
 		),
 		Value: banktypes.Expense,
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Realizaste una (?P<type>\w+) con QR por \$(?P<value>[0-9,\.]+), desde cta \*(?P<account>\d{4}) a cta (?P<place>\d{9,16})\.`,
+			`Realizaste una (?P<type>\w+) con QR por \$(?P<value>[0-9,\.]+), desde cta \*(?P<account>\d{4}) a cta (?P<place>\d{9,16})\.` + dateThenTime,
 		),
 		Value: banktypes.Expense,
 	},
@@ -81,25 +101,25 @@ var regexMatching = []*regexp_util.Match[banktypes.TrxType]{
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia te informa (?P<type>\w+) transferencia de (?P<place>[A-Z\s]+) por \$(?P<value>[0-9,\.]+) en la cuenta \*(?P<account>[0-9]+)\.`,
+			`Bancolombia te informa (?P<type>\w+) transferencia de (?P<place>[A-Z\s]+) por \$(?P<value>[0-9,\.]+) en la cuenta \*(?P<account>[0-9]+)\.` + dateThenTime,
 		),
 		Value: banktypes.Income,
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia le informa un (?P<type>\w+) (?P<place>[\w\s]+) por \$(?P<value>[0-9,\.]+) en su Cuenta (?P<account>\w+)\.`,
+			`Bancolombia le informa un (?P<type>\w+) (?P<place>[\w\s]+) por \$(?P<value>[0-9,\.]+) en su Cuenta (?P<account>\w+)\.` + timeThenDate,
 		),
 		Value: banktypes.Income,
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia le informa un (?P<type>[\w\s]+) de (?P<place>[\w\s\.]+) por \$(?P<value>[0-9,\.]+) en su Cuenta (?P<account>\w+)\.`,
+			`Bancolombia le informa un (?P<type>[\w\s]+) de (?P<place>[\w\s\.]+) por \$(?P<value>[0-9,\.]+) en su Cuenta (?P<account>\w+)\.` + timeThenDate,
 		),
 		Value: banktypes.Income,
 	},
 	{
 		Regexp: regexp.MustCompile(
-			`Bancolombia te informa (?P<type>[\w\s]+) por \$(?P<value>[0-9,\.]+) a (?P<place>[\w\s\.]+) desde producto \*(?P<account>\w+)\.`,
+			`Bancolombia te informa (?P<type>[\w\s]+) por \$(?P<value>[0-9,\.]+) a (?P<place>[\w\s\.]+) desde producto \*(?P<account>\w+)\.` + dateThenTime,
 		),
 		Value: banktypes.Expense,
 	},
@@ -119,18 +139,25 @@ func (b Bancolombia) ExtractTransactionInfoFromMessage(
 		return nil, errs.New("message did not match any regexp")
 	}
 
+	regexpErr := func(err error) error {
+		return &banktypes.RegexpError{
+			Regexp: strconv.Itoa(slices.Index(regexMatching, selectedRegexp)),
+			Err:    err,
+		}
+	}
+
 	result := regexp_util.ExtractFieldsWithMatch(text, selectedRegexp)
 
 	if !validation.ContainsAllRequiredFields(result) {
-		return nil, errs.New(
+		return nil, regexpErr(errs.New(
 			"message does not contain all required fields: [result:%+v]",
 			result,
-		)
+		))
 	}
 
 	value, err := getValueFromText(result["value"])
 	if err != nil {
-		return nil, errs.Wrap(err)
+		return nil, regexpErr(errs.Wrap(err))
 	}
 
 	action := result["type"]
@@ -139,7 +166,7 @@ func (b Bancolombia) ExtractTransactionInfoFromMessage(
 	trxType := selectedRegexp.Value
 
 	return &banktypes.TrxInfo{
-		Date:          msg.Date(),
+		Date:          banktypes.TransactionDate(result, msg, location),
 		Bank:          b,
 		Action:        action,
 		Description:   place,
@@ -150,75 +177,23 @@ func (b Bancolombia) ExtractTransactionInfoFromMessage(
 	}, nil
 }
 
-// This would be way easier if Bancolombia had a consistent use of commas and dots inside the currency
-var (
-	currencyRegexp = regexp.MustCompile(
-		`^(?P<integer>[0-9\.,]+)[\.,](?P<decimal>\d{2})$`,
-	)
-	currencyRegexpWithoutDecimal = regexp.MustCompile(`^(?P<integer>[0-9\.,]+)`)
-)
-
-func getValueFromTextWithDecimal(s string) (string, error) {
-	if !currencyRegexp.MatchString(s) {
-		return "", fmt.Errorf("string [%s] does not match regex [%s]", s, currencyRegexp.String())
-	}
-
-	res := regexp_util.ExtractFields(s, currencyRegexp)
-	integer, ok := res["integer"]
-	if !ok {
-		return "", fmt.Errorf("string [%s] should have an integer part", s)
-	}
-
-	decimal, ok := res["decimal"]
-	if !ok {
-		return "", fmt.Errorf("string [%s] should have a decimal part", s)
-	}
-
-	integer = strings.ReplaceAll(integer, ",", "")
-	integer = strings.ReplaceAll(integer, ".", "")
-	valueStr := integer + "." + decimal
-
-	return valueStr, nil
-}
-
-func getValueFromTextWithoutDecimal(s string) (string, error) {
-	if !currencyRegexpWithoutDecimal.MatchString(s) {
-		return "", fmt.Errorf(
-			"string [%s] does not match regex without decimal [%s]",
-			s,
-			currencyRegexp.String(),
-		)
-	}
+// location is where Bancolombia writes the times of its alerts, Colombia has
+// no daylight saving time
+var location = time.FixedZone("COT", -5*60*60)
 
-	res := regexp_util.ExtractFields(s, currencyRegexpWithoutDecimal)
-	integer, ok := res["integer"]
-	if !ok {
-		return "", fmt.Errorf("string [%s] should have an integer part", s)
-	}
-
-	integer = strings.ReplaceAll(integer, ",", "")
-	integer = strings.ReplaceAll(integer, ".", "")
-	decimal := "0"
-	valueStr := integer + "." + decimal
-
-	return valueStr, nil
-}
+// Bancolombia writes amounts with either dots or commas as the decimal
+// separator, but always with two decimals when it writes them
+var amountFormats = []utilparse.AmountFormat{utilparse.FormatCO, utilparse.FormatUS}
 
 func getValueFromText(s string) (currency.Amount, error) {
-	valueStr, err := getValueFromTextWithDecimal(s)
-	if err != nil {
-		valueStr, err = getValueFromTextWithoutDecimal(s)
-	}
-
+	value, err := utilparse.ParseAmount(s, amountFormats...)
 	if err != nil {
 		return currency.Amount{}, err
 	}
 
-	value, err := strconv.ParseFloat(valueStr, 64)
-
 	var amount currency.Amount
 	amount.Code = "COP"
 	amount.Number = value
 
-	return amount, err
+	return amount, nil
 }
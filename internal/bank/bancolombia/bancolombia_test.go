@@ -131,6 +131,7 @@ func (m testMessage) To() []string    { return m.to }
 func (m testMessage) Subject() string { return m.subject }
 func (m testMessage) Date() time.Time { return m.date }
 func (m testMessage) Body() []byte    { return m.body }
+func (m testMessage) RawBody() []byte { return m.body }
 
 func generateTestMessage(body string) banktypes.Message {
 	return testMessage{
@@ -162,3 +163,74 @@ func Test_RegexpExpressions(t *testing.T) {
 		}
 	}
 }
+
+func Test_ComesFromSMS(t *testing.T) {
+	bank := Bancolombia{}
+
+	assert.True(t, bank.ComesFromSMS("87400"))
+	assert.True(t, bank.ComesFromSMS("+85540"))
+	assert.False(t, bank.ComesFromSMS("+573001234567"))
+
+	msg := banktypes.SMSMessage{
+		TextMessage: banktypes.TextMessage{
+			Sender: "87400",
+			Text:   "Bancolombia le informa compra por $30,000.00 a Prueba desde cta *0000.",
+		},
+	}
+	assert.True(t, banktypes.ComesFrom(bank, msg))
+	assert.True(t, bank.FilterMessage(msg))
+}
+
+func Test_TransactionDate(t *testing.T) {
+	bank := Bancolombia{}
+	sent := time.Date(2024, time.March, 13, 0, 2, 51, 0, location)
+
+	tests := []struct {
+		Body string
+		Date time.Time
+	}{
+		{
+			Body: "Bancolombia te informa Recepcion transferencia de NOMBRE por $810,000.00 en la cuenta *9657. 12/03/2024 21:14. Inquietudes al 018000.",
+			Date: time.Date(2024, time.March, 12, 21, 14, 0, 0, location),
+		},
+		{
+			Body: "Bancolombia le informa compra por $30,000.00 a Prueba desde cta *0000. el 12/03/2024 a las 21:14.",
+			Date: time.Date(2024, time.March, 12, 21, 14, 0, 0, location),
+		},
+		{
+			Body: "Bancolombia le informa Compra por $3.150,00 en EXITO EXPRESS AVE 19 23:58. 12/03/2024 T.Deb *5021.",
+			Date: time.Date(2024, time.March, 12, 23, 58, 0, 0, location),
+		},
+		{
+			Body: "Bancolombia le informa Retiro por $70.000,00 en CALLE100-2. Hora 16:44 12/03/2024 T.Deb *5021.",
+			Date: time.Date(2024, time.March, 12, 16, 44, 0, 0, location),
+		},
+		{
+			Body: "Bancolombia le informa un Pago de Nomina de EMPRESA SAS por $8.300.000,00 en su Cuenta AHORROS. 15:20 11/03/2024.",
+			Date: time.Date(2024, time.March, 11, 15, 20, 0, 0, location),
+		},
+		{
+			// too long before the alert was sent
+			Body: "Bancolombia te informa Recepcion transferencia de NOMBRE por $810,000.00 en la cuenta *9657. 12/03/2023 21:14.",
+			Date: sent,
+		},
+		{
+			// after the alert was sent
+			Body: "Bancolombia te informa Recepcion transferencia de NOMBRE por $810,000.00 en la cuenta *9657. 13/03/2024 09:00.",
+			Date: sent,
+		},
+		{
+			Body: "Bancolombia le informa compra por $30,000.00 a Prueba desde cta *0000.",
+			Date: sent,
+		},
+	}
+
+	for _, tt := range tests {
+		msg := testMessage{id: 1, date: sent, body: []byte(tt.Body)}
+
+		res, err := bank.ExtractTransactionInfoFromMessage(msg)
+		if assert.NoError(t, err, tt.Body) {
+			assert.Equal(t, tt.Date, res.Date, tt.Body)
+		}
+	}
+}
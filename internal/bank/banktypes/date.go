@@ -0,0 +1,41 @@
+package banktypes
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilparse"
+)
+
+// The date written in an alert is only trusted when it is at most
+// MaxAlertDelay before the message was sent, or MaxClockSkew after it.
+const (
+	MaxAlertDelay = 72 * time.Hour
+	MaxClockSkew  = time.Hour
+)
+
+// TransactionDate returns the date in the optional date and time groups that
+// were extracted from msg, written in loc. It is the date that msg was sent
+// when the groups are empty, can not be parsed or are not within the window
+// around it.
+func TransactionDate(fields map[string]string, msg Message, loc *time.Location) time.Time {
+	sent := msg.Date()
+
+	s := strings.TrimSpace(fields["date"] + " " + fields["time"])
+	if s == "" {
+		return sent
+	}
+
+	date, err := utilparse.ParseDate(s, sent, loc)
+	if err != nil || !InAlertWindow(date, sent) {
+		return sent
+	}
+
+	return date
+}
+
+// InAlertWindow reports whether a transaction on date can be the one in an
+// alert that was sent on sent.
+func InAlertWindow(date, sent time.Time) bool {
+	return !date.Before(sent.Add(-MaxAlertDelay)) && !date.After(sent.Add(MaxClockSkew))
+}
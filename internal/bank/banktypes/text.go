@@ -0,0 +1,60 @@
+package banktypes
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utiltext"
+)
+
+// TextMessage is a Message that did not come from a mailbox, such as an
+// alert forwarded over HTTP from a phone.
+type TextMessage struct {
+	Key       string
+	Sender    string
+	Recipient string
+	Title     string
+	Sent      time.Time
+	Text      string
+}
+
+func (m TextMessage) ID() uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(m.Key))
+	return h.Sum32()
+}
+
+// MessageID is the idempotency key the message was sent with.
+func (m TextMessage) MessageID() string {
+	return m.Key
+}
+
+func (m TextMessage) From() []string {
+	return []string{m.Sender}
+}
+
+func (m TextMessage) To() []string {
+	return []string{m.Recipient}
+}
+
+func (m TextMessage) Subject() string {
+	return m.Title
+}
+
+func (m TextMessage) Date() time.Time {
+	return m.Sent
+}
+
+func (m TextMessage) Body() []byte {
+	return []byte(utiltext.Normalize(m.Text))
+}
+
+func (m TextMessage) RawBody() []byte {
+	return []byte(m.Text)
+}
+
+// SMSMessage is a TextMessage received by SMS, its Sender is the phone number
+// or short code that sent it.
+type SMSMessage struct {
+	TextMessage
+}
@@ -1,6 +1,7 @@
 package banktypes
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
@@ -12,7 +13,23 @@ type Message interface {
 	To() []string
 	Subject() string
 	Date() time.Time
+	// Body is the normalized plain text of the message, RawBody is the text as
+	// it was received, which may be HTML
 	Body() []byte
+	RawBody() []byte
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// MessageWithAttachments is implemented by messages that carry attachments,
+// such as emailed statements.
+type MessageWithAttachments interface {
+	Message
+	Attachments() []Attachment
 }
 
 type TrxType int8
@@ -38,13 +55,19 @@ func (t TrxType) String() string {
 
 type TrxInfo struct {
 	Date          time.Time
-	Bank          BankDelegate
+	Bank          fmt.Stringer
 	Action        string
 	Description   string
 	Account       string
 	Value         currency.Amount
 	OriginMessage Message
 	Type          TrxType
+	// Category is set when the source already categorized the transaction,
+	// like some statement exports
+	Category string
+	// Merchant is the normalized name of Description, it is set when the
+	// transaction is registered
+	Merchant string
 }
 
 type BankDelegate interface {
@@ -53,3 +76,47 @@ type BankDelegate interface {
 	ExtractTransactionInfoFromMessage(message Message) (*TrxInfo, error)
 	String() string
 }
+
+// SMSBankDelegate is implemented by banks that also send their alerts by SMS,
+// the same FilterMessage and ExtractTransactionInfoFromMessage are used on the
+// SMS body.
+type SMSBankDelegate interface {
+	BankDelegate
+	ComesFromSMS(sender string) bool
+}
+
+// ComesFrom reports whether msg was sent by bank, checking SMS senders for
+// SMSMessage and email senders for everything else.
+func ComesFrom(bank BankDelegate, msg Message) bool {
+	if sms, ok := msg.(SMSMessage); ok {
+		smsBank, ok := bank.(SMSBankDelegate)
+		return ok && smsBank.ComesFromSMS(sms.Sender)
+	}
+
+	return bank.ComesFrom(msg.From())
+}
+
+// StatementImporter is the counterpart of BankDelegate for messages that carry
+// a whole statement as an attachment instead of a single transaction alert.
+type StatementImporter interface {
+	ComesFrom(from []string) bool
+	AcceptsAttachment(attachment Attachment) bool
+	ImportStatement(message Message, attachment Attachment) ([]*TrxInfo, error)
+	String() string
+}
+
+// RegexpError is returned by the banks when a message matched one of their
+// regexps, but the transaction could not be extracted from it. Regexp
+// identifies the regexp within the bank.
+type RegexpError struct {
+	Regexp string
+	Err    error
+}
+
+func (e *RegexpError) Error() string {
+	return fmt.Sprintf("regexp %s: %v", e.Regexp, e.Err)
+}
+
+func (e *RegexpError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,166 @@
+package corpus
+
+import (
+	"bytes"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"github.com/emersion/go-message/mail"
+)
+
+const (
+	// DefaultRecipient replaces the addresses that a message was sent to
+	DefaultRecipient = "usuario@example.com"
+
+	nameReplacement = "NOMBRE"
+)
+
+type Options struct {
+	// Names are replaced in the subject and text of the message, such as the
+	// name of the account holder
+	Names []string
+	// Recipient replaces the To addresses, DefaultRecipient by default
+	Recipient string
+}
+
+var (
+	accountRegexp = regexp.MustCompile(`\*\d{3,6}\b`)
+	numberRegexp  = regexp.MustCompile(`\b\d{7,20}\b`)
+	amountRegexp  = regexp.MustCompile(`\$\s?\d[\d\.,]*`)
+)
+
+// Anonymize returns a message with the same text as raw, in which account
+// numbers, long numbers, amounts and names are replaced. Only the From, To,
+// Subject and Date headers and the text part that is parsed are kept.
+// Replacements are derived from raw, so anonymizing it again gives the same
+// message.
+func Anonymize(raw []byte, opts Options) ([]byte, error) {
+	if opts.Recipient == "" {
+		opts.Recipient = DefaultRecipient
+	}
+
+	mr, err := mail.CreateReader(bytes.NewReader(raw))
+	if err != nil && mr == nil {
+		return nil, corpusErr.New("could not read message: %w", err)
+	}
+	defer func() { _ = mr.Close() }()
+
+	var (
+		contentType string
+		text        []byte
+	)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && p == nil {
+			return nil, corpusErr.New("could not read message part: %w", err)
+		}
+
+		h, ok := p.Header.(*mail.InlineHeader)
+		if !ok {
+			continue
+		}
+
+		ct, _, _ := h.ContentType()
+		if ct == "" {
+			ct = "text/plain"
+		}
+		if ct != "text/plain" && ct != "text/html" {
+			continue
+		}
+
+		data, err := io.ReadAll(p.Body)
+		if err != nil {
+			return nil, corpusErr.Wrap(err)
+		}
+
+		// plain text is parsed before html
+		if text == nil || contentType == "text/html" && ct == "text/plain" {
+			contentType, text = ct, data
+		}
+	}
+	if text == nil {
+		return nil, corpusErr.New("message has no text")
+	}
+
+	seed := fnv.New64a()
+	_, _ = seed.Write(raw)
+	a := anonymizer{
+		rand:  rand.New(rand.NewSource(int64(seed.Sum64()))),
+		names: opts.Names,
+	}
+
+	from, err := mr.Header.AddressList("From")
+	if err != nil {
+		return nil, corpusErr.New("invalid From: %w", err)
+	}
+	date, err := mr.Header.Date()
+	if err != nil {
+		return nil, corpusErr.New("invalid Date: %w", err)
+	}
+	subject, err := mr.Header.Subject()
+	if err != nil {
+		return nil, corpusErr.New("invalid Subject: %w", err)
+	}
+
+	var h mail.Header
+	h.SetAddressList("From", from)
+	h.SetAddressList("To", []*mail.Address{{Address: opts.Recipient}})
+	h.SetSubject(a.scrub(subject))
+	h.SetDate(date)
+	h.SetContentType(contentType, map[string]string{"charset": "utf-8"})
+
+	var out bytes.Buffer
+	w, err := mail.CreateSingleInlineWriter(&out, h)
+	if err != nil {
+		return nil, corpusErr.Wrap(err)
+	}
+	if _, err := io.WriteString(w, a.scrub(string(text))); err != nil {
+		return nil, corpusErr.Wrap(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, corpusErr.Wrap(err)
+	}
+
+	return out.Bytes(), nil
+}
+
+type anonymizer struct {
+	rand  *rand.Rand
+	names []string
+}
+
+func (a anonymizer) scrub(s string) string {
+	for _, n := range a.names {
+		if n = strings.TrimSpace(n); n == "" {
+			continue
+		}
+		s = regexp.MustCompile(`(?i)`+regexp.QuoteMeta(n)).ReplaceAllString(s, nameReplacement)
+	}
+
+	s = accountRegexp.ReplaceAllStringFunc(s, a.digits)
+	s = numberRegexp.ReplaceAllStringFunc(s, a.digits)
+	s = amountRegexp.ReplaceAllStringFunc(s, a.digits)
+
+	return s
+}
+
+// digits replaces every digit in s other than 0 with a random one, keeping
+// the zeros and separators so that round amounts and their formats are kept.
+func (a anonymizer) digits(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c < '1' || c > '9' {
+			continue
+		}
+
+		b[i] = byte('1' + a.rand.Intn(9))
+	}
+
+	return string(b)
+}
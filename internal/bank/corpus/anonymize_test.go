@@ -0,0 +1,45 @@
+package corpus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv"
+)
+
+const rawMessage = "Received: from mx.example.com\r\n" +
+	"Message-ID: <1234@notificacionesbancolombia.com>\r\n" +
+	"From: Alertas <alertasynotificaciones@notificacionesbancolombia.com>\r\n" +
+	"To: Juan Perez <juan.perez@gmail.com>\r\n" +
+	"Subject: Alerta para Juan Perez\r\n" +
+	"Date: Tue, 20 Sep 2022 19:03:12 -0500\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"\r\n" +
+	"Hola JUAN PEREZ, Bancolombia le informa Compra por $3.150,00 en EXITO. 20/09/2022 T.Deb *5021. Llamanos al 0345109095.\r\n"
+
+func Test_Anonymize(t *testing.T) {
+	opts := Options{Names: []string{"Juan Perez"}}
+
+	anonymized, err := Anonymize([]byte(rawMessage), opts)
+	require.NoError(t, err)
+
+	again, err := Anonymize([]byte(rawMessage), opts)
+	require.NoError(t, err)
+	assert.Equal(t, anonymized, again, "anonymizing should be deterministic")
+
+	for _, leaked := range []string{"juan.perez", "Juan Perez", "JUAN PEREZ", "5021", "3.150", "0345109095", "Message-ID", "Received"} {
+		assert.NotContains(t, string(anonymized), leaked)
+	}
+
+	msg, err := mailserv.ReadMessage(bytes.NewReader(anonymized), 1)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alertasynotificaciones@notificacionesbancolombia.com"}, msg.From())
+	assert.Equal(t, []string{DefaultRecipient}, msg.To())
+	assert.Equal(t, "Alerta para NOMBRE", msg.Subject())
+	assert.Equal(t, "2022-09-20T19:03:12-05:00", msg.Date().Format("2006-01-02T15:04:05Z07:00"))
+	assert.Regexp(t, `^Hola NOMBRE, Bancolombia le informa Compra por \$[1-9]\.[1-9]{2}0,00 en EXITO\. 20/09/2022 T\.Deb \*[1-9]0[1-9]{2}\. Llamanos al 0[1-9]{4}0[1-9]0[1-9]{2}\.`, string(msg.Body()))
+}
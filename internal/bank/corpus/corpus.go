@@ -0,0 +1,140 @@
+// Package corpus reads the anonymized bank messages that the parsers are
+// tested against. Each message is a <case>.eml file in the directory of its
+// bank, next to <case>.json with the expected result of parsing it.
+package corpus
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/merchant"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv"
+)
+
+const (
+	MessageExt = ".eml"
+	GoldenExt  = ".json"
+)
+
+var corpusErr = errs.Class("corpus")
+
+type Case struct {
+	// Name is the path of the message in the corpus, without its extension
+	Name    string
+	Path    string
+	Message banktypes.Message
+}
+
+// GoldenPath is the file with the expected result of the case.
+func (c Case) GoldenPath() string {
+	return strings.TrimSuffix(c.Path, MessageExt) + GoldenExt
+}
+
+// Load reads every message in dir, sorted by name.
+func Load(dir string) ([]Case, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && filepath.Ext(path) == MessageExt {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, corpusErr.Wrap(err)
+	}
+	sort.Strings(paths)
+
+	cases := make([]Case, 0, len(paths))
+	for i, path := range paths {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, corpusErr.Wrap(err)
+		}
+
+		msg, err := mailserv.ReadMessage(bytes.NewReader(raw), uint32(i+1))
+		if err != nil {
+			return nil, corpusErr.New("could not read %s: %w", path, err)
+		}
+
+		name, _ := filepath.Rel(dir, path)
+		cases = append(cases, Case{
+			Name:    filepath.ToSlash(strings.TrimSuffix(name, MessageExt)),
+			Path:    path,
+			Message: msg,
+		})
+	}
+
+	return cases, nil
+}
+
+// Golden is the result of parsing a message, with the name of the merchant
+// that the sync would give it without aliases. Bank is empty when no bank
+// handles the message, and the transaction is empty when it could not be
+// extracted.
+type Golden struct {
+	Bank        string     `json:"bank,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Type        string     `json:"type,omitempty"`
+	Action      string     `json:"action,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Merchant    string     `json:"merchant,omitempty"`
+	Account     string     `json:"account,omitempty"`
+	Value       float64    `json:"value,omitempty"`
+	Currency    string     `json:"currency,omitempty"`
+	Date        *time.Time `json:"date,omitempty"`
+}
+
+// Parse extracts the transaction in msg with the first of banks that
+// handles it, as a sync does.
+func Parse(banks []banktypes.BankDelegate, msg banktypes.Message) Golden {
+	for _, bank := range banks {
+		if !banktypes.ComesFrom(bank, msg) || !bank.FilterMessage(msg) {
+			continue
+		}
+
+		g := Golden{
+			Bank: bank.String(),
+		}
+
+		trx, err := bank.ExtractTransactionInfoFromMessage(msg)
+		if err != nil {
+			g.Error = err.Error()
+			return g
+		}
+
+		g.Type = trx.Type.String()
+		g.Action = trx.Action
+		g.Description = trx.Description
+		g.Merchant = merchant.Name(trx.Description, nil)
+		g.Account = trx.Account
+		g.Value = trx.Value.Number
+		g.Currency = trx.Value.Code
+		g.Date = &trx.Date
+
+		return g
+	}
+
+	return Golden{}
+}
+
+// Marshal returns g as it is written in the golden files.
+func (g Golden) Marshal() ([]byte, error) {
+	raw, err := json.MarshalIndent(g, "", "  ")
+	if err != nil {
+		return nil, corpusErr.Wrap(err)
+	}
+
+	return append(raw, '\n'), nil
+}
@@ -0,0 +1,48 @@
+package bank
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/corpus"
+)
+
+var update = flag.Bool("update", false, "rewrite the expected results of the corpus")
+
+func Test_Corpus(t *testing.T) {
+	cases, err := corpus.Load("testdata")
+	require.NoError(t, err)
+	require.NotEmpty(t, cases)
+
+	banks := Repository{}.GetBanks(context.Background())
+
+	for _, bank := range banks {
+		dir := filepath.Join("testdata", strings.ToLower(bank.String()))
+		_, err := os.Stat(dir)
+		assert.NoError(t, err, "bank %s has no messages in the corpus", bank)
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			actual, err := corpus.Parse(banks, c.Message).Marshal()
+			require.NoError(t, err)
+
+			if *update {
+				require.NoError(t, os.WriteFile(c.GoldenPath(), actual, 0o644))
+				return
+			}
+
+			expected, err := os.ReadFile(c.GoldenPath())
+			require.NoError(t, err, "run `go test ./internal/bank -update` to write it")
+			assert.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
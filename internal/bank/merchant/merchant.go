@@ -0,0 +1,106 @@
+// Package merchant turns the descriptions that banks write in their alerts,
+// such as "PAGO PSE EPM MEDELLIN" or "COMPRA EN RAPPI*COLOMBIA", into the
+// name of the merchant.
+package merchant
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Alias gives a display name to the merchants that match Regexp.
+type Alias struct {
+	Regexp *regexp.Regexp
+	Name   string
+}
+
+func known(pattern, name string) Alias {
+	return Alias{Regexp: regexp.MustCompile(`(?i)` + pattern), Name: name}
+}
+
+// Known are common Colombian merchants, the more specific ones go first.
+var Known = []Alias{
+	known(`\bRAPPI\s*PAY\b`, "RappiPay"),
+	known(`\bRAPPI\b`, "Rappi"),
+	known(`\bUBER\s*EATS\b`, "Uber Eats"),
+	known(`\bUBER\b`, "Uber"),
+	known(`\bDIDI\b`, "DiDi"),
+	known(`\bEXITO\b`, "Éxito"),
+	known(`\bCARULLA\b`, "Carulla"),
+	known(`\bJUMBO\b`, "Jumbo"),
+	known(`\bOLIMPICA\b`, "Olímpica"),
+	known(`\bTIENDAS?\s*D1\b|\bD1\s+SAS\b`, "D1"),
+	known(`\bTIENDAS?\s*ARA\b|\bJERONIMO\s*MARTINS\b`, "Ara"),
+	known(`\bALKOSTO\b`, "Alkosto"),
+	known(`\bFALABELLA\b`, "Falabella"),
+	known(`\bHOMECENTER\b|\bSODIMAC\b`, "Homecenter"),
+	known(`\bMERCADO\s*(?:LIBRE|PAGO)\b`, "Mercado Libre"),
+	known(`\bAMAZON\b|\bAMZN\b`, "Amazon"),
+	known(`\bNETFLIX\b`, "Netflix"),
+	known(`\bSPOTIFY\b`, "Spotify"),
+	known(`\bFARMATODO\b`, "Farmatodo"),
+	known(`\bCRUZ\s*VERDE\b`, "Cruz Verde"),
+	known(`\bJUAN\s*VALDEZ\b`, "Juan Valdez"),
+	known(`\bCREPES\b`, "Crepes & Waffles"),
+	known(`\bCINE\s*COLOMBIA\b`, "Cine Colombia"),
+	known(`\bCINEMARK\b`, "Cinemark"),
+	known(`\bTERPEL\b`, "Terpel"),
+	known(`\bPRIMAX\b`, "Primax"),
+	known(`\bAVIANCA\b`, "Avianca"),
+	// UNE EPM Telecomunicaciones is now Tigo, not the EPM utilities
+	known(`\bUNE\s*EPM\b`, "Tigo"),
+	known(`\bEPM\b|\bEMPRESAS\s*PUBLICAS\s*DE\s*MEDELLIN\b`, "EPM"),
+	known(`\bCODENSA\b|\bENEL\b`, "Enel"),
+	known(`\bVANTI\b`, "Vanti"),
+	known(`\bCLARO\b|\bCOMCEL\b`, "Claro"),
+	known(`\bMOVISTAR\b`, "Movistar"),
+	known(`\bTIGO\b`, "Tigo"),
+	known(`\bETB\b`, "ETB"),
+}
+
+// cleanups remove what is not part of the name, in order.
+var cleanups = []struct {
+	Regexp *regexp.Regexp
+	Repl   string
+}{
+	// separators of the payment processors, as in RAPPI*COLOMBIA
+	{regexp.MustCompile(`[*_]+`), " "},
+	{regexp.MustCompile(`(?i)^(?:(?:PAGO|COMPRA)\s+(?:PSE|EN|A|DE)|PSE|COMPRA|DE)\s+`), ""},
+	// the time that some alerts write after the merchant
+	{regexp.MustCompile(`\s+\d{1,2}:\d{2}$`), ""},
+	{regexp.MustCompile(`(?i)(?:\s+(?:MEDELLIN|BOGOTA(?:\s+D\.?\s?C\.?)?|CALI|BARRANQUILLA|CARTAGENA|BUCARAMANGA|PEREIRA|MANIZALES|COLOMBIA|COL|CO))+$`), ""},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// Clean removes the prefixes, separators, times and cities around the name of
+// the merchant in description.
+func Clean(description string) string {
+	cleaned := description
+	for _, c := range cleanups {
+		cleaned = c.Regexp.ReplaceAllString(cleaned, c.Repl)
+	}
+
+	cleaned = strings.TrimSpace(cleaned)
+	if cleaned == "" {
+		return strings.TrimSpace(description)
+	}
+
+	return cleaned
+}
+
+// Name returns the name of the merchant in description: the name of the first
+// of aliases or of the Known merchants that match it, or the cleaned
+// description when none does.
+func Name(description string, aliases []Alias) string {
+	cleaned := Clean(description)
+
+	for _, list := range [][]Alias{aliases, Known} {
+		for _, a := range list {
+			if a.Regexp.MatchString(cleaned) || a.Regexp.MatchString(description) {
+				return a.Name
+			}
+		}
+	}
+
+	return cleaned
+}
@@ -0,0 +1,60 @@
+package merchant
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Clean(t *testing.T) {
+	tests := []struct {
+		In  string
+		Out string
+	}{
+		{In: "PAGO PSE EPM MEDELLIN", Out: "EPM"},
+		{In: "COMPRA EN RAPPI*COLOMBIA", Out: "RAPPI"},
+		{In: "EXITO EXPRESS AVE 19 19:02", Out: "EXITO EXPRESS AVE 19"},
+		{In: "EXITO_FUSAG", Out: "EXITO FUSAG"},
+		{In: "TIENDA LA ESQUINA BOGOTA D.C.", Out: "TIENDA LA ESQUINA"},
+		{In: "  A Toda Hora SA ", Out: "A Toda Hora SA"},
+		{In: "de Nomina de EMPRESA SAS", Out: "Nomina de EMPRESA SAS"},
+		{In: "COLOMBIA", Out: "COLOMBIA"},
+		{In: "0786545291049", Out: "0786545291049"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.Out, Clean(tt.In), tt.In)
+	}
+}
+
+func Test_Name(t *testing.T) {
+	aliases := []Alias{
+		{Regexp: regexp.MustCompile(`(?i)^tienda la esquina`), Name: "La Esquina"},
+		{Regexp: regexp.MustCompile(`(?i)0786545291049`), Name: "Arriendo"},
+		{Regexp: regexp.MustCompile(`(?i)rappi`), Name: "Domicilios"},
+	}
+
+	tests := []struct {
+		In      string
+		Aliases []Alias
+		Out     string
+	}{
+		{In: "PAGO PSE EPM MEDELLIN", Out: "EPM"},
+		{In: "UNE EPM TELECOMUNICACIONES", Out: "Tigo"},
+		{In: "PAGO PSE UNE EPM", Out: "Tigo"},
+		{In: "COMPRA EN RAPPI*COLOMBIA", Out: "Rappi"},
+		{In: "RAPPI RESTAURANTE 11:25", Out: "Rappi"},
+		{In: "RAPPIPAY", Out: "RappiPay"},
+		{In: "EXITO EXPRESS AVE 19 19:02", Out: "Éxito"},
+		{In: "UBER EATS", Out: "Uber Eats"},
+		{In: "TIENDA LA ESQUINA", Out: "TIENDA LA ESQUINA"},
+		{In: "TIENDA LA ESQUINA", Aliases: aliases, Out: "La Esquina"},
+		{In: "0786545291049", Aliases: aliases, Out: "Arriendo"},
+		{In: "COMPRA EN RAPPI*COLOMBIA", Aliases: aliases, Out: "Domicilios"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.Out, Name(tt.In, tt.Aliases), tt.In)
+	}
+}
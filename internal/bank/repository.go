@@ -7,10 +7,16 @@ import (
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
 )
 
-type Repository struct{}
+type Repository struct {
+	Importers []banktypes.StatementImporter
+}
 
 func (r Repository) GetBanks(_ context.Context) []banktypes.BankDelegate {
 	return []banktypes.BankDelegate{
 		bancolombia.Bancolombia{},
 	}
 }
+
+func (r Repository) GetStatementImporters(_ context.Context) []banktypes.StatementImporter {
+	return r.Importers
+}
@@ -0,0 +1,56 @@
+package statement
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+// parseAmount parses values such as "$ -1.234,56" or "(1,234.56)", decimal is
+// the decimal separator and defaults to ".", the other one of "." and "," is
+// taken as the thousands separator.
+func parseAmount(s, decimal string) (float64, error) {
+	if decimal == "" {
+		decimal = "."
+	}
+
+	thousands := ","
+	if decimal == "," {
+		thousands = "."
+	}
+
+	v := strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(v, "(") && strings.HasSuffix(v, ")") {
+		negative = true
+		v = strings.Trim(v, "()")
+	}
+
+	v = strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',', r == '-':
+			return r
+		}
+		return -1
+	}, v)
+
+	if strings.HasPrefix(v, "-") {
+		negative = !negative
+		v = v[1:]
+	}
+
+	v = strings.ReplaceAll(v, thousands, "")
+	v = strings.Replace(v, decimal, ".", 1)
+
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, errs.New("%q is not a valid amount", s)
+	}
+
+	if negative {
+		n = -n
+	}
+
+	return n, nil
+}
@@ -0,0 +1,42 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+
+	"github.com/zeebo/errs"
+)
+
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = guessDelimiter(data)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, errs.New("invalid csv: %w", err)
+	}
+
+	return rows, nil
+}
+
+// guessDelimiter picks the most common of the usual delimiters in the first
+// line, spanish exports are usually separated by semicolons.
+func guessDelimiter(data []byte) rune {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+
+	best, count := ',', 0
+	for _, d := range []rune{',', ';', '\t', '|'} {
+		if c := bytes.Count(line, []byte(string(d))); c > count {
+			best, count = d, c
+		}
+	}
+
+	return best
+}
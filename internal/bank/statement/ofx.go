@@ -0,0 +1,82 @@
+package statement
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+)
+
+var (
+	ofxTransactionRegexp = regexp.MustCompile(`(?is)<STMTTRN>(.*?)</STMTTRN>`)
+	ofxFieldRegexp       = regexp.MustCompile(`(?i)<([A-Z0-9.]+)>([^<\r\n]*)`)
+	ofxDateRegexp        = regexp.MustCompile(`^(\d{8})`)
+)
+
+type ofxStatement struct {
+	Account  string
+	Currency string
+	Records  []record
+}
+
+// readOFX reads the transactions of OFX and QFX files, both the SGML (v1) and
+// XML (v2) variants are supported since only leaf values are used.
+func readOFX(data []byte) (ofxStatement, error) {
+	text := string(data)
+	if !strings.Contains(strings.ToUpper(text), "<OFX>") {
+		return ofxStatement{}, errs.New("file is not an ofx document")
+	}
+
+	var st ofxStatement
+
+	header := text
+	if i := strings.Index(strings.ToUpper(text), "<BANKTRANLIST>"); i >= 0 {
+		header = text[:i]
+	}
+	for _, m := range ofxFieldRegexp.FindAllStringSubmatch(header, -1) {
+		switch strings.ToUpper(m[1]) {
+		case "ACCTID":
+			st.Account = strings.TrimSpace(m[2])
+		case "CURDEF":
+			st.Currency = strings.TrimSpace(m[2])
+		}
+	}
+
+	for _, trn := range ofxTransactionRegexp.FindAllStringSubmatch(text, -1) {
+		fields := make(map[string]string)
+		for _, m := range ofxFieldRegexp.FindAllStringSubmatch(trn[1], -1) {
+			fields[strings.ToUpper(m[1])] = strings.TrimSpace(m[2])
+		}
+
+		description := fields["NAME"]
+		if memo := fields["MEMO"]; memo != "" && memo != description {
+			description = strings.TrimSpace(description + " " + memo)
+		}
+
+		st.Records = append(st.Records, record{
+			Date:        fields["DTPOSTED"],
+			Description: description,
+			Amount:      fields["TRNAMT"],
+		})
+	}
+
+	return st, nil
+}
+
+// parseOFXDate parses dates like "20230104" or "20230104120000.000[-5:COT]",
+// only the calendar day is kept, in the importer's location, so that it does
+// not move to another day when converted to the user's timezone.
+func parseOFXDate(s string, loc *time.Location) (time.Time, error) {
+	m := ofxDateRegexp.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return time.Time{}, errs.New("%q is not a valid ofx date", s)
+	}
+
+	day, err := time.ParseInLocation("20060102", m[1], loc)
+	if err != nil {
+		return time.Time{}, errs.Wrap(err)
+	}
+
+	return day, nil
+}
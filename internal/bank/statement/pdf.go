@@ -0,0 +1,77 @@
+package statement
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+	"github.com/zeebo/errs"
+)
+
+// readPDFLines returns the text layer of a PDF as lines, scanned statements
+// without text are not supported.
+func readPDFLines(data []byte, password string) (_ []string, genErr error) {
+	defer func() {
+		// the pdf library panics on some malformed documents
+		if r := recover(); r != nil {
+			genErr = errs.New("malformed pdf: %v", r)
+		}
+	}()
+
+	var (
+		r   *pdf.Reader
+		err error
+	)
+	if password != "" {
+		r, err = pdf.NewReaderEncrypted(bytes.NewReader(data), int64(len(data)), oncePassword(password))
+	} else {
+		r, err = pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	}
+	if errors.Is(err, pdf.ErrInvalidPassword) {
+		return nil, errs.New("wrong pdf password: %w", err)
+	}
+	if err != nil {
+		return nil, errs.New("could not read pdf: %w", err)
+	}
+
+	var lines []string
+	for n := 1; n <= r.NumPage(); n++ {
+		p := r.Page(n)
+		if p.V.IsNull() {
+			continue
+		}
+
+		rows, err := p.GetTextByRow()
+		if err != nil {
+			return nil, errs.New("could not read text from page %d: %w", n, err)
+		}
+
+		for _, row := range rows {
+			words := make([]string, 0, len(row.Content))
+			for _, t := range row.Content {
+				words = append(words, t.S)
+			}
+			lines = append(lines, strings.Join(words, " "))
+		}
+	}
+
+	if len(lines) == 0 {
+		return nil, errs.New("pdf has no text layer")
+	}
+
+	return lines, nil
+}
+
+// oncePassword returns password the first time it is called and "" after
+// that, the pdf library asks for passwords until it is given "".
+func oncePassword(password string) func() string {
+	asked := false
+	return func() string {
+		if asked {
+			return ""
+		}
+		asked = true
+		return password
+	}
+}
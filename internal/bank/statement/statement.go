@@ -0,0 +1,472 @@
+package statement
+
+import (
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilregexp"
+)
+
+var statementErr = errs.Class("statement")
+
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatPDF  = "pdf"
+	FormatOFX  = "ofx"
+
+	defaultDateLayout = "2006-01-02"
+	defaultCurrency   = "COP"
+)
+
+// Columns are the header names of each field in tabular statements. Either
+// Amount (negative for expenses) or Debit and Credit should be set.
+type Columns struct {
+	Date        string `json:"date"`
+	Description string `json:"description"`
+	Amount      string `json:"amount"`
+	Debit       string `json:"debit"`
+	Credit      string `json:"credit"`
+	Account     string `json:"account"`
+	Category    string `json:"category"`
+}
+
+type Config struct {
+	// Name is used as the bank name when mapping accounts
+	Name     string   `json:"name"`
+	Senders  []string `json:"senders"`
+	Filename string   `json:"filename"`
+	Format   string   `json:"format"`
+	Password string   `json:"password" secret:"true"`
+
+	Columns  Columns `json:"columns"`
+	SkipRows int     `json:"skip_rows"`
+
+	// Line is matched against every line of PDF statements, it should have
+	// the named groups date, description and value, and optionally account
+	Line string `json:"line"`
+
+	DateLayout       string `json:"date_layout"`
+	DecimalSeparator string `json:"decimal_separator"`
+	Account          string `json:"account"`
+	Currency         string `json:"currency"`
+}
+
+type Importer struct {
+	cfg      Config
+	loc      *time.Location
+	filename *regexp.Regexp
+	line     *regexp.Regexp
+}
+
+func NewImporters(cfgs []Config, loc *time.Location) ([]banktypes.StatementImporter, error) {
+	importers := make([]banktypes.StatementImporter, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		i, err := New(cfg, loc)
+		if err != nil {
+			return nil, err
+		}
+		importers = append(importers, i)
+	}
+
+	return importers, nil
+}
+
+func New(cfg Config, loc *time.Location) (_ *Importer, genErr error) {
+	defer func() { genErr = statementErr.Wrap(genErr) }()
+
+	if cfg.Name == "" {
+		return nil, errs.New("statement importer should have a name")
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	i := &Importer{
+		cfg: cfg,
+		loc: loc,
+	}
+
+	if cfg.Filename != "" {
+		exp, err := regexp.Compile(cfg.Filename)
+		if err != nil {
+			return nil, errs.New("invalid filename regexp for %q: %w", cfg.Name, err)
+		}
+		i.filename = exp
+	}
+
+	switch cfg.Format {
+	case FormatCSV, FormatXLSX:
+		c := cfg.Columns
+		if c.Date == "" || (c.Amount == "" && c.Debit == "" && c.Credit == "") {
+			return nil, errs.New("%q should have a date column and an amount or debit/credit columns", cfg.Name)
+		}
+
+	case FormatPDF:
+		exp, err := regexp.Compile(cfg.Line)
+		if err != nil {
+			return nil, errs.New("invalid line regexp for %q: %w", cfg.Name, err)
+		}
+		for _, g := range []string{"date", "description", "value"} {
+			if exp.SubexpIndex(g) < 0 {
+				return nil, errs.New("line regexp for %q should have a %q group", cfg.Name, g)
+			}
+		}
+		i.line = exp
+
+	case FormatOFX:
+		// amounts in ofx always use a dot
+		i.cfg.DecimalSeparator = "."
+
+	default:
+		return nil, errs.New("unknown statement format %q for %q", cfg.Format, cfg.Name)
+	}
+
+	return i, nil
+}
+
+func (i *Importer) String() string {
+	return i.cfg.Name
+}
+
+func (i *Importer) ComesFrom(from []string) bool {
+	for _, f := range from {
+		for _, s := range i.cfg.Senders {
+			if strings.EqualFold(f, s) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (i *Importer) AcceptsAttachment(a banktypes.Attachment) bool {
+	if i.filename != nil && !i.filename.MatchString(a.Filename) {
+		return false
+	}
+
+	ext := strings.TrimPrefix(strings.ToLower(path.Ext(a.Filename)), ".")
+	switch i.cfg.Format {
+	case FormatCSV:
+		return ext == "csv" || ext == "txt" || a.ContentType == "text/csv"
+	case FormatXLSX:
+		return ext == "xlsx"
+	case FormatPDF:
+		return ext == "pdf" || a.ContentType == "application/pdf"
+	case FormatOFX:
+		return ext == "ofx" || ext == "qfx"
+	}
+
+	return false
+}
+
+func (i *Importer) ImportStatement(
+	msg banktypes.Message,
+	a banktypes.Attachment,
+) ([]*banktypes.TrxInfo, error) {
+	trxs, err := i.Import(a.Data)
+	if err != nil {
+		return nil, statementErr.New("could not import %q: %w", a.Filename, err)
+	}
+
+	for _, t := range trxs {
+		t.OriginMessage = msg
+	}
+
+	return trxs, nil
+}
+
+// Import returns the transactions in a statement file, their OriginMessage is
+// left empty.
+func (i *Importer) Import(data []byte) (_ []*banktypes.TrxInfo, genErr error) {
+	defer func() { genErr = statementErr.Wrap(genErr) }()
+
+	var (
+		recs []record
+		err  error
+	)
+	account, code := i.cfg.Account, i.cfg.Currency
+	switch i.cfg.Format {
+	case FormatCSV:
+		var rows [][]string
+		rows, err = readCSV(data)
+		if err == nil {
+			recs, err = i.recordsFromRows(rows)
+		}
+
+	case FormatXLSX:
+		var rows [][]string
+		rows, err = readXLSX(data)
+		if err == nil {
+			recs, err = i.recordsFromRows(rows)
+		}
+
+	case FormatPDF:
+		var lines []string
+		lines, err = readPDFLines(data, i.cfg.Password)
+		if err == nil {
+			recs = i.recordsFromLines(lines)
+		}
+
+	case FormatOFX:
+		var st ofxStatement
+		st, err = readOFX(data)
+		recs = st.Records
+		if account == "" {
+			account = lastDigits(st.Account, 4)
+		}
+		if code == "" {
+			code = st.Currency
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	trxs := make([]*banktypes.TrxInfo, 0, len(recs))
+	for n, r := range recs {
+		t, err := i.trxFromRecord(r, account, code)
+		if err != nil {
+			return nil, errs.New("record %d: %w", n+1, err)
+		}
+		if t != nil {
+			trxs = append(trxs, t)
+		}
+	}
+
+	return trxs, nil
+}
+
+type record struct {
+	Date        string
+	Description string
+	Amount      string
+	Debit       string
+	Credit      string
+	Account     string
+	Category    string
+}
+
+func (i *Importer) recordsFromRows(rows [][]string) ([]record, error) {
+	if len(rows) <= i.cfg.SkipRows {
+		return nil, errs.New("statement has no header row")
+	}
+	rows = rows[i.cfg.SkipRows:]
+
+	header := make(map[string]int, len(rows[0]))
+	for n, h := range rows[0] {
+		header[strings.ToLower(strings.TrimSpace(h))] = n
+	}
+
+	c := i.cfg.Columns
+	idx := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		n, ok := header[strings.ToLower(name)]
+		if !ok {
+			return -1, errs.New("column %q is not in the header %q", name, rows[0])
+		}
+		return n, nil
+	}
+
+	var cols [7]int
+	for n, name := range []string{c.Date, c.Description, c.Amount, c.Debit, c.Credit, c.Account, c.Category} {
+		v, err := idx(name)
+		if err != nil {
+			return nil, err
+		}
+		cols[n] = v
+	}
+
+	cell := func(row []string, n int) string {
+		if n < 0 || n >= len(row) {
+			return ""
+		}
+		return strings.TrimSpace(row[n])
+	}
+
+	recs := make([]record, 0, len(rows)-1)
+	for _, row := range rows[1:] {
+		r := record{
+			Date:        cell(row, cols[0]),
+			Description: cell(row, cols[1]),
+			Amount:      cell(row, cols[2]),
+			Debit:       cell(row, cols[3]),
+			Credit:      cell(row, cols[4]),
+			Account:     cell(row, cols[5]),
+			Category:    cell(row, cols[6]),
+		}
+		if r.Date == "" {
+			// blank and summary rows
+			continue
+		}
+		recs = append(recs, r)
+	}
+
+	return recs, nil
+}
+
+func (i *Importer) recordsFromLines(lines []string) []record {
+	match := &utilregexp.Match[any]{Regexp: i.line}
+
+	var recs []record
+	for _, l := range lines {
+		if !i.line.MatchString(l) {
+			continue
+		}
+
+		f := utilregexp.ExtractFieldsWithMatch(l, match)
+		recs = append(recs, record{
+			Date:        f["date"],
+			Description: strings.TrimSpace(f["description"]),
+			Amount:      f["value"],
+			Account:     f["account"],
+		})
+	}
+
+	return recs
+}
+
+func (i *Importer) trxFromRecord(r record, defaultAccount, code string) (*banktypes.TrxInfo, error) {
+	date, err := i.parseDate(r.Date)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		value   float64
+		trxType banktypes.TrxType
+	)
+	switch {
+	case r.Amount != "":
+		value, err = parseAmount(r.Amount, i.cfg.DecimalSeparator)
+		if err != nil {
+			return nil, err
+		}
+		trxType = banktypes.Income
+		if value < 0 {
+			trxType = banktypes.Expense
+			value = -value
+		}
+
+	case r.Debit != "":
+		value, err = parseAmount(r.Debit, i.cfg.DecimalSeparator)
+		trxType = banktypes.Expense
+		if value < 0 {
+			value = -value
+		}
+
+	case r.Credit != "":
+		value, err = parseAmount(r.Credit, i.cfg.DecimalSeparator)
+		trxType = banktypes.Income
+
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if value == 0 {
+		return nil, nil
+	}
+
+	account := r.Account
+	if account == "" {
+		account = defaultAccount
+	}
+
+	if code == "" {
+		code = defaultCurrency
+	}
+
+	action := "abono"
+	if trxType == banktypes.Expense {
+		action = "pago"
+	}
+
+	return &banktypes.TrxInfo{
+		Date:        date,
+		Bank:        i,
+		Action:      action,
+		Description: r.Description,
+		Account:     account,
+		Value: currency.Amount{
+			Code:   code,
+			Number: value,
+		},
+		Type:     trxType,
+		Category: r.Category,
+	}, nil
+}
+
+func (i *Importer) parseDate(s string) (time.Time, error) {
+	if i.cfg.Format == FormatOFX {
+		return parseOFXDate(s, i.loc)
+	}
+
+	layout := i.cfg.DateLayout
+	if layout == "" {
+		layout = defaultDateLayout
+	}
+
+	t, err := time.ParseInLocation(layout, s, i.loc)
+	if err == nil {
+		return t, nil
+	}
+
+	// spreadsheets usually store dates as serial numbers
+	if serial, ok := parseExcelSerial(s); ok {
+		y, m, d := excelEpoch.AddDate(0, 0, serial).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, i.loc), nil
+	}
+
+	return time.Time{}, errs.New("date %q does not match layout %q", s, layout)
+}
+
+var excelEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// maxExcelSerial is a serial date in 2173, larger numbers are not dates.
+const maxExcelSerial = 100000
+
+var excelSerialExp = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+
+// parseExcelSerial returns the days since excelEpoch in s, which should be only
+// a number, such as 44929 or 44929.5 for a time on the same day.
+func parseExcelSerial(s string) (int, bool) {
+	s = strings.TrimSpace(s)
+	if !excelSerialExp.MatchString(s) {
+		return 0, false
+	}
+
+	serial, err := strconv.ParseFloat(s, 64)
+	if err != nil || serial < 1 || serial > maxExcelSerial {
+		return 0, false
+	}
+
+	return int(serial), true
+}
+
+func lastDigits(s string, n int) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+
+	if len(digits) > n {
+		return digits[len(digits)-n:]
+	}
+	return digits
+}
@@ -0,0 +1,181 @@
+package statement
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+)
+
+func Test_ImportCSV(t *testing.T) {
+	importer, err := New(Config{
+		Name:    "Banco",
+		Senders: []string{"extractos@banco.com"},
+		Format:  FormatCSV,
+		Columns: Columns{
+			Date:        "Fecha",
+			Description: "Descripción",
+			Debit:       "Débito",
+			Credit:      "Crédito",
+		},
+		SkipRows:         1,
+		DateLayout:       "02/01/2006",
+		DecimalSeparator: ",",
+		Account:          "1234",
+	}, time.UTC)
+	require.NoError(t, err)
+
+	data := []byte("Extracto de cuenta;;;\n" +
+		"Fecha;Descripción;Débito;Crédito\n" +
+		"03/01/2023;COMPRA EXITO;23.050,00;\n" +
+		"04/01/2023;ABONO NOMINA;;1.500.000,50\n" +
+		";TOTAL;23.050,00;1.500.000,50\n")
+
+	assert.True(t, importer.ComesFrom([]string{"extractos@banco.com"}))
+	assert.True(t, importer.AcceptsAttachment(banktypes.Attachment{Filename: "extracto.csv"}))
+	assert.False(t, importer.AcceptsAttachment(banktypes.Attachment{Filename: "extracto.pdf"}))
+
+	trxs, err := importer.Import(data)
+	require.NoError(t, err)
+	require.Len(t, trxs, 2)
+
+	assert.Equal(t, banktypes.Expense, trxs[0].Type)
+	assert.Equal(t, "COMPRA EXITO", trxs[0].Description)
+	assert.Equal(t, 23050.0, trxs[0].Value.Number)
+	assert.Equal(t, "1234", trxs[0].Account)
+	assert.Equal(t, time.Date(2023, time.January, 3, 0, 0, 0, 0, time.UTC), trxs[0].Date)
+
+	assert.Equal(t, banktypes.Income, trxs[1].Type)
+	assert.Equal(t, 1500000.5, trxs[1].Value.Number)
+}
+
+func Test_ImportXLSX(t *testing.T) {
+	importer, err := New(Config{
+		Name:   "Banco",
+		Format: FormatXLSX,
+		Columns: Columns{
+			Date:        "Date",
+			Description: "Description",
+			Amount:      "Amount",
+		},
+	}, time.UTC)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"xl/sharedStrings.xml": `<sst><si><t>Date</t></si><si><t>Description</t></si>` +
+			`<si><t>Amount</t></si><si><r><t>RAPPI </t></r><r><t>COLOMBIA</t></r></si></sst>`,
+		"xl/worksheets/sheet1.xml": `<worksheet><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="s"><v>2</v></c></row>` +
+			`<row r="2"><c r="A2"><v>44930</v></c><c r="B2" t="s"><v>3</v></c><c r="C2"><v>-23050</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	trxs, err := importer.Import(buf.Bytes())
+	require.NoError(t, err)
+	require.Len(t, trxs, 1)
+
+	assert.Equal(t, banktypes.Expense, trxs[0].Type)
+	assert.Equal(t, "RAPPI COLOMBIA", trxs[0].Description)
+	assert.Equal(t, 23050.0, trxs[0].Value.Number)
+	assert.Equal(t, time.Date(2023, time.January, 4, 0, 0, 0, 0, time.UTC), trxs[0].Date)
+}
+
+func Test_NewRequiresLineGroups(t *testing.T) {
+	_, err := New(Config{
+		Name:   "Banco",
+		Format: FormatPDF,
+		Line:   `(?P<date>\d{2}/\d{2}) (?P<description>.+)`,
+	}, time.UTC)
+	assert.Error(t, err)
+}
+
+func Test_ImportOFX(t *testing.T) {
+	importer, err := New(Config{
+		Name:   "Banco",
+		Format: FormatOFX,
+	}, time.UTC)
+	require.NoError(t, err)
+
+	data := []byte(`OFXHEADER:100
+DATA:OFXSGML
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>COP
+<BANKACCTFROM><BANKID>007<ACCTID>00012345021<ACCTTYPE>SAVINGS</BANKACCTFROM>
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20230104120000[-5:COT]<TRNAMT>-23050.00<FITID>1<NAME>RAPPI RESTAURANTE</STMTTRN>
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20230105<TRNAMT>1500000<FITID>2<NAME>NOMINA<MEMO>EMPRESA SAS</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>`)
+
+	trxs, err := importer.Import(data)
+	require.NoError(t, err)
+	require.Len(t, trxs, 2)
+
+	assert.Equal(t, banktypes.Expense, trxs[0].Type)
+	assert.Equal(t, 23050.0, trxs[0].Value.Number)
+	assert.Equal(t, "5021", trxs[0].Account)
+	assert.Equal(t, time.Date(2023, time.January, 4, 0, 0, 0, 0, time.UTC), trxs[0].Date)
+
+	assert.Equal(t, banktypes.Income, trxs[1].Type)
+	assert.Equal(t, "NOMINA EMPRESA SAS", trxs[1].Description)
+}
+
+func Test_OncePassword(t *testing.T) {
+	pw := oncePassword("secreto")
+
+	assert.Equal(t, "secreto", pw())
+	// a wrong password is not retried forever
+	assert.Equal(t, "", pw())
+	assert.Equal(t, "", pw())
+}
+
+func Test_ParseDate(t *testing.T) {
+	i := &Importer{
+		cfg: Config{DateLayout: "02/01/2006"},
+		loc: time.UTC,
+	}
+
+	tests := []struct {
+		In  string
+		Out time.Time
+		Err bool
+	}{
+		{In: "03/01/2023", Out: time.Date(2023, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{In: "44929", Out: time.Date(2023, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{In: "44929.75", Out: time.Date(2023, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{In: "2023-01-03", Err: true},
+		{In: "3/1/2023 10:00", Err: true},
+		{In: "3012023", Err: true},
+		{In: "0", Err: true},
+		{In: "-44929", Err: true},
+		{In: "1,234", Err: true},
+	}
+
+	for _, tt := range tests {
+		date, err := i.parseDate(tt.In)
+		if tt.Err {
+			assert.Error(t, err, tt.In)
+			continue
+		}
+
+		require.NoError(t, err, tt.In)
+		assert.Equal(t, tt.Out, date, tt.In)
+	}
+}
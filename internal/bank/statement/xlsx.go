@@ -0,0 +1,160 @@
+package statement
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+type xlsxSharedStrings struct {
+	Items []xlsxStringItem `xml:"si"`
+}
+
+type xlsxStringItem struct {
+	Text string `xml:"t"`
+	Runs []struct {
+		Text string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (s xlsxStringItem) String() string {
+	if len(s.Runs) == 0 {
+		return s.Text
+	}
+
+	var b strings.Builder
+	for _, r := range s.Runs {
+		b.WriteString(r.Text)
+	}
+	return b.String()
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string         `xml:"r,attr"`
+			Type   string         `xml:"t,attr"`
+			Value  string         `xml:"v"`
+			Inline xlsxStringItem `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// readXLSX returns the cells of the first worksheet of a spreadsheet, only the
+// values are read, styles and formulas are ignored.
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errs.New("invalid xlsx: %w", err)
+	}
+
+	var (
+		shared xlsxSharedStrings
+		sheets []*zip.File
+	)
+	for _, f := range zr.File {
+		switch {
+		case f.Name == "xl/sharedStrings.xml":
+			if err := decodeZipXML(f, &shared); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(f.Name, "xl/worksheets/") && strings.HasSuffix(f.Name, ".xml"):
+			sheets = append(sheets, f)
+		}
+	}
+
+	if len(sheets) == 0 {
+		return nil, errs.New("xlsx has no worksheets")
+	}
+
+	sort.Slice(sheets, func(i, j int) bool {
+		return sheetNumber(sheets[i].Name) < sheetNumber(sheets[j].Name)
+	})
+
+	var sheet xlsxSheet
+	if err := decodeZipXML(sheets[0], &sheet); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]string, 0, len(sheet.Rows))
+	for _, r := range sheet.Rows {
+		var row []string
+		for n, c := range r.Cells {
+			col := columnIndex(c.Ref)
+			if col < 0 {
+				col = n
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+
+			switch c.Type {
+			case "s":
+				idx, err := strconv.Atoi(c.Value)
+				if err != nil || idx < 0 || idx >= len(shared.Items) {
+					return nil, errs.New("invalid shared string reference %q", c.Value)
+				}
+				row[col] = shared.Items[idx].String()
+			case "inlineStr":
+				row[col] = c.Inline.String()
+			default:
+				row[col] = c.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, nil
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return errs.Wrap(err)
+	}
+	defer rc.Close()
+
+	raw, err := io.ReadAll(rc)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	if err := xml.Unmarshal(raw, v); err != nil {
+		return errs.New("invalid %s: %w", f.Name, err)
+	}
+
+	return nil
+}
+
+func sheetNumber(name string) int {
+	n := strings.TrimSuffix(strings.TrimPrefix(name, "xl/worksheets/sheet"), ".xml")
+	i, err := strconv.Atoi(n)
+	if err != nil {
+		return int(^uint(0) >> 1)
+	}
+	return i
+}
+
+// columnIndex returns the zero based column of a cell reference like "AB12"
+func columnIndex(ref string) int {
+	col := 0
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		col = col*26 + int(r-'A'+1)
+		n++
+	}
+
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
@@ -0,0 +1,401 @@
+// Package configloader builds types.Config from layered sources: a JSON, YAML
+// or TOML file, environment variables and command line flags, in increasing
+// order of precedence.
+package configloader
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/zeebo/errs"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/secrets"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+var configErr = errs.Class("config")
+
+const (
+	// DefaultPath is read when no other path is given, it is fine for it to
+	// not exist
+	DefaultPath = "credentials.json"
+	// PathEnv has the path of the config file when there is no flag for it
+	PathEnv = "TOSHL_SYNC_CONFIG"
+	// EnvPrefix is the prefix of the variables that override config values,
+	// such as TOSHL_SYNC_MAIL__PASSWORD for mail.password
+	EnvPrefix = "TOSHL_SYNC_"
+
+	redacted = "********"
+)
+
+// Flags are the command line layer of the config.
+type Flags struct {
+	Path string
+	// Set are key=value overrides, where the key is the path of json names
+	// separated by dots, such as twilio.auth-token
+	Set   []string
+	Print bool
+}
+
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.Path, "config", "", "path of the config file, json, yaml or toml ("+DefaultPath+" by default)")
+	fs.Func("set", "override a config value as key.path=value, can be repeated", func(v string) error {
+		if !strings.Contains(v, "=") {
+			return errs.New("expected key=value, got %q", v)
+		}
+		f.Set = append(f.Set, v)
+		return nil
+	})
+	fs.BoolVar(&f.Print, "print-config", false, "print the effective config with secrets redacted and exit")
+}
+
+// Load reads the config from the file selected by flags or the environment,
+// and applies the environment variables and the overrides in flags on top.
+// The credentials that reference secrets are resolved.
+func Load(ctx context.Context, flags Flags) (_ types.Config, genErr error) {
+	defer func() { genErr = configErr.Wrap(genErr) }()
+
+	tree, err := readFile(flags.Path)
+	if err != nil {
+		return types.Config{}, err
+	}
+
+	keys := configKeys()
+
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if !strings.HasPrefix(name, EnvPrefix) || name == PathEnv {
+			continue
+		}
+
+		k, ok := keyByEnv(keys, name)
+		if !ok {
+			return types.Config{}, errs.New("unknown config environment variable %s", name)
+		}
+		if err := k.set(tree, value); err != nil {
+			return types.Config{}, errs.New("invalid value for %s: %w", name, err)
+		}
+	}
+
+	for _, s := range flags.Set {
+		path, value, _ := strings.Cut(s, "=")
+
+		k, ok := keys[path]
+		if !ok {
+			return types.Config{}, errs.New("unknown config key %q", path)
+		}
+		if err := k.set(tree, value); err != nil {
+			return types.Config{}, errs.New("invalid value for %s: %w", path, err)
+		}
+	}
+
+	raw, err := json.Marshal(tree)
+	if err != nil {
+		return types.Config{}, err
+	}
+
+	var cfg types.Config
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return types.Config{}, err
+	}
+
+	resolver, err := secrets.New(ctx, cfg.Secrets, cfg.Region())
+	if err != nil {
+		return types.Config{}, err
+	}
+	if err := resolver.ResolveAll(ctx, &cfg.Credentials); err != nil {
+		return types.Config{}, err
+	}
+	for i := range cfg.Statements {
+		password, err := resolver.Resolve(ctx, cfg.Statements[i].Password)
+		if err != nil {
+			return types.Config{}, errs.New("invalid password of statement %d: %w", i, err)
+		}
+		cfg.Statements[i].Password = password
+	}
+
+	return cfg, nil
+}
+
+func readFile(path string) (map[string]any, error) {
+	explicit := path != ""
+	if !explicit {
+		path = os.Getenv(PathEnv)
+		explicit = path != ""
+	}
+	if !explicit {
+		path = DefaultPath
+	}
+
+	tree := make(map[string]any)
+
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return tree, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json", "":
+		err = json.Unmarshal(raw, &tree)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &tree)
+	case ".toml":
+		err = toml.Unmarshal(raw, &tree)
+	default:
+		return nil, errs.New("unsupported config file format %q", ext)
+	}
+	if err != nil {
+		return nil, errs.New("could not parse %s: %w", path, err)
+	}
+
+	return tree, nil
+}
+
+// key is a value of the config that can be set from the environment or
+// flags.
+type key struct {
+	path []string
+	kind reflect.Kind
+}
+
+func (k key) env() string {
+	name := strings.Join(k.path, "__")
+	name = strings.ReplaceAll(name, "-", "_")
+	return EnvPrefix + strings.ToUpper(name)
+}
+
+func (k key) set(tree map[string]any, raw string) error {
+	var value any
+	switch k.kind {
+	case reflect.String:
+		value = raw
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value = b
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value = n
+	default:
+		// lists and objects are given as json
+		if err := json.Unmarshal([]byte(raw), &value); err != nil {
+			return err
+		}
+	}
+
+	node := tree
+	for _, p := range k.path[:len(k.path)-1] {
+		child, ok := node[p].(map[string]any)
+		if !ok {
+			child = make(map[string]any)
+			node[p] = child
+		}
+		node = child
+	}
+	node[k.path[len(k.path)-1]] = value
+
+	return nil
+}
+
+// configKeys returns every value of types.Config by its dotted path.
+func configKeys() map[string]key {
+	keys := make(map[string]key)
+	walkKeys(reflect.TypeOf(types.Config{}), nil, keys)
+	return keys
+}
+
+func walkKeys(t reflect.Type, path []string, keys map[string]key) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			walkKeys(ft, path, keys)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		p := append(append([]string{}, path...), name)
+		if ft.Kind() == reflect.Struct && ft != reflect.TypeOf(time.Time{}) {
+			walkKeys(ft, p, keys)
+			continue
+		}
+
+		keys[strings.Join(p, ".")] = key{
+			path: p,
+			kind: ft.Kind(),
+		}
+	}
+}
+
+// redact replaces the secrets in v, the json form of a value of type t,
+// including the ones in slices and maps. Every string in v is a secret when
+// secret is set.
+func redact(t reflect.Type, v any, secret bool) any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		node, ok := v.(map[string]any)
+		if !ok || t == reflect.TypeOf(time.Time{}) {
+			return v
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+
+			isSecret := secret || f.Tag.Get("secret") == "true"
+			if f.Anonymous && name == "" {
+				redact(f.Type, node, isSecret)
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+
+			if child, ok := node[name]; ok {
+				node[name] = redact(f.Type, child, isSecret)
+			}
+		}
+
+	case reflect.Slice, reflect.Array:
+		if list, ok := v.([]any); ok {
+			for n, e := range list {
+				list[n] = redact(t.Elem(), e, secret)
+			}
+		}
+
+	case reflect.Map:
+		if m, ok := v.(map[string]any); ok {
+			for k, e := range m {
+				m[k] = redact(t.Elem(), e, secret)
+			}
+		}
+
+	case reflect.String:
+		if s, ok := v.(string); ok && secret && s != "" {
+			return redacted
+		}
+	}
+
+	return v
+}
+
+func keyByEnv(keys map[string]key, env string) (key, bool) {
+	for _, k := range keys {
+		if k.env() == env {
+			return k, true
+		}
+	}
+
+	return key{}, false
+}
+
+// Validate checks that cfg has everything a sync needs before it starts.
+func Validate(cfg types.Config) error {
+	var group errs.Group
+
+	if cfg.Timezone == "" {
+		group.Add(errs.New("timezone is required"))
+	} else if _, err := time.LoadLocation(cfg.Timezone); err != nil {
+		group.Add(errs.New("invalid timezone %q: %w", cfg.Timezone, err))
+	}
+
+	required := []struct {
+		name, value string
+	}{
+		{"mail.addr", cfg.Mail.Address},
+		{"mail.username", cfg.Mail.Username},
+		{"mail.password", cfg.Mail.Password},
+		{"twilio.account-sid", cfg.Twilio.AccountSid},
+		{"twilio.auth-token", cfg.Twilio.AuthToken},
+		{"twilio.from-number", cfg.Twilio.FromNumber},
+	}
+	for _, r := range required {
+		if r.value == "" {
+			group.Add(errs.New("%s is required", r.name))
+		}
+	}
+
+	// the mailboxes are only needed by the default dispositions
+	if cfg.Dispositions.Success == nil && cfg.SuccessMailbox == "" {
+		group.Add(errs.New("success_mailbox is required unless dispositions.success is set"))
+	}
+	if cfg.Dispositions.ParseError == nil && cfg.ParseErrorMailbox == "" {
+		group.Add(errs.New("parse_error_mailbox is required unless dispositions.parse_error is set"))
+	}
+
+	return configErr.Wrap(group.Err())
+}
+
+// WriteRedacted writes cfg as json, with the secrets replaced.
+func WriteRedacted(out io.Writer, cfg types.Config) error {
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+
+	var tree map[string]any
+	if err := json.Unmarshal(raw, &tree); err != nil {
+		return err
+	}
+
+	redact(reflect.TypeOf(cfg), tree, false)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(tree); err != nil {
+		return err
+	}
+
+	_, err = buf.WriteTo(out)
+	return err
+}
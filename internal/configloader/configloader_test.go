@@ -0,0 +1,152 @@
+package configloader
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/statement"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+func Test_Load(t *testing.T) {
+	dir := t.TempDir()
+
+	files := map[string]string{
+		"config.json": `{"timezone": "America/Bogota", "mail": {"addr": "imap.gmail.com:993", "password": "from-file"}}`,
+		"config.yaml": "timezone: America/Bogota\nmail:\n  addr: imap.gmail.com:993\n  password: from-file\n",
+		"config.toml": "timezone = \"America/Bogota\"\n[mail]\naddr = \"imap.gmail.com:993\"\npassword = \"from-file\"\n",
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+			t.Setenv("TOSHL_SYNC_MAIL__PASSWORD", "from-env")
+			t.Setenv("TOSHL_SYNC_TWILIO__AUTH_TOKEN", "token")
+			t.Setenv("TOSHL_SYNC_CREATE_MAILBOXES", "true")
+
+			cfg, err := Load(context.Background(), Flags{
+				Path: path,
+				Set:  []string{"aws.region=us-west-2", "twilio.auth-token=from-flag"},
+			})
+			require.NoError(t, err)
+
+			assert.Equal(t, "America/Bogota", cfg.Timezone)
+			assert.Equal(t, "imap.gmail.com:993", cfg.Mail.Address)
+			assert.Equal(t, "from-env", cfg.Mail.Password)
+			assert.Equal(t, "from-flag", cfg.Twilio.AuthToken)
+			assert.True(t, cfg.CreateMailboxes)
+			assert.Equal(t, "us-west-2", cfg.AWS.Region)
+		})
+	}
+}
+
+func Test_LoadStatementPasswords(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "config.json")
+	content := `{"statements": [{"name": "plain", "password": "1234"}, {"name": "env", "password": "env:TEST_PDF_PASSWORD"}]}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	t.Setenv("TEST_PDF_PASSWORD", "5678")
+
+	cfg, err := Load(context.Background(), Flags{Path: path})
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Statements, 2)
+	assert.Equal(t, "1234", cfg.Statements[0].Password)
+	assert.Equal(t, "5678", cfg.Statements[1].Password)
+
+	content = `{"statements": [{"name": "env", "password": "env:TEST_MISSING_PDF_PASSWORD"}]}`
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	_, err = Load(context.Background(), Flags{Path: path})
+	assert.ErrorContains(t, err, "statement 0")
+}
+
+func Test_LoadErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	// a path that was asked for has to exist
+	_, err := Load(context.Background(), Flags{Path: filepath.Join(dir, "missing.json")})
+	assert.Error(t, err)
+
+	path := filepath.Join(dir, "config.json")
+	require.NoError(t, os.WriteFile(path, []byte("{}"), 0o600))
+	t.Setenv(PathEnv, path)
+
+	_, err = Load(context.Background(), Flags{Set: []string{"mail.nope=1"}})
+	assert.ErrorContains(t, err, "unknown config key")
+
+	_, err = Load(context.Background(), Flags{Set: []string{"create_mailboxes=maybe"}})
+	assert.ErrorContains(t, err, "invalid value")
+}
+
+func Test_ValidateAndRedact(t *testing.T) {
+	cfg := types.Config{
+		Timezone: "Nowhere/Atlantis",
+	}
+
+	err := Validate(cfg)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid timezone")
+	assert.Contains(t, err.Error(), "mail.password is required")
+	assert.Contains(t, err.Error(), "success_mailbox is required")
+
+	cfg.Mail.Password = "hunter2"
+	var buf bytes.Buffer
+	require.NoError(t, WriteRedacted(&buf, cfg))
+	assert.NotContains(t, buf.String(), "hunter2")
+	assert.Contains(t, buf.String(), `"password": "********"`)
+	assert.Contains(t, buf.String(), `"timezone": "Nowhere/Atlantis"`)
+
+	// secrets in slices are redacted as well
+	cfg.Statements = []statement.Config{
+		{Name: "Bancolombia", Password: "12345678"},
+		{Name: "Nu"},
+	}
+	buf.Reset()
+	require.NoError(t, WriteRedacted(&buf, cfg))
+	assert.NotContains(t, buf.String(), "12345678")
+	assert.Contains(t, buf.String(), `"name": "Bancolombia"`)
+	assert.Equal(t, 2, strings.Count(buf.String(), `"password": "********"`))
+}
+
+func Test_Redact(t *testing.T) {
+	type creds struct {
+		User     string `json:"user"`
+		Password string `json:"password" secret:"true"`
+	}
+	type config struct {
+		Accounts map[string]creds `json:"accounts"`
+		Tokens   []string         `json:"tokens" secret:"true"`
+		Empty    string           `json:"empty" secret:"true"`
+	}
+
+	tree := map[string]any{
+		"accounts": map[string]any{
+			"main": map[string]any{"user": "me", "password": "hunter2"},
+		},
+		"tokens": []any{"a", "b"},
+		"empty":  "",
+	}
+
+	redact(reflect.TypeOf(config{}), tree, false)
+
+	assert.Equal(t, map[string]any{
+		"accounts": map[string]any{
+			"main": map[string]any{"user": "me", "password": redacted},
+		},
+		"tokens": []any{redacted, redacted},
+		"empty":  "",
+	}, tree)
+}
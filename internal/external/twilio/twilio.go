@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	"github.com/twilio/twilio-go"
+	twilioClient "github.com/twilio/twilio-go/client"
 	twilioApi "github.com/twilio/twilio-go/rest/api/v2010"
 	"github.com/zeebo/errs"
 
@@ -65,3 +66,23 @@ func (c *Client) SendMessage(toNumber, sms string) (_ twiliotypes.APIResponse, g
 
 	return r, nil
 }
+
+// CheckCredentials fetches the account of the client, which fails when the
+// credentials are wrong, without sending anything.
+func (c *Client) CheckCredentials() error {
+	c.init()
+
+	if c.AccountSid == "" || c.Token == "" {
+		return twilioErr.New("account sid and auth token should not be empty")
+	}
+
+	_, err := c.client.Api.FetchAccount(c.AccountSid)
+	return twilioErr.Wrap(err)
+}
+
+// ValidateSignature checks the X-Twilio-Signature of a webhook request made
+// by Twilio to url with the given form params.
+func (c *Client) ValidateSignature(url string, params map[string]string, signature string) bool {
+	v := twilioClient.NewRequestValidator(c.Token)
+	return v.Validate(url, params, signature)
+}
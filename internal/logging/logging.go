@@ -7,6 +7,7 @@ import (
 	"sync"
 	"time"
 
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -98,11 +99,20 @@ func FromContext(ctx context.Context) *Logger {
 		return New()
 	}
 
-	if l, ok := ctx.Value(LoggerCtxKey{}).(*Logger); ok {
-		return l
+	l, ok := ctx.Value(LoggerCtxKey{}).(*Logger)
+	if !ok {
+		l = New()
 	}
 
-	return New()
+	// logs are correlated with the trace of the operation, when there is one
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		l = l.With(
+			zap.String("trace_id", sc.TraceID().String()),
+			zap.String("span_id", sc.SpanID().String()),
+		)
+	}
+
+	return l
 }
 
 func (l Logger) DPanic(msg string, fields ...Field) {
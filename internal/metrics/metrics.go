@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/zeebo/errs"
+)
+
+const namespace = "toshl_sync"
+
+// Registry has every metric of the sync, it is used instead of the default
+// registry so that only these are pushed in one-shot mode.
+var Registry = prometheus.NewRegistry()
+
+var (
+	MessagesFetched = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_fetched_total",
+		Help:      "Messages fetched from the mailbox, by result.",
+	}, []string{"result"})
+
+	MessagesIgnored = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_ignored_total",
+		Help:      "Messages that no bank or statement importer handles.",
+	})
+
+	ParseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "parse_failures_total",
+		Help:      "Messages of a bank that could not be parsed, by the regexp they matched.",
+	}, []string{"bank", "regexp"})
+
+	EntriesCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entries_created_total",
+		Help:      "Entries created in accounting.",
+	}, []string{"bank", "backend"})
+
+	EntryFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "entry_failures_total",
+		Help:      "Transactions that could not be registered in accounting.",
+	}, []string{"bank"})
+
+	NotificationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "notification_failures_total",
+		Help:      "Notifications to users that could not be sent.",
+	}, []string{"channel"})
+
+	ToshlLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "toshl_request_duration_seconds",
+		Help:      "Duration of the requests to Toshl.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"operation"})
+
+	IMAPLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "imap_command_duration_seconds",
+		Help:      "Duration of the IMAP commands.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	}, []string{"command"})
+
+	LastRunTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_timestamp_seconds",
+		Help:      "Time when the last run finished.",
+	})
+
+	LastRunDuration = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "last_run_duration_seconds",
+		Help:      "Duration of the last run.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		MessagesFetched,
+		MessagesIgnored,
+		ParseFailures,
+		EntriesCreated,
+		EntryFailures,
+		NotificationFailures,
+		ToshlLatency,
+		IMAPLatency,
+		LastRunTimestamp,
+		LastRunDuration,
+	)
+}
+
+// ObserveSince records the time elapsed since start, it is meant to be
+// deferred:
+//
+//	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("fetch"), time.Now())
+func ObserveSince(o prometheus.Observer, start time.Time) {
+	o.Observe(time.Since(start).Seconds())
+}
+
+// Handler serves the metrics for daemon mode, along with the Go runtime and
+// process metrics.
+func Handler() http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return promhttp.HandlerFor(prometheus.Gatherers{Registry, reg}, promhttp.HandlerOpts{})
+}
+
+// Config is how the metrics leave one-shot executions, which end before they
+// could be scraped.
+type Config struct {
+	// PushURL is the address of a Prometheus Pushgateway
+	PushURL string `json:"push_url"`
+	// Job is the job name used when pushing, toshl-sync by default
+	Job string `json:"job"`
+	// Textfile is written in the text format, such as for the textfile
+	// collector of node_exporter
+	Textfile string `json:"textfile"`
+}
+
+// Export pushes or writes the metrics as selected in cfg, it does nothing when
+// neither is set.
+func Export(ctx context.Context, cfg Config) error {
+	var group errs.Group
+
+	if cfg.PushURL != "" {
+		job := cfg.Job
+		if job == "" {
+			job = "toshl-sync"
+		}
+
+		err := push.New(cfg.PushURL, job).Gatherer(Registry).PushContext(ctx)
+		if err != nil {
+			group.Add(errs.New("could not push metrics: %w", err))
+		}
+	}
+
+	if cfg.Textfile != "" {
+		if err := prometheus.WriteToTextfile(cfg.Textfile, Registry); err != nil {
+			group.Add(errs.New("could not write metrics textfile: %w", err))
+		}
+	}
+
+	return group.Err()
+}
@@ -0,0 +1,116 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/zeebo/errs"
+)
+
+// AgeProvider reads secrets from JSON objects encrypted with age, references
+// are path#key.
+type AgeProvider struct {
+	Identities []age.Identity
+
+	mu    sync.Mutex
+	files map[string]map[string]string
+}
+
+func (p *AgeProvider) Get(_ context.Context, ref string) (string, error) {
+	path, key, ok := strings.Cut(ref, "#")
+	if !ok || key == "" {
+		return "", errs.New("expected path#key")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	secrets, ok := p.files[path]
+	if !ok {
+		var err error
+		secrets, err = p.decrypt(path)
+		if err != nil {
+			return "", err
+		}
+
+		if p.files == nil {
+			p.files = make(map[string]map[string]string)
+		}
+		p.files[path] = secrets
+	}
+
+	secret, ok := secrets[key]
+	if !ok {
+		return "", errs.New("there is no %q in %s", key, path)
+	}
+
+	return secret, nil
+}
+
+func (p *AgeProvider) decrypt(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+	defer f.Close()
+
+	in := bufio.NewReader(f)
+	var src io.Reader = in
+	if start, _ := in.Peek(len(armor.Header)); string(start) == armor.Header {
+		src = armor.NewReader(in)
+	}
+
+	plain, err := age.Decrypt(src, p.Identities...)
+	if err != nil {
+		return nil, errs.New("could not decrypt %s: %w", path, err)
+	}
+
+	var secrets map[string]string
+	if err := json.NewDecoder(plain).Decode(&secrets); err != nil {
+		return nil, errs.New("%s should be a json object of strings: %w", path, err)
+	}
+
+	return secrets, nil
+}
+
+// ageIdentities parses the identities in cfg, which can be references to env
+// variables or files.
+func (r *Resolver) ageIdentities(ctx context.Context, cfg Config) ([]age.Identity, error) {
+	var identities []age.Identity
+
+	if cfg.AgeIdentity != "" {
+		raw, err := r.Resolve(ctx, cfg.AgeIdentity)
+		if err != nil {
+			return nil, err
+		}
+
+		ids, err := age.ParseIdentities(bytes.NewBufferString(raw))
+		if err != nil {
+			return nil, secretsErr.New("invalid age identity: %w", err)
+		}
+		identities = append(identities, ids...)
+	}
+
+	if cfg.AgePassphrase != "" {
+		passphrase, err := r.Resolve(ctx, cfg.AgePassphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, secretsErr.Wrap(err)
+		}
+		identities = append(identities, id)
+	}
+
+	return identities, nil
+}
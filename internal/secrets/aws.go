@@ -0,0 +1,86 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/zeebo/errs"
+)
+
+// awsProvider reads secrets from AWS Secrets Manager and SSM Parameter Store,
+// its clients are only created when a reference needs them.
+type awsProvider struct {
+	Region string
+
+	once    sync.Once
+	cfg     aws.Config
+	loadErr error
+}
+
+func (p *awsProvider) config(ctx context.Context) (aws.Config, error) {
+	p.once.Do(func() {
+		p.cfg, p.loadErr = config.LoadDefaultConfig(ctx, config.WithRegion(p.Region))
+	})
+
+	return p.cfg, errs.Wrap(p.loadErr)
+}
+
+// getSecret reads a secret of Secrets Manager, references are the secret ID,
+// followed by #key for a value of a secret with a json object.
+func (p *awsProvider) getSecret(ctx context.Context, ref string) (string, error) {
+	cfg, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	id, key, hasKey := strings.Cut(ref, "#")
+
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(id),
+	})
+	if err != nil {
+		return "", errs.Wrap(err)
+	}
+
+	secret := aws.ToString(out.SecretString)
+	if !hasKey {
+		return secret, nil
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal([]byte(secret), &values); err != nil {
+		return "", errs.New("secret %s is not a json object: %w", id, err)
+	}
+
+	v, ok := values[key]
+	if !ok {
+		return "", errs.New("secret %s has no %q", id, key)
+	}
+
+	return v, nil
+}
+
+// getParameter reads a parameter of SSM, decrypting it when it is a
+// SecureString.
+func (p *awsProvider) getParameter(ctx context.Context, name string) (string, error) {
+	cfg, err := p.config(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	out, err := ssm.NewFromConfig(cfg).GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", errs.Wrap(err)
+	}
+
+	return aws.ToString(out.Parameter.Value), nil
+}
@@ -0,0 +1,202 @@
+// Package secrets resolves references to secrets in config values, such as
+// env:MAIL_PASSWORD or ssm:/toshl/token, so that the secrets themselves do not
+// need to be in the config.
+package secrets
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zeebo/errs"
+)
+
+var secretsErr = errs.Class("secrets")
+
+const (
+	SchemeEnv            = "env"
+	SchemeFile           = "file"
+	SchemeAge            = "age"
+	SchemeSecretsManager = "awssm"
+	SchemeSSM            = "ssm"
+)
+
+// Provider returns the secret for a reference, without its scheme.
+type Provider interface {
+	Get(ctx context.Context, ref string) (string, error)
+}
+
+type ProviderFunc func(ctx context.Context, ref string) (string, error)
+
+func (f ProviderFunc) Get(ctx context.Context, ref string) (string, error) {
+	return f(ctx, ref)
+}
+
+type Config struct {
+	// AgeIdentity decrypts the files of age: references, it is an identity
+	// such as AGE-SECRET-KEY-1..., or a reference to an identity file
+	AgeIdentity string `json:"age_identity" secret:"true"`
+	// AgePassphrase is used for the files encrypted with a passphrase
+	AgePassphrase string `json:"age_passphrase" secret:"true"`
+}
+
+// Resolver resolves the values with the scheme of one of its providers, and
+// leaves the rest as they are. Resolved secrets are cached.
+type Resolver struct {
+	Providers map[string]Provider
+
+	mu    sync.Mutex
+	cache map[string]string
+}
+
+// New returns a resolver with every provider, the AWS ones use region.
+func New(ctx context.Context, cfg Config, region string) (*Resolver, error) {
+	r := &Resolver{
+		Providers: map[string]Provider{
+			SchemeEnv:  ProviderFunc(getEnv),
+			SchemeFile: ProviderFunc(getFile),
+		},
+	}
+
+	identities, err := r.ageIdentities(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if len(identities) > 0 {
+		r.Providers[SchemeAge] = &AgeProvider{Identities: identities}
+	}
+
+	aws := &awsProvider{Region: region}
+	r.Providers[SchemeSecretsManager] = ProviderFunc(aws.getSecret)
+	r.Providers[SchemeSSM] = ProviderFunc(aws.getParameter)
+
+	return r, nil
+}
+
+// Restrict returns a resolver that only resolves the references with one of
+// schemes, the references with the other schemes of r are rejected. It is
+// for values that come from users, which should not read the environment or
+// the files of the host.
+func (r *Resolver) Restrict(schemes ...string) *Resolver {
+	restricted := &Resolver{Providers: make(map[string]Provider, len(r.Providers))}
+	for scheme, p := range r.Providers {
+		if slices.Contains(schemes, scheme) {
+			restricted.Providers[scheme] = p
+			continue
+		}
+
+		scheme := scheme
+		restricted.Providers[scheme] = ProviderFunc(func(context.Context, string) (string, error) {
+			return "", errs.New("%s references are not allowed here", scheme)
+		})
+	}
+
+	return restricted
+}
+
+func (r *Resolver) parse(value string) (Provider, string, bool) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok {
+		return nil, "", false
+	}
+
+	p, ok := r.Providers[scheme]
+	return p, ref, ok
+}
+
+// IsReference tells whether value references a secret.
+func (r *Resolver) IsReference(value string) bool {
+	_, _, ok := r.parse(value)
+	return ok
+}
+
+// Resolve returns the secret referenced by value, or value itself when it is
+// not a reference.
+func (r *Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	p, ref, ok := r.parse(value)
+	if !ok {
+		return value, nil
+	}
+
+	r.mu.Lock()
+	secret, cached := r.cache[value]
+	r.mu.Unlock()
+	if cached {
+		return secret, nil
+	}
+
+	secret, err := p.Get(ctx, ref)
+	if err != nil {
+		scheme, _, _ := strings.Cut(value, ":")
+		return "", secretsErr.New("could not resolve %s reference %q: %w", scheme, ref, err)
+	}
+
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = make(map[string]string)
+	}
+	r.cache[value] = secret
+	r.mu.Unlock()
+
+	return secret, nil
+}
+
+// ResolveAll replaces the references in every string field of the struct
+// that v points to, including the nested ones.
+func (r *Resolver) ResolveAll(ctx context.Context, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return secretsErr.New("expected a pointer to a struct, got %T", v)
+	}
+
+	return r.resolveValue(ctx, rv.Elem())
+}
+
+func (r *Resolver) resolveValue(ctx context.Context, v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			if err := r.resolveValue(ctx, v.Field(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Pointer:
+		if !v.IsNil() {
+			return r.resolveValue(ctx, v.Elem())
+		}
+
+	case reflect.String:
+		secret, err := r.Resolve(ctx, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(secret)
+	}
+
+	return nil
+}
+
+func getEnv(_ context.Context, name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", errs.New("environment variable %s is not set", name)
+	}
+
+	return v, nil
+}
+
+func getFile(_ context.Context, path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", errs.Wrap(err)
+	}
+
+	return strings.TrimRight(string(raw), "\r\n"), nil
+}
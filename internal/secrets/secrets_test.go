@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Resolve(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	identity, err := age.GenerateX25519Identity()
+	require.NoError(t, err)
+
+	var encrypted bytes.Buffer
+	w, err := age.Encrypt(&encrypted, identity.Recipient())
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`{"toshl-token": "from-age"}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	agePath := filepath.Join(dir, "secrets.json.age")
+	require.NoError(t, os.WriteFile(agePath, encrypted.Bytes(), 0o600))
+
+	tokenPath := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenPath, []byte("from-file\n"), 0o600))
+
+	t.Setenv("TEST_AGE_IDENTITY", identity.String())
+	t.Setenv("TEST_PASSWORD", "from-env")
+
+	r, err := New(ctx, Config{AgeIdentity: "env:TEST_AGE_IDENTITY"}, "us-east-1")
+	require.NoError(t, err)
+
+	cases := map[string]string{
+		"env:TEST_PASSWORD":               "from-env",
+		"file:" + tokenPath:               "from-file",
+		"age:" + agePath + "#toshl-token": "from-age",
+		"plain-token":                     "plain-token",
+		"imap.gmail.com:993":              "imap.gmail.com:993",
+	}
+	for value, expected := range cases {
+		secret, err := r.Resolve(ctx, value)
+		require.NoError(t, err, value)
+		assert.Equal(t, expected, secret, value)
+	}
+
+	_, err = r.Resolve(ctx, "env:TEST_MISSING")
+	assert.Error(t, err)
+
+	_, err = r.Resolve(ctx, "age:"+agePath+"#missing")
+	assert.Error(t, err)
+
+	creds := struct {
+		Password string
+		Nested   struct{ Token *string }
+	}{
+		Password: "env:TEST_PASSWORD",
+	}
+	token := "file:" + tokenPath
+	creds.Nested.Token = &token
+
+	require.NoError(t, r.ResolveAll(ctx, &creds))
+	assert.Equal(t, "from-env", creds.Password)
+	assert.Equal(t, "from-file", *creds.Nested.Token)
+}
+
+func Test_Restrict(t *testing.T) {
+	ctx := context.Background()
+
+	t.Setenv("TEST_PASSWORD", "from-env")
+
+	r, err := New(ctx, Config{}, "us-east-1")
+	require.NoError(t, err)
+
+	restricted := r.Restrict(SchemeSecretsManager, SchemeSSM, SchemeAge)
+
+	for _, value := range []string{"env:TEST_PASSWORD", "file:/etc/passwd"} {
+		_, err := restricted.Resolve(ctx, value)
+		assert.Error(t, err, value)
+	}
+
+	secret, err := restricted.Resolve(ctx, "plain-token")
+	require.NoError(t, err)
+	assert.Equal(t, "plain-token", secret)
+
+	assert.True(t, restricted.IsReference("ssm:/toshl/token"))
+
+	// the original resolver is not changed
+	secret, err = r.Resolve(ctx, "env:TEST_PASSWORD")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", secret)
+}
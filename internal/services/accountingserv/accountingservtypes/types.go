@@ -18,9 +18,50 @@ type Category struct {
 }
 
 type CreateEntryInput struct {
+	Date        time.Time
+	Currency    currency.Amount
+	Description string
+	// Notes are kept by the backends that have them, Toshl adds them to the
+	// description
+	Notes      string
+	AccountID  string
+	CategoryID string
+	// Metadata is kept by the backends that support it, such as plain-text
+	// journals
+	Metadata map[string]string
+}
+
+type Entry struct {
+	ID          string
 	Date        time.Time
 	Currency    currency.Amount
 	Description string
 	AccountID   string
 	CategoryID  string
 }
+
+const (
+	BackendToshl     = "toshl"
+	BackendFirefly   = "firefly"
+	BackendActual    = "actual"
+	BackendLedger    = "ledger"
+	BackendBeancount = "beancount"
+	BackendCSV       = "csv"
+	BackendJSON      = "json"
+)
+
+// BackendConfig selects where a user's entries are registered, Toshl is used
+// when Type is empty.
+type BackendConfig struct {
+	Type string `json:"type" dynamodbav:"Type"`
+	// URL and Token are used by the backends with an HTTP API
+	URL   string `json:"url"   dynamodbav:"URL"`
+	Token string `json:"token" dynamodbav:"Token"`
+	// BudgetID is the sync id of an Actual Budget budget
+	BudgetID string `json:"budget_id" dynamodbav:"BudgetID"`
+	// Currency is the code of the amounts of an Actual Budget budget, COP
+	// when it is empty
+	Currency string `json:"currency" dynamodbav:"Currency"`
+	// Path is the file written by the local backends
+	Path string `json:"path" dynamodbav:"Path"`
+}
@@ -0,0 +1,263 @@
+package accountingserv
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+var actualErr = errs.Class("actual")
+
+// ActualService registers entries in an Actual Budget budget through
+// actual-http-api (https://github.com/jhonderson/actual-http-api), the token
+// is the API key of that server.
+type ActualService struct {
+	URL      string
+	BudgetID string
+	// Currency is the code of the budget amounts, since Actual does not keep
+	// one
+	Currency string
+	Client   httpClient
+}
+
+func (r *ActualService) api(token string) jsonAPI {
+	return jsonAPI{
+		BaseURL: r.URL,
+		Client:  r.Client,
+		Header: http.Header{
+			"x-api-key": []string{token},
+		},
+	}
+}
+
+func (r *ActualService) path(p string) string {
+	return "/v1/budgets/" + url.PathEscape(r.BudgetID) + p
+}
+
+type actualAccount struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Closed bool   `json:"closed"`
+}
+
+type actualCategory struct {
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	GroupID  string `json:"group_id"`
+	IsIncome bool   `json:"is_income"`
+}
+
+type actualCategoryGroup struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	IsIncome bool   `json:"is_income"`
+}
+
+type actualTransaction struct {
+	ID        string `json:"id,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Date      string `json:"date"`
+	Amount    int64  `json:"amount"`
+	PayeeName string `json:"payee_name,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+	Category  string `json:"category,omitempty"`
+}
+
+func (r *ActualService) GetAccounts(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Account, genErr error) {
+	defer func() { genErr = actualErr.Wrap(genErr) }()
+
+	var resp struct {
+		Data []actualAccount `json:"data"`
+	}
+	if err := r.api(token).do(ctx, http.MethodGet, r.path("/accounts"), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	as := make([]accountingservtypes.Account, 0, len(resp.Data))
+	for _, a := range resp.Data {
+		if a.Closed {
+			continue
+		}
+
+		as = append(as, accountingservtypes.Account{
+			ID:   a.ID,
+			Name: a.Name,
+		})
+	}
+
+	return as, nil
+}
+
+func actualCategoryType(isIncome bool) string {
+	if isIncome {
+		return Income
+	}
+	return Expense
+}
+
+func (r *ActualService) GetCategories(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Category, genErr error) {
+	defer func() { genErr = actualErr.Wrap(genErr) }()
+
+	var resp struct {
+		Data []actualCategory `json:"data"`
+	}
+	if err := r.api(token).do(ctx, http.MethodGet, r.path("/categories"), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	cs := make([]accountingservtypes.Category, 0, len(resp.Data))
+	for _, c := range resp.Data {
+		cs = append(cs, accountingservtypes.Category{
+			ID:   c.ID,
+			Name: c.Name,
+			Type: actualCategoryType(c.IsIncome),
+		})
+	}
+
+	return cs, nil
+}
+
+// CreateCategory creates the category in the first group of the budget that
+// matches its type, since Actual does not allow categories without a group.
+func (r *ActualService) CreateCategory(
+	ctx context.Context, token, catType, category string,
+) (_ accountingservtypes.Category, genErr error) {
+	defer func() { genErr = actualErr.Wrap(genErr) }()
+
+	api := r.api(token)
+
+	var groups struct {
+		Data []actualCategoryGroup `json:"data"`
+	}
+	if err := api.do(ctx, http.MethodGet, r.path("/categorygroups"), nil, nil, &groups); err != nil {
+		return accountingservtypes.Category{}, err
+	}
+
+	isIncome := catType == Income
+	var groupID string
+	for _, g := range groups.Data {
+		if g.IsIncome == isIncome {
+			groupID = g.ID
+			break
+		}
+	}
+	if groupID == "" {
+		return accountingservtypes.Category{}, errs.New("there is no %s category group", catType)
+	}
+
+	in := struct {
+		Category actualCategory `json:"category"`
+	}{
+		Category: actualCategory{
+			Name:     category,
+			GroupID:  groupID,
+			IsIncome: isIncome,
+		},
+	}
+
+	var resp struct {
+		Data string `json:"data"`
+	}
+	if err := api.do(ctx, http.MethodPost, r.path("/categories"), nil, in, &resp); err != nil {
+		return accountingservtypes.Category{}, err
+	}
+
+	return accountingservtypes.Category{
+		ID:   resp.Data,
+		Name: category,
+		Type: actualCategoryType(isIncome),
+	}, nil
+}
+
+func (r *ActualService) CreateEntry(
+	ctx context.Context, token string, entryInput accountingservtypes.CreateEntryInput,
+) (genErr error) {
+	defer func() { genErr = actualErr.Wrap(genErr) }()
+
+	// the amounts are registered as they are, so they have to be in the
+	// currency of the budget
+	if code := entryInput.Currency.Code; code != "" && r.Currency != "" && code != r.Currency {
+		return errs.New("entry is in %s but the budget is in %s", code, r.Currency)
+	}
+
+	const dateFormat = "2006-01-02"
+
+	// actual keeps amounts as integers in cents
+	in := struct {
+		Transaction actualTransaction `json:"transaction"`
+	}{
+		Transaction: actualTransaction{
+			Date:      entryInput.Date.Format(dateFormat),
+			Amount:    int64(math.Round(entryInput.Currency.Number * 100)),
+			PayeeName: entryInput.Description,
+			Notes:     entryInput.Notes,
+			Category:  entryInput.CategoryID,
+		},
+	}
+
+	path := r.path("/accounts/" + url.PathEscape(entryInput.AccountID) + "/transactions")
+	return r.api(token).do(ctx, http.MethodPost, path, nil, in, nil)
+}
+
+func (r *ActualService) GetEntries(
+	ctx context.Context, token string, from, to time.Time,
+) (_ []accountingservtypes.Entry, genErr error) {
+	defer func() { genErr = actualErr.Wrap(genErr) }()
+
+	const dateFormat = "2006-01-02"
+
+	accounts, err := r.GetAccounts(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{
+		"since_date": []string{from.Format(dateFormat)},
+		"until_date": []string{to.Format(dateFormat)},
+	}
+
+	var es []accountingservtypes.Entry
+	for _, a := range accounts {
+		var resp struct {
+			Data []actualTransaction `json:"data"`
+		}
+		path := r.path("/accounts/" + url.PathEscape(a.ID) + "/transactions")
+		if err := r.api(token).do(ctx, http.MethodGet, path, query, nil, &resp); err != nil {
+			return nil, err
+		}
+
+		for _, t := range resp.Data {
+			date, err := time.Parse(dateFormat, t.Date)
+			if err != nil {
+				return nil, errs.New("transaction %s has an invalid date %q: %w", t.ID, t.Date, err)
+			}
+
+			es = append(es, accountingservtypes.Entry{
+				ID:   t.ID,
+				Date: date,
+				Currency: currency.Amount{
+					Code:   r.Currency,
+					Number: float64(t.Amount) / 100,
+				},
+				Description: t.PayeeName,
+				AccountID:   a.ID,
+				CategoryID:  t.Category,
+			})
+		}
+	}
+
+	return es, nil
+}
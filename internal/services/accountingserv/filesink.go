@@ -0,0 +1,320 @@
+package accountingserv
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+var fileSinkErr = errs.Class("file sink")
+
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// FileSinkService writes entries to a local CSV file or a file with one JSON
+// object per line. Accounts and categories are taken from the entries
+// already written, so the token is not used. It has no dependencies, which
+// also makes it useful as a fake accounting backend.
+type FileSinkService struct {
+	Path   string
+	Format string
+
+	mu sync.Mutex
+}
+
+type fileRecord struct {
+	ID          string  `json:"id"`
+	Date        string  `json:"date"`
+	Amount      float64 `json:"amount"`
+	Currency    string  `json:"currency"`
+	Description string  `json:"description"`
+	Account     string  `json:"account"`
+	Category    string  `json:"category"`
+}
+
+var fileCSVHeader = []string{"id", "date", "amount", "currency", "description", "account", "category"}
+
+func (r *FileSinkService) read() ([]fileRecord, error) {
+	raw, err := os.ReadFile(r.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch r.Format {
+	case FormatCSV:
+		return readCSVRecords(bytes.NewReader(raw))
+	case FormatJSON:
+		return readJSONRecords(bytes.NewReader(raw))
+	}
+
+	return nil, errs.New("unknown format %q", r.Format)
+}
+
+func readCSVRecords(in io.Reader) ([]fileRecord, error) {
+	rows, err := csv.NewReader(in).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []fileRecord
+	for n, row := range rows {
+		if n == 0 || len(row) != len(fileCSVHeader) {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(row[2], 64)
+		if err != nil {
+			return nil, errs.New("row %d has an invalid amount %q", n+1, row[2])
+		}
+
+		records = append(records, fileRecord{
+			ID:          row[0],
+			Date:        row[1],
+			Amount:      amount,
+			Currency:    row[3],
+			Description: row[4],
+			Account:     row[5],
+			Category:    row[6],
+		})
+	}
+
+	return records, nil
+}
+
+func readJSONRecords(in io.Reader) ([]fileRecord, error) {
+	var records []fileRecord
+
+	s := bufio.NewScanner(in)
+	for n := 1; s.Scan(); n++ {
+		line := bytes.TrimSpace(s.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec fileRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return nil, errs.New("line %d: %w", n, err)
+		}
+		records = append(records, rec)
+	}
+
+	return records, s.Err()
+}
+
+func (r *FileSinkService) write(rec fileRecord) error {
+	var buf bytes.Buffer
+
+	switch r.Format {
+	case FormatCSV:
+		w := csv.NewWriter(&buf)
+		if _, err := os.Stat(r.Path); errors.Is(err, fs.ErrNotExist) {
+			_ = w.Write(fileCSVHeader)
+		}
+		_ = w.Write([]string{
+			rec.ID,
+			rec.Date,
+			strconv.FormatFloat(rec.Amount, 'f', 2, 64),
+			rec.Currency,
+			rec.Description,
+			rec.Account,
+			rec.Category,
+		})
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+
+	case FormatJSON:
+		raw, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf.Write(raw)
+		buf.WriteByte('\n')
+
+	default:
+		return errs.New("unknown format %q", r.Format)
+	}
+
+	return appendToFile(r.Path, buf.Bytes())
+}
+
+func (r *FileSinkService) GetAccounts(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Account, genErr error) {
+	defer func() { genErr = fileSinkErr.Wrap(genErr) }()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var as []accountingservtypes.Account
+	for _, rec := range records {
+		if seen[rec.Account] {
+			continue
+		}
+		seen[rec.Account] = true
+
+		as = append(as, accountingservtypes.Account{
+			ID:   rec.Account,
+			Name: rec.Account,
+		})
+	}
+
+	return as, nil
+}
+
+func (r *FileSinkService) OpenAccount(
+	ctx context.Context,
+	token, name string,
+) (accountingservtypes.Account, error) {
+	return accountingservtypes.Account{
+		ID:   name,
+		Name: name,
+	}, nil
+}
+
+func (r *FileSinkService) GetCategories(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Category, genErr error) {
+	defer func() { genErr = fileSinkErr.Wrap(genErr) }()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var cs []accountingservtypes.Category
+	for _, rec := range records {
+		if seen[rec.Category] {
+			continue
+		}
+		seen[rec.Category] = true
+
+		catType := Expense
+		if rec.Amount > 0 {
+			catType = Income
+		}
+
+		cs = append(cs, accountingservtypes.Category{
+			ID:   rec.Category,
+			Name: rec.Category,
+			Type: catType,
+		})
+	}
+
+	return cs, nil
+}
+
+// CreateCategory does not write anything, categories are stored by name in
+// each entry.
+func (r *FileSinkService) CreateCategory(
+	ctx context.Context, token, catType, category string,
+) (accountingservtypes.Category, error) {
+	return accountingservtypes.Category{
+		ID:   category,
+		Name: category,
+		Type: catType,
+	}, nil
+}
+
+func (r *FileSinkService) CreateEntry(
+	ctx context.Context, token string, entryInput accountingservtypes.CreateEntryInput,
+) (genErr error) {
+	defer func() { genErr = fileSinkErr.Wrap(genErr) }()
+
+	const dateFormat = "2006-01-02"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	return r.write(fileRecord{
+		ID:          strconv.Itoa(len(records) + 1),
+		Date:        entryInput.Date.Format(dateFormat),
+		Amount:      entryInput.Currency.Number,
+		Currency:    entryInput.Currency.Code,
+		Description: entryInput.Description,
+		Account:     entryInput.AccountID,
+		Category:    entryInput.CategoryID,
+	})
+}
+
+func (r *FileSinkService) GetEntries(
+	ctx context.Context, token string, from, to time.Time,
+) (_ []accountingservtypes.Entry, genErr error) {
+	defer func() { genErr = fileSinkErr.Wrap(genErr) }()
+
+	const dateFormat = "2006-01-02"
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	records, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+
+	from = truncateDay(from)
+	to = truncateDay(to)
+
+	var es []accountingservtypes.Entry
+	for _, rec := range records {
+		date, err := time.Parse(dateFormat, rec.Date)
+		if err != nil {
+			return nil, errs.New("entry %s has an invalid date %q: %w", rec.ID, rec.Date, err)
+		}
+
+		if date.Before(from) || date.After(to) {
+			continue
+		}
+
+		es = append(es, accountingservtypes.Entry{
+			ID:   rec.ID,
+			Date: date,
+			Currency: currency.Amount{
+				Code:   rec.Currency,
+				Number: rec.Amount,
+			},
+			Description: rec.Description,
+			AccountID:   rec.Account,
+			CategoryID:  rec.Category,
+		})
+	}
+
+	return es, nil
+}
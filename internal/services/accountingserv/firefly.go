@@ -0,0 +1,262 @@
+package accountingserv
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+var fireflyErr = errs.Class("firefly")
+
+// FireflyService registers entries in a Firefly III instance through its REST
+// API, the token is a personal access token.
+type FireflyService struct {
+	URL    string
+	Client httpClient
+}
+
+func (r *FireflyService) api(token string) jsonAPI {
+	return jsonAPI{
+		BaseURL: r.URL,
+		Client:  r.Client,
+		Header: http.Header{
+			"Authorization": []string{"Bearer " + token},
+		},
+	}
+}
+
+type fireflyPage[T any] struct {
+	Data []struct {
+		ID         string `json:"id"`
+		Attributes T      `json:"attributes"`
+	} `json:"data"`
+	Meta struct {
+		Pagination struct {
+			TotalPages int `json:"total_pages"`
+		} `json:"pagination"`
+	} `json:"meta"`
+}
+
+type fireflyAccount struct {
+	Name string `json:"name"`
+}
+
+type fireflyCategory struct {
+	Name string `json:"name"`
+}
+
+type fireflySplit struct {
+	Type          string `json:"type"`
+	Date          string `json:"date"`
+	Amount        string `json:"amount"`
+	Description   string `json:"description"`
+	CurrencyCode  string `json:"currency_code,omitempty"`
+	SourceID      string `json:"source_id,omitempty"`
+	SourceName    string `json:"source_name,omitempty"`
+	DestinationID string `json:"destination_id,omitempty"`
+	DestName      string `json:"destination_name,omitempty"`
+	CategoryID    string `json:"category_id,omitempty"`
+	Notes         string `json:"notes,omitempty"`
+}
+
+type fireflyTransaction struct {
+	Transactions []fireflySplit `json:"transactions"`
+}
+
+func getAllFireflyPages[T any](
+	ctx context.Context,
+	api jsonAPI,
+	path string,
+	query url.Values,
+) (map[string]T, []string, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+
+	items := make(map[string]T)
+	var order []string
+	for page := 1; ; page++ {
+		query.Set("page", strconv.Itoa(page))
+
+		var p fireflyPage[T]
+		if err := api.do(ctx, http.MethodGet, path, query, nil, &p); err != nil {
+			return nil, nil, err
+		}
+
+		for _, d := range p.Data {
+			items[d.ID] = d.Attributes
+			order = append(order, d.ID)
+		}
+
+		if page >= p.Meta.Pagination.TotalPages {
+			break
+		}
+	}
+
+	return items, order, nil
+}
+
+func (r *FireflyService) GetAccounts(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Account, genErr error) {
+	defer func() { genErr = fireflyErr.Wrap(genErr) }()
+
+	query := url.Values{"type": []string{"asset"}}
+	items, order, err := getAllFireflyPages[fireflyAccount](ctx, r.api(token), "/api/v1/accounts", query)
+	if err != nil {
+		return nil, err
+	}
+
+	as := make([]accountingservtypes.Account, 0, len(order))
+	for _, id := range order {
+		as = append(as, accountingservtypes.Account{
+			ID:   id,
+			Name: items[id].Name,
+		})
+	}
+
+	return as, nil
+}
+
+func (r *FireflyService) GetCategories(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Category, genErr error) {
+	defer func() { genErr = fireflyErr.Wrap(genErr) }()
+
+	items, order, err := getAllFireflyPages[fireflyCategory](ctx, r.api(token), "/api/v1/categories", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// firefly categories are used for both expenses and incomes, so they have
+	// no type
+	cs := make([]accountingservtypes.Category, 0, len(order))
+	for _, id := range order {
+		cs = append(cs, accountingservtypes.Category{
+			ID:   id,
+			Name: items[id].Name,
+		})
+	}
+
+	return cs, nil
+}
+
+func (r *FireflyService) CreateCategory(
+	ctx context.Context, token, catType, category string,
+) (_ accountingservtypes.Category, genErr error) {
+	defer func() { genErr = fireflyErr.Wrap(genErr) }()
+
+	var resp struct {
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	in := fireflyCategory{Name: category}
+	if err := r.api(token).do(ctx, http.MethodPost, "/api/v1/categories", nil, in, &resp); err != nil {
+		return accountingservtypes.Category{}, err
+	}
+
+	return accountingservtypes.Category{
+		ID:   resp.Data.ID,
+		Name: category,
+		Type: catType,
+	}, nil
+}
+
+func (r *FireflyService) CreateEntry(
+	ctx context.Context, token string, entryInput accountingservtypes.CreateEntryInput,
+) (genErr error) {
+	defer func() { genErr = fireflyErr.Wrap(genErr) }()
+
+	const dateFormat = "2006-01-02"
+
+	amount := entryInput.Currency.Number
+	split := fireflySplit{
+		Date:         entryInput.Date.Format(dateFormat),
+		Amount:       strconv.FormatFloat(math.Abs(amount), 'f', 2, 64),
+		Description:  entryInput.Description,
+		CurrencyCode: entryInput.Currency.Code,
+		CategoryID:   entryInput.CategoryID,
+		Notes:        entryInput.Notes,
+	}
+
+	// the counterpart of the transaction is the merchant, which firefly creates
+	// as an expense or revenue account if it does not exist
+	if amount < 0 {
+		split.Type = "withdrawal"
+		split.SourceID = entryInput.AccountID
+		split.DestName = entryInput.Description
+	} else {
+		split.Type = "deposit"
+		split.DestinationID = entryInput.AccountID
+		split.SourceName = entryInput.Description
+	}
+
+	in := fireflyTransaction{
+		Transactions: []fireflySplit{split},
+	}
+
+	return r.api(token).do(ctx, http.MethodPost, "/api/v1/transactions", nil, in, nil)
+}
+
+func (r *FireflyService) GetEntries(
+	ctx context.Context, token string, from, to time.Time,
+) (_ []accountingservtypes.Entry, genErr error) {
+	defer func() { genErr = fireflyErr.Wrap(genErr) }()
+
+	const dateFormat = "2006-01-02"
+
+	query := url.Values{
+		"start": []string{from.Format(dateFormat)},
+		"end":   []string{to.Format(dateFormat)},
+	}
+	items, order, err := getAllFireflyPages[fireflyTransaction](ctx, r.api(token), "/api/v1/transactions", query)
+	if err != nil {
+		return nil, err
+	}
+
+	var es []accountingservtypes.Entry
+	for _, id := range order {
+		for _, split := range items[id].Transactions {
+			date, err := time.Parse(time.RFC3339, split.Date)
+			if err != nil {
+				return nil, errs.New("transaction %s has an invalid date %q: %w", id, split.Date, err)
+			}
+
+			amount, err := strconv.ParseFloat(split.Amount, 64)
+			if err != nil {
+				return nil, errs.New("transaction %s has an invalid amount %q: %w", id, split.Amount, err)
+			}
+
+			accountID := split.DestinationID
+			if split.Type == "withdrawal" {
+				amount = -amount
+				accountID = split.SourceID
+			}
+
+			es = append(es, accountingservtypes.Entry{
+				ID:   id,
+				Date: time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+				Currency: currency.Amount{
+					Code:   split.CurrencyCode,
+					Number: amount,
+				},
+				Description: split.Description,
+				AccountID:   accountID,
+				CategoryID:  split.CategoryID,
+			})
+		}
+	}
+
+	return es, nil
+}
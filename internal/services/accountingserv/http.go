@@ -0,0 +1,94 @@
+package accountingserv
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// jsonAPI does the requests of the backends that have a JSON REST API
+type jsonAPI struct {
+	BaseURL string
+	Header  http.Header
+	Client  httpClient
+}
+
+func (a jsonAPI) do(
+	ctx context.Context,
+	method, path string,
+	query url.Values,
+	in, out any,
+) error {
+	u := strings.TrimSuffix(a.BaseURL, "/") + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if in != nil {
+		raw, err := json.Marshal(in)
+		if err != nil {
+			return errs.Wrap(err)
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	for k, vs := range a.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errs.New("%s %s failed: %w", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		const maxBody = 512
+		if len(raw) > maxBody {
+			raw = raw[:maxBody]
+		}
+		return errs.New("%s %s returned %d: %s", method, path, resp.StatusCode, raw)
+	}
+
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, out); err != nil {
+		return errs.New("invalid response from %s %s: %w", method, path, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,754 @@
+package accountingserv
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilparse"
+)
+
+var ledgerErr = errs.Class("ledger")
+
+const (
+	FormatLedger    = "ledger"
+	FormatBeancount = "beancount"
+)
+
+const (
+	ledgerAssets      = "Assets:"
+	ledgerLiabilities = "Liabilities:"
+	ledgerExpenses    = "Expenses:"
+	ledgerIncome      = "Income:"
+)
+
+// metadata keys used to tell apart identical entries
+const (
+	ledgerMessageIDKey = "message_id"
+	ledgerEmailDateKey = "email_date"
+)
+
+// LedgerService keeps entries in a ledger/hledger or beancount journal.
+// Accounts and categories are journal accounts, they exist as soon as a
+// posting uses them, so the token is not used.
+//
+// New entries are inserted after the last transaction that is not later than
+// them, without duplicates, and the rest of the journal is left as it is.
+type LedgerService struct {
+	Path string
+	// Format is FormatLedger (the default) or FormatBeancount
+	Format string
+
+	mu sync.Mutex
+}
+
+type ledgerPosting struct {
+	Account string
+	Amount  currency.Amount
+}
+
+type ledgerTransaction struct {
+	Date        time.Time
+	Description string
+	Meta        map[string]string
+	Postings    []ledgerPosting
+	// Lines are the lines of the transaction as they are in the journal, from
+	// Start to End in the lines of the journal
+	Lines      []string
+	Start, End int
+}
+
+type ledgerJournal struct {
+	// Lines are every line of the journal, including the ones outside of
+	// transactions such as comments, options and account declarations
+	Lines []string
+	Trxs  []ledgerTransaction
+}
+
+func (r *LedgerService) beancount() bool {
+	return r.Format == FormatBeancount
+}
+
+func (r *LedgerService) read() (ledgerJournal, error) {
+	f, err := os.Open(r.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ledgerJournal{}, nil
+	}
+	if err != nil {
+		return ledgerJournal{}, err
+	}
+	defer f.Close()
+
+	return parseLedger(f, r.beancount())
+}
+
+var beancountMetaExp = regexp.MustCompile(`^([a-z][a-zA-Z0-9_-]*):\s*(.*)$`)
+
+func parseLedger(in io.Reader, beancount bool) (ledgerJournal, error) {
+	var j ledgerJournal
+	var current *ledgerTransaction
+
+	s := bufio.NewScanner(in)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		trimmed := strings.TrimSpace(line)
+
+		j.Lines = append(j.Lines, line)
+
+		switch {
+		case trimmed == "":
+			current = nil
+
+		case line[0] != ' ' && line[0] != '\t':
+			current = nil
+
+			t, ok := parseLedgerHeader(trimmed, beancount)
+			if !ok {
+				continue
+			}
+
+			t.Lines = []string{line}
+			t.Start, t.End = len(j.Lines)-1, len(j.Lines)
+			j.Trxs = append(j.Trxs, t)
+			current = &j.Trxs[len(j.Trxs)-1]
+
+		case current == nil:
+
+		default:
+			current.Lines = append(current.Lines, line)
+			current.End = len(j.Lines)
+
+			if strings.HasPrefix(trimmed, ";") {
+				// ledger metadata is written in comments
+				if k, v, ok := strings.Cut(strings.TrimSpace(trimmed[1:]), ": "); ok && !strings.Contains(k, " ") {
+					current.Meta[k] = strings.TrimSpace(v)
+				}
+				continue
+			}
+
+			if m := beancountMetaExp.FindStringSubmatch(trimmed); beancount && m != nil {
+				v, err := strconv.Unquote(m[2])
+				if err != nil {
+					v = m[2]
+				}
+				current.Meta[m[1]] = v
+				continue
+			}
+
+			// postings with amounts that are not understood, such as ones
+			// with costs or expressions, are kept in the journal but ignored
+			p, err := parseLedgerPosting(trimmed)
+			if err != nil {
+				continue
+			}
+			current.Postings = append(current.Postings, p)
+		}
+	}
+
+	return j, s.Err()
+}
+
+func parseLedgerHeader(line string, beancount bool) (ledgerTransaction, bool) {
+	const dateFormat = "2006-01-02"
+
+	date, rest, _ := strings.Cut(line, " ")
+	d, err := time.Parse(dateFormat, strings.ReplaceAll(date, "/", "-"))
+	if err != nil {
+		return ledgerTransaction{}, false
+	}
+
+	rest = strings.TrimSpace(rest)
+	flag, description, _ := strings.Cut(rest, " ")
+
+	t := ledgerTransaction{
+		Date: d,
+		Meta: make(map[string]string),
+	}
+
+	if !beancount {
+		if flag != "*" && flag != "!" {
+			description = rest
+		}
+		t.Description = strings.TrimSpace(description)
+		return t, true
+	}
+
+	// other beancount directives, such as open, close or balance
+	if flag != "*" && flag != "!" && flag != "txn" {
+		return ledgerTransaction{}, false
+	}
+
+	// the narration is the last string, after the optional payee
+	for description = strings.TrimSpace(description); strings.HasPrefix(description, `"`); {
+		quoted, err := strconv.QuotedPrefix(description)
+		if err != nil {
+			break
+		}
+		t.Description, _ = strconv.Unquote(quoted)
+		description = strings.TrimSpace(description[len(quoted):])
+	}
+
+	return t, true
+}
+
+func parseLedgerPosting(line string) (ledgerPosting, error) {
+	line, _, _ = strings.Cut(line, ";")
+
+	// the account and the amount are separated by at least two spaces or a tab
+	account, amount, found := strings.Cut(line, "  ")
+	if !found {
+		account, amount, _ = strings.Cut(line, "\t")
+	}
+
+	p := ledgerPosting{
+		Account: strings.TrimSpace(account),
+	}
+
+	// balance assertions and prices are not part of the amount
+	if i := strings.IndexAny(amount, "=@{"); i >= 0 {
+		amount = amount[:i]
+	}
+
+	amount = strings.TrimSpace(amount)
+	if amount == "" {
+		// elided amount
+		return p, nil
+	}
+
+	m := ledgerAmountExp.FindStringSubmatchIndex(amount)
+	if m == nil {
+		return p, errs.New("invalid amount %q", amount)
+	}
+
+	number, err := utilparse.ParseAmount(amount[m[4]:m[5]], ledgerAmountFormat)
+	if err != nil {
+		return p, err
+	}
+
+	// the sign may go before or after a commodity that precedes the number,
+	// as in -$30.00 or $-30.00
+	negative := amount[m[2]:m[3]] == "-"
+	commodity := strings.TrimSpace(amount[:m[2]] + amount[m[5]:])
+	if strings.HasPrefix(commodity, "-") {
+		negative = true
+		commodity = strings.TrimSpace(commodity[1:])
+	}
+	if !ledgerCommodityExp.MatchString(commodity) {
+		return p, errs.New("invalid amount %q", amount)
+	}
+	if negative {
+		number = -number
+	}
+
+	p.Amount = currency.Amount{
+		Number: number,
+		Code:   strings.Trim(commodity, `"`),
+	}
+
+	return p, nil
+}
+
+// ledgerAmountExp finds the number in amounts such as 30.00 COP, $30.00,
+// COP 30000 or 1,234.00.
+var ledgerAmountExp = regexp.MustCompile(`([-+]?)(\d[\d,]*(?:\.\d+)?)`)
+
+// ledgerCommodityExp matches what is left of an amount without its number, so
+// that expressions such as (COP 10 * 3) are not taken as amounts.
+var ledgerCommodityExp = regexp.MustCompile(`^(?:[^\s\d()*/+=-]*|"[^"]*")$`)
+
+var ledgerAmountFormat = utilparse.AmountFormat{Thousands: ',', Decimal: '.'}
+
+var beancountOpenExp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})\s+open\s+(\S+)`)
+
+// insert adds t after the last transaction that is not later than it, or
+// before the first transaction when every one is later.
+func (j *ledgerJournal) insert(t ledgerTransaction) {
+	at := len(j.Lines)
+	last := -1
+	for n, o := range j.Trxs {
+		if !o.Date.After(t.Date) && (last < 0 || o.End > j.Trxs[last].End) {
+			last = n
+		}
+	}
+	if last >= 0 {
+		at = j.Trxs[last].End
+	} else if len(j.Trxs) > 0 {
+		at = j.Trxs[0].Start
+	}
+
+	// transactions are separated by a blank line
+	lines := t.Lines
+	start := at
+	if at > 0 && j.Lines[at-1] != "" {
+		lines = append([]string{""}, lines...)
+		start++
+	}
+	if at < len(j.Lines) && j.Lines[at] != "" {
+		lines = append(lines, "")
+	}
+
+	j.insertLines(at, lines)
+
+	t.Start, t.End = start, start+len(t.Lines)
+	j.Trxs = append(j.Trxs, t)
+}
+
+// insertLines inserts lines before the line at, and moves the transactions
+// after it.
+func (j *ledgerJournal) insertLines(at int, lines []string) {
+	j.Lines = slices.Insert(j.Lines, at, lines...)
+
+	for n := range j.Trxs {
+		if j.Trxs[n].Start >= at {
+			j.Trxs[n].Start += len(lines)
+			j.Trxs[n].End += len(lines)
+		}
+	}
+}
+
+func (r *LedgerService) write(j ledgerJournal) error {
+	if r.beancount() {
+		beancountOpenDirectives(&j)
+	}
+
+	var b strings.Builder
+	for _, l := range j.Lines {
+		b.WriteString(l)
+		b.WriteByte('\n')
+	}
+
+	// the new journal replaces the old one only once it is complete
+	tmp, err := os.CreateTemp(filepath.Dir(r.Path), filepath.Base(r.Path)+".*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), r.Path)
+}
+
+// beancountOpenDirectives adds an open directive for every account used by the
+// transactions of j, since beancount requires them. They are added before the
+// first transaction, and the date of an open directive is moved back in place
+// when an earlier transaction uses the account.
+func beancountOpenDirectives(j *ledgerJournal) {
+	const dateFormat = "2006-01-02"
+
+	var used []string
+	firstUse := make(map[string]time.Time)
+	for _, t := range j.Trxs {
+		for _, p := range t.Postings {
+			first, ok := firstUse[p.Account]
+			if !ok {
+				used = append(used, p.Account)
+			}
+			if !ok || t.Date.Before(first) {
+				firstUse[p.Account] = t.Date
+			}
+		}
+	}
+
+	opened := make(map[string]bool)
+	for n, l := range j.Lines {
+		m := beancountOpenExp.FindStringSubmatch(l)
+		if m == nil {
+			continue
+		}
+		opened[m[2]] = true
+
+		date, err := time.Parse(dateFormat, m[1])
+		if first, ok := firstUse[m[2]]; ok && err == nil && first.Before(date) {
+			j.Lines[n] = first.Format(dateFormat) + l[len(m[1]):]
+		}
+	}
+
+	var opens []string
+	for _, a := range used {
+		if !opened[a] {
+			opens = append(opens, fmt.Sprintf("%s open %s", firstUse[a].Format(dateFormat), a))
+		}
+	}
+	if len(opens) == 0 {
+		return
+	}
+
+	at := len(j.Lines)
+	for _, t := range j.Trxs {
+		at = min(at, t.Start)
+	}
+
+	// next to the directives that are before the first transaction
+	switch {
+	case at > 0 && j.Lines[at-1] == "":
+		at--
+	case at < len(j.Lines):
+		opens = append(opens, "")
+	}
+
+	j.insertLines(at, opens)
+}
+
+var beancountInvalidExp = regexp.MustCompile(`[^\p{L}\p{N}-]+`)
+
+// beancountAccount returns name as a valid beancount account, where every
+// component starts with a capital letter or a number and has no spaces.
+func beancountAccount(name string) string {
+	parts := strings.Split(name, ":")
+	for n, p := range parts {
+		p = strings.Trim(beancountInvalidExp.ReplaceAllString(p, "-"), "-")
+		if p == "" {
+			p = "X"
+		}
+		parts[n] = strings.ToUpper(p[:1]) + p[1:]
+	}
+
+	return strings.Join(parts, ":")
+}
+
+func (r *LedgerService) account(name string) accountingservtypes.Account {
+	short := name
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		short = name[i+1:]
+	}
+
+	if r.beancount() {
+		short = strings.ReplaceAll(short, "-", " ")
+	}
+
+	// accounts such as "Assets:Bancolombia:1234 Ahorros" are mapped by the
+	// numbers at the start of the name, like in the other backends
+	return accountingservtypes.Account{
+		ID:   name,
+		Name: short,
+	}
+}
+
+func (r *LedgerService) GetAccounts(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Account, genErr error) {
+	defer func() { genErr = ledgerErr.Wrap(genErr) }()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var as []accountingservtypes.Account
+	for _, t := range j.Trxs {
+		for _, p := range t.Postings {
+			isAccount := strings.HasPrefix(p.Account, ledgerAssets) ||
+				strings.HasPrefix(p.Account, ledgerLiabilities)
+			if !isAccount || seen[p.Account] {
+				continue
+			}
+			seen[p.Account] = true
+
+			as = append(as, r.account(p.Account))
+		}
+	}
+
+	return as, nil
+}
+
+// OpenAccount returns the journal account for name, which is placed under
+// Assets unless it is already a full account name.
+func (r *LedgerService) OpenAccount(
+	ctx context.Context,
+	token, name string,
+) (accountingservtypes.Account, error) {
+	if !strings.Contains(name, ":") {
+		name = ledgerAssets + name
+	}
+
+	if r.beancount() {
+		name = beancountAccount(name)
+	}
+
+	return r.account(name), nil
+}
+
+func (r *LedgerService) GetCategories(
+	ctx context.Context,
+	token string,
+) (_ []accountingservtypes.Category, genErr error) {
+	defer func() { genErr = ledgerErr.Wrap(genErr) }()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	var cs []accountingservtypes.Category
+	for _, t := range j.Trxs {
+		for _, p := range t.Postings {
+			if seen[p.Account] {
+				continue
+			}
+
+			var c accountingservtypes.Category
+			switch {
+			case strings.HasPrefix(p.Account, ledgerExpenses):
+				c = accountingservtypes.Category{
+					Name: strings.TrimPrefix(p.Account, ledgerExpenses),
+					Type: Expense,
+				}
+			case strings.HasPrefix(p.Account, ledgerIncome):
+				c = accountingservtypes.Category{
+					Name: strings.TrimPrefix(p.Account, ledgerIncome),
+					Type: Income,
+				}
+			default:
+				continue
+			}
+
+			seen[p.Account] = true
+			c.ID = p.Account
+			cs = append(cs, c)
+		}
+	}
+
+	return cs, nil
+}
+
+// CreateCategory does not write anything, the category account is used
+// directly by the entries.
+func (r *LedgerService) CreateCategory(
+	ctx context.Context, token, catType, category string,
+) (accountingservtypes.Category, error) {
+	prefix := ledgerExpenses
+	if catType == Income {
+		prefix = ledgerIncome
+	}
+
+	id := prefix + category
+	if r.beancount() {
+		id = beancountAccount(id)
+	}
+
+	return accountingservtypes.Category{
+		ID:   id,
+		Name: category,
+		Type: catType,
+	}, nil
+}
+
+// CreateEntry adds a balanced transaction to the journal, unless it is
+// already there with the same date, description, postings and origin message.
+func (r *LedgerService) CreateEntry(
+	ctx context.Context, token string, entryInput accountingservtypes.CreateEntryInput,
+) (genErr error) {
+	defer func() { genErr = ledgerErr.Wrap(genErr) }()
+
+	if entryInput.AccountID == "" || entryInput.CategoryID == "" {
+		return errs.New("entry needs both an account and a category")
+	}
+
+	t := r.newTransaction(entryInput)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, err := r.read()
+	if err != nil {
+		return err
+	}
+
+	if slices.ContainsFunc(j.Trxs, t.sameAs) {
+		return nil
+	}
+
+	j.insert(t)
+
+	return r.write(j)
+}
+
+func (r *LedgerService) newTransaction(entryInput accountingservtypes.CreateEntryInput) ledgerTransaction {
+	const dateFormat = "2006-01-02"
+
+	account, category := entryInput.AccountID, entryInput.CategoryID
+	indent := "    "
+	if r.beancount() {
+		account, category = beancountAccount(account), beancountAccount(category)
+		indent = "  "
+	}
+
+	date := entryInput.Date
+	t := ledgerTransaction{
+		Date:        time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC),
+		Description: oneLine(entryInput.Description),
+		Meta:        make(map[string]string),
+		Postings: []ledgerPosting{
+			{
+				Account: category,
+				Amount: currency.Amount{
+					Code:   entryInput.Currency.Code,
+					Number: -entryInput.Currency.Number,
+				},
+			},
+			{
+				Account: account,
+				Amount:  entryInput.Currency,
+			},
+		},
+	}
+
+	if r.beancount() {
+		t.Lines = append(t.Lines, fmt.Sprintf("%s * %q", date.Format(dateFormat), t.Description))
+	} else {
+		t.Lines = append(t.Lines, fmt.Sprintf("%s %s", date.Format(dateFormat), t.Description))
+	}
+
+	meta := make(map[string]string, len(entryInput.Metadata)+1)
+	for k, v := range entryInput.Metadata {
+		meta[k] = v
+	}
+	if entryInput.Notes != "" {
+		meta["notes"] = entryInput.Notes
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := oneLine(meta[k])
+		t.Meta[k] = v
+
+		if r.beancount() {
+			t.Lines = append(t.Lines, fmt.Sprintf("%s%s: %q", indent, k, v))
+		} else {
+			t.Lines = append(t.Lines, fmt.Sprintf("%s; %s: %s", indent, k, v))
+		}
+	}
+
+	for _, p := range t.Postings {
+		t.Lines = append(t.Lines, fmt.Sprintf("%s%s  %.2f %s", indent, p.Account, p.Amount.Number, p.Amount.Code))
+	}
+
+	return t
+}
+
+func (t ledgerTransaction) sameAs(o ledgerTransaction) bool {
+	if !t.Date.Equal(o.Date) || t.Description != o.Description || len(t.Postings) != len(o.Postings) {
+		return false
+	}
+
+	for n, p := range t.Postings {
+		q := o.Postings[n]
+		if p.Account != q.Account || fmt.Sprintf("%.2f", p.Amount.Number) != fmt.Sprintf("%.2f", q.Amount.Number) {
+			return false
+		}
+	}
+
+	// identical purchases on the same day come from different messages
+	for _, k := range []string{ledgerMessageIDKey, ledgerEmailDateKey} {
+		v, ok := t.Meta[k]
+		w, found := o.Meta[k]
+		if ok && found && v != w {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *LedgerService) GetEntries(
+	ctx context.Context, token string, from, to time.Time,
+) (_ []accountingservtypes.Entry, genErr error) {
+	defer func() { genErr = ledgerErr.Wrap(genErr) }()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	j, err := r.read()
+	if err != nil {
+		return nil, err
+	}
+
+	from = truncateDay(from)
+	to = truncateDay(to)
+
+	var es []accountingservtypes.Entry
+	for n, t := range j.Trxs {
+		if t.Date.Before(from) || t.Date.After(to) {
+			continue
+		}
+
+		e := accountingservtypes.Entry{
+			ID:          strconv.Itoa(n + 1),
+			Date:        t.Date,
+			Description: t.Description,
+		}
+
+		for _, p := range t.Postings {
+			switch {
+			case strings.HasPrefix(p.Account, ledgerAssets), strings.HasPrefix(p.Account, ledgerLiabilities):
+				e.AccountID = p.Account
+				e.Currency = p.Amount
+			case strings.HasPrefix(p.Account, ledgerExpenses), strings.HasPrefix(p.Account, ledgerIncome):
+				e.CategoryID = p.Account
+			}
+		}
+
+		es = append(es, e)
+	}
+
+	return es, nil
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func appendToFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
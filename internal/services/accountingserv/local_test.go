@@ -0,0 +1,222 @@
+package accountingserv
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+type localBackend interface {
+	GetAccounts(ctx context.Context, token string) ([]accountingservtypes.Account, error)
+	GetCategories(ctx context.Context, token string) ([]accountingservtypes.Category, error)
+	CreateCategory(ctx context.Context, token, catType, category string) (accountingservtypes.Category, error)
+	CreateEntry(ctx context.Context, token string, entryInput accountingservtypes.CreateEntryInput) error
+	GetEntries(ctx context.Context, token string, from, to time.Time) ([]accountingservtypes.Entry, error)
+	OpenAccount(ctx context.Context, token, name string) (accountingservtypes.Account, error)
+}
+
+func Test_LocalBackends(t *testing.T) {
+	dir := t.TempDir()
+
+	backends := map[string]localBackend{
+		"ledger":    &LedgerService{Path: filepath.Join(dir, "journal.ledger")},
+		"beancount": &LedgerService{Path: filepath.Join(dir, "journal.beancount"), Format: FormatBeancount},
+		"csv":       &FileSinkService{Path: filepath.Join(dir, "entries.csv"), Format: FormatCSV},
+		"json":      &FileSinkService{Path: filepath.Join(dir, "entries.jsonl"), Format: FormatJSON},
+	}
+
+	for name, b := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			account, err := b.OpenAccount(ctx, "", "1234 Bancolombia")
+			require.NoError(t, err)
+			assert.Equal(t, "1234 Bancolombia", account.Name)
+
+			cat, err := b.CreateCategory(ctx, "", Expense, "Mercado")
+			require.NoError(t, err)
+
+			day := time.Date(2023, time.January, 3, 10, 0, 0, 0, time.UTC)
+			for _, amount := range []float64{-23050, -1000.5} {
+				err = b.CreateEntry(ctx, "", accountingservtypes.CreateEntryInput{
+					Date:        day,
+					Currency:    currency.Amount{Code: "COP", Number: amount},
+					Description: "** Compra de EXITO",
+					AccountID:   account.ID,
+					CategoryID:  cat.ID,
+				})
+				require.NoError(t, err)
+			}
+
+			accounts, err := b.GetAccounts(ctx, "")
+			require.NoError(t, err)
+			assert.Equal(t, []accountingservtypes.Account{account}, accounts)
+
+			cats, err := b.GetCategories(ctx, "")
+			require.NoError(t, err)
+			require.Len(t, cats, 1)
+			assert.Equal(t, "Mercado", cats[0].Name)
+			assert.Equal(t, Expense, cats[0].Type)
+
+			entries, err := b.GetEntries(ctx, "", day, day)
+			require.NoError(t, err)
+			require.Len(t, entries, 2)
+			assert.Equal(t, -23050.0, entries[0].Currency.Number)
+			assert.Equal(t, "COP", entries[0].Currency.Code)
+			assert.Equal(t, account.ID, entries[1].AccountID)
+			assert.Equal(t, cat.ID, entries[1].CategoryID)
+			assert.Equal(t, "** Compra de EXITO", entries[1].Description)
+
+			entries, err = b.GetEntries(ctx, "", day.AddDate(0, 0, 1), day.AddDate(0, 0, 2))
+			require.NoError(t, err)
+			assert.Empty(t, entries)
+		})
+	}
+}
+
+func Test_BeancountSortedAndDeduplicated(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal.beancount")
+
+	require.NoError(t, os.WriteFile(path, []byte("option \"operating_currency\" \"COP\"\n"), 0o600))
+
+	b := &LedgerService{Path: path, Format: FormatBeancount}
+
+	entry := func(day int, amount float64, msgID string) accountingservtypes.CreateEntryInput {
+		return accountingservtypes.CreateEntryInput{
+			Date:        time.Date(2023, time.January, day, 10, 0, 0, 0, time.UTC),
+			Currency:    currency.Amount{Code: "COP", Number: amount},
+			Description: "** Compra de EXITO",
+			AccountID:   "Assets:Bancolombia:1234",
+			CategoryID:  "Expenses:PENDING_EXPENSE",
+			Metadata: map[string]string{
+				"bank":       "Bancolombia",
+				"message_id": msgID,
+			},
+		}
+	}
+
+	require.NoError(t, b.CreateEntry(ctx, "", entry(5, -100, "2")))
+	require.NoError(t, b.CreateEntry(ctx, "", entry(3, -23050, "1")))
+	require.NoError(t, b.CreateEntry(ctx, "", entry(3, -23050, "1")))
+	// the same purchase from another message is not a duplicate
+	require.NoError(t, b.CreateEntry(ctx, "", entry(3, -23050, "3")))
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, `option "operating_currency" "COP"
+2023-01-03 open Expenses:PENDING-EXPENSE
+2023-01-03 open Assets:Bancolombia:1234
+
+2023-01-03 * "** Compra de EXITO"
+  bank: "Bancolombia"
+  message_id: "1"
+  Expenses:PENDING-EXPENSE  23050.00 COP
+  Assets:Bancolombia:1234  -23050.00 COP
+
+2023-01-03 * "** Compra de EXITO"
+  bank: "Bancolombia"
+  message_id: "3"
+  Expenses:PENDING-EXPENSE  23050.00 COP
+  Assets:Bancolombia:1234  -23050.00 COP
+
+2023-01-05 * "** Compra de EXITO"
+  bank: "Bancolombia"
+  message_id: "2"
+  Expenses:PENDING-EXPENSE  100.00 COP
+  Assets:Bancolombia:1234  -100.00 COP
+`, string(raw))
+}
+
+func Test_ParseLedgerPosting(t *testing.T) {
+	tests := []struct {
+		In  string
+		Out ledgerPosting
+		Err bool
+	}{
+		{In: "Expenses:Mercado  30.00 COP", Out: ledgerPosting{Account: "Expenses:Mercado", Amount: currency.Amount{Number: 30, Code: "COP"}}},
+		{In: "Expenses:Mercado  $30.00", Out: ledgerPosting{Account: "Expenses:Mercado", Amount: currency.Amount{Number: 30, Code: "$"}}},
+		{In: "Assets:Bancolombia  -$30.00", Out: ledgerPosting{Account: "Assets:Bancolombia", Amount: currency.Amount{Number: -30, Code: "$"}}},
+		{In: "Assets:Bancolombia  $-30.00", Out: ledgerPosting{Account: "Assets:Bancolombia", Amount: currency.Amount{Number: -30, Code: "$"}}},
+		{In: "Expenses:Mercado\tCOP 30000", Out: ledgerPosting{Account: "Expenses:Mercado", Amount: currency.Amount{Number: 30000, Code: "COP"}}},
+		{In: "Expenses:Mercado  1,234.00", Out: ledgerPosting{Account: "Expenses:Mercado", Amount: currency.Amount{Number: 1234}}},
+		{In: "Assets:Bancolombia  -1,234.50 COP = 0 COP", Out: ledgerPosting{Account: "Assets:Bancolombia", Amount: currency.Amount{Number: -1234.5, Code: "COP"}}},
+		{In: "Assets:Bancolombia  ; elided", Out: ledgerPosting{Account: "Assets:Bancolombia"}},
+		{In: "Expenses:Mercado  (COP 10 * 3)", Err: true},
+		{In: "Expenses:Mercado  1,23.00 COP", Err: true},
+	}
+
+	for _, tt := range tests {
+		p, err := parseLedgerPosting(tt.In)
+		if tt.Err {
+			assert.Error(t, err, tt.In)
+			continue
+		}
+
+		require.NoError(t, err, tt.In)
+		assert.Equal(t, tt.Out, p, tt.In)
+	}
+}
+
+func Test_LedgerKeepsJournalLayout(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "journal.ledger")
+
+	journal := `; personal journal
+2023-01-02 Arriendo
+    Expenses:Arriendo  $1,500,000.00
+    Assets:Bancolombia:1234
+
+; prices of january
+P 2023-01-04 USD 4,700 COP
+
+2023-01-06 Calculated
+    Expenses:Mercado  (COP 10 * 3)
+    Assets:Bancolombia:1234
+`
+	require.NoError(t, os.WriteFile(path, []byte(journal), 0o600))
+
+	b := &LedgerService{Path: path}
+
+	entries, err := b.GetEntries(ctx, "", time.Date(2023, time.January, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, time.January, 31, 0, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Expenses:Arriendo", entries[0].CategoryID)
+
+	require.NoError(t, b.CreateEntry(ctx, "", accountingservtypes.CreateEntryInput{
+		Date:        time.Date(2023, time.January, 3, 10, 0, 0, 0, time.UTC),
+		Currency:    currency.Amount{Code: "COP", Number: -23050},
+		Description: "** Compra de EXITO",
+		AccountID:   "Assets:Bancolombia:1234",
+		CategoryID:  "Expenses:Mercado",
+	}))
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, `; personal journal
+2023-01-02 Arriendo
+    Expenses:Arriendo  $1,500,000.00
+    Assets:Bancolombia:1234
+
+2023-01-03 ** Compra de EXITO
+    Expenses:Mercado  23050.00 COP
+    Assets:Bancolombia:1234  -23050.00 COP
+
+; prices of january
+P 2023-01-04 USD 4,700 COP
+
+2023-01-06 Calculated
+    Expenses:Mercado  (COP 10 * 3)
+    Assets:Bancolombia:1234
+`, string(raw))
+}
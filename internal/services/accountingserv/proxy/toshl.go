@@ -13,6 +13,7 @@ type ToshlClient interface {
 	Accounts(params *toshl.AccountQueryParams) ([]toshl.Account, error)
 	CreateCategory(category *toshl.Category) error
 	CreateEntry(entry *toshl.Entry) error
+	Entries(params *toshl.EntryQueryParams) ([]toshl.Entry, error)
 }
 
 type inMemoryCache interface {
@@ -96,3 +97,9 @@ func (c *ToshlCacheClient) CreateEntry(entry *toshl.Entry) error {
 
 	return c.Client.CreateEntry(entry)
 }
+
+func (c *ToshlCacheClient) Entries(params *toshl.EntryQueryParams) ([]toshl.Entry, error) {
+	c.init()
+
+	return c.Client.Entries(params)
+}
@@ -4,12 +4,15 @@ import (
 	"context"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/Philanthropists/toshl-go"
 	"github.com/zeebo/errs"
 
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
 )
 
 type ToshlClient interface {
@@ -17,6 +20,7 @@ type ToshlClient interface {
 	Accounts(params *toshl.AccountQueryParams) ([]toshl.Account, error)
 	CreateCategory(category *toshl.Category) error
 	CreateEntry(entry *toshl.Entry) error
+	Entries(params *toshl.EntryQueryParams) ([]toshl.Entry, error)
 }
 
 const (
@@ -44,6 +48,8 @@ func (r *ToshlService) GetAccounts(
 	ctx context.Context,
 	token string,
 ) ([]accountingservtypes.Account, error) {
+	defer metrics.ObserveSince(metrics.ToshlLatency.WithLabelValues("get_accounts"), time.Now())
+
 	c := r.getClient(token)
 
 	return doCancelableOperation(ctx, func() ([]accountingservtypes.Account, error) {
@@ -69,6 +75,8 @@ func (r *ToshlService) GetCategories(
 	ctx context.Context,
 	token string,
 ) ([]accountingservtypes.Category, error) {
+	defer metrics.ObserveSince(metrics.ToshlLatency.WithLabelValues("get_categories"), time.Now())
+
 	c := r.getClient(token)
 
 	return doCancelableOperation(ctx, func() ([]accountingservtypes.Category, error) {
@@ -94,6 +102,8 @@ func (r *ToshlService) GetCategories(
 func (r *ToshlService) CreateCategory(
 	ctx context.Context, token, catType, category string,
 ) (accountingservtypes.Category, error) {
+	defer metrics.ObserveSince(metrics.ToshlLatency.WithLabelValues("create_category"), time.Now())
+
 	c := r.getClient(token)
 
 	validCategoryTypes := []string{
@@ -127,6 +137,8 @@ func (r *ToshlService) CreateCategory(
 func (r *ToshlService) CreateEntry(
 	ctx context.Context, token string, entryInput accountingservtypes.CreateEntryInput,
 ) error {
+	defer metrics.ObserveSince(metrics.ToshlLatency.WithLabelValues("create_entry"), time.Now())
+
 	log := logging.FromContext(ctx)
 
 	c := r.getClient(token)
@@ -135,6 +147,9 @@ func (r *ToshlService) CreateEntry(
 
 	date := entryInput.Date.Format(dateFormat)
 	description := entryInput.Description
+	if entryInput.Notes != "" {
+		description += "\n\n" + entryInput.Notes
+	}
 
 	newEntry := toshl.Entry{
 		Amount: entryInput.Currency.Number,
@@ -159,6 +174,58 @@ func (r *ToshlService) CreateEntry(
 	return nil
 }
 
+func (r *ToshlService) GetEntries(
+	ctx context.Context, token string, from, to time.Time,
+) ([]accountingservtypes.Entry, error) {
+	defer metrics.ObserveSince(metrics.ToshlLatency.WithLabelValues("get_entries"), time.Now())
+
+	c := r.getClient(token)
+
+	params := &toshl.EntryQueryParams{
+		From: toshl.Date(from),
+		To:   toshl.Date(to),
+	}
+
+	return doCancelableOperation(ctx, func() ([]accountingservtypes.Entry, error) {
+		entries, err := c.Entries(params)
+		if err != nil {
+			return nil, errs.New("could not get entries: %w", err)
+		}
+
+		const dateFormat = "2006-01-02"
+
+		es := make([]accountingservtypes.Entry, 0, len(entries))
+		for _, e := range entries {
+			date, err := time.Parse(dateFormat, e.Date)
+			if err != nil {
+				return nil, errs.New("entry has an invalid date %q: %w", e.Date, err)
+			}
+
+			var id, description string
+			if e.Id != nil {
+				id = *e.Id
+			}
+			if e.Description != nil {
+				description = *e.Description
+			}
+
+			es = append(es, accountingservtypes.Entry{
+				ID:   id,
+				Date: date,
+				Currency: currency.Amount{
+					Code:   e.Currency.Code,
+					Number: e.Amount,
+				},
+				Description: description,
+				AccountID:   e.Account,
+				CategoryID:  e.Category,
+			})
+		}
+
+		return es, nil
+	})
+}
+
 func doCancelableOperation[T any](ctx context.Context, op func() (T, error)) (T, error) {
 	type response struct {
 		Value T
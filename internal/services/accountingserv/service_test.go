@@ -0,0 +1,73 @@
+package accountingserv
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Philanthropists/toshl-go"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+type fakeToshlClient struct {
+	ToshlClient
+
+	entries []toshl.Entry
+}
+
+func (f *fakeToshlClient) CreateEntry(entry *toshl.Entry) error {
+	f.entries = append(f.entries, *entry)
+	return nil
+}
+
+func (f *fakeToshlClient) Entries(*toshl.EntryQueryParams) ([]toshl.Entry, error) {
+	return f.entries, nil
+}
+
+func toshlSamples(t *testing.T, operation string) uint64 {
+	t.Helper()
+
+	var m dto.Metric
+	h := metrics.ToshlLatency.WithLabelValues(operation).(prometheus.Metric)
+	require.NoError(t, h.Write(&m))
+
+	return m.GetHistogram().GetSampleCount()
+}
+
+func Test_ToshlLatency(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeToshlClient{}
+	r := &ToshlService{ClientBuilder: func(string) ToshlClient { return client }}
+
+	created := toshlSamples(t, "create_entry")
+	got := toshlSamples(t, "get_entries")
+
+	require.NoError(t, r.CreateEntry(ctx, "token", accountingservtypes.CreateEntryInput{
+		Currency: currency.Amount{Code: "COP", Number: -30000},
+		Date:     time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC),
+	}))
+	assert.Equal(t, created+1, toshlSamples(t, "create_entry"))
+	assert.Equal(t, got, toshlSamples(t, "get_entries"))
+
+	_, err := r.GetEntries(ctx, "token", time.Now().AddDate(0, -1, 0), time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, created+1, toshlSamples(t, "create_entry"))
+	assert.Equal(t, got+1, toshlSamples(t, "get_entries"))
+}
+
+func Test_ActualCurrency(t *testing.T) {
+	r := &ActualService{URL: "http://localhost", BudgetID: "budget", Currency: "COP"}
+
+	err := r.CreateEntry(context.Background(), "token", accountingservtypes.CreateEntryInput{
+		Currency:  currency.Amount{Code: "USD", Number: -12.5},
+		AccountID: "1",
+	})
+	assert.ErrorContains(t, err, "entry is in USD but the budget is in COP")
+}
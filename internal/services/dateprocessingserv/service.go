@@ -2,6 +2,7 @@ package dateprocessingserv
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"time"
@@ -18,11 +19,20 @@ import (
 const (
 	OverrideLasProcessedDateEnvName = "OVERRIDE_LAST_PROC_DATE"
 
-	table  = "toshl-data"
-	field  = "LastProcessedDate"
-	itemId = 1
+	table       = "toshl-data"
+	field       = "LastProcessedDate"
+	reportField = "LastRunReport"
+	itemId      = 1
 
 	dateFormat = time.RFC822Z
+
+	// reportTTL is how long run reports are kept, they are deleted by the
+	// time to live of the table on the reportExpiresField attribute
+	reportTTL          = 90 * 24 * time.Hour
+	reportExpiresField = "ExpiresAt"
+	// maxReportSize leaves room for the other attributes of an item, which can
+	// not be larger than 400 KB
+	maxReportSize = 350 << 10
 )
 
 var sinceFallbackDate time.Time = time.Now().Add(-30 * 24 * 60 * 60 * time.Second) // 30 days
@@ -45,6 +55,18 @@ type dynamoClient interface {
 		*dynamodb.UpdateItemInput,
 		...func(*dynamodb.Options),
 	) (*dynamodb.UpdateItemOutput, error)
+
+	PutItem(
+		context.Context,
+		*dynamodb.PutItemInput,
+		...func(*dynamodb.Options),
+	) (*dynamodb.PutItemOutput, error)
+
+	DescribeTable(
+		context.Context,
+		*dynamodb.DescribeTableInput,
+		...func(*dynamodb.Options),
+	) (*dynamodb.DescribeTableOutput, error)
 }
 
 type DynamoDBService struct {
@@ -136,6 +158,68 @@ func (r DynamoDBService) SaveProcessedDate(
 	return nil
 }
 
+// SaveRunReport keeps report as JSON in its own item, with the time the run
+// started as id, and as the last run report in the item of the processed date.
+// The item of the report expires after reportTTL.
+func (r DynamoDBService) SaveRunReport(
+	ctx context.Context,
+	startedAt time.Time,
+	report any,
+) error {
+	raw, err := json.Marshal(report)
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	if len(raw) > maxReportSize {
+		return errs.New("run report has %d bytes, more than the %d that can be saved", len(raw), maxReportSize)
+	}
+
+	item, err := attributevalue.MarshalMap(map[string]any{
+		"Id":               startedAt.UnixMilli(),
+		"Report":           string(raw),
+		reportExpiresField: startedAt.Add(reportTTL).Unix(),
+	})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	_, err = r.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		Item:      item,
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return errs.New("could not save run report: %w", err)
+	}
+
+	key, err := attributevalue.MarshalMap(map[string]any{
+		"Id": itemId,
+	})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	expAttrValues, err := attributevalue.MarshalMap(map[string]any{
+		":r": string(raw),
+	})
+	if err != nil {
+		return errs.Wrap(err)
+	}
+
+	exp := fmt.Sprintf("set %s = :r", reportField)
+	_, err = r.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		Key:                       key,
+		ExpressionAttributeValues: expAttrValues,
+		TableName:                 aws.String(table),
+		UpdateExpression:          aws.String(exp),
+	})
+	if err != nil {
+		return errs.New("could not update last run report: %w", err)
+	}
+
+	return nil
+}
+
 type ProcessedDate time.Time
 
 func (d ProcessedDate) MarshalDynamoDBAttributeValue() (types.AttributeValue, error) {
@@ -198,3 +282,23 @@ func (r DynamoDBService) getDateFromStorage(
 
 	return time.Time(val.ProcessedDate), nil
 }
+
+// CheckTable verifies that the state table exists and is active.
+func (r DynamoDBService) CheckTable(ctx context.Context) error {
+	if r.Client == nil {
+		return errs.New("dynamoDB client is nil")
+	}
+
+	out, err := r.Client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return errs.New("could not describe table %s: %w", table, err)
+	}
+
+	if status := out.Table.TableStatus; status != types.TableStatusActive {
+		return errs.New("table %s is %s", table, status)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package dateprocessingserv
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeDynamo struct {
+	dynamoClient
+
+	puts    []*dynamodb.PutItemInput
+	updates []*dynamodb.UpdateItemInput
+}
+
+func (f *fakeDynamo) PutItem(
+	_ context.Context,
+	in *dynamodb.PutItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.PutItemOutput, error) {
+	f.puts = append(f.puts, in)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamo) UpdateItem(
+	_ context.Context,
+	in *dynamodb.UpdateItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateItemOutput, error) {
+	f.updates = append(f.updates, in)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func Test_SaveRunReport(t *testing.T) {
+	ctx := context.Background()
+	client := &fakeDynamo{}
+	r := DynamoDBService{Client: client}
+
+	startedAt := time.Date(2024, time.March, 15, 14, 32, 0, 0, time.UTC)
+	report := map[string]any{"ignored": 3}
+
+	require.NoError(t, r.SaveRunReport(ctx, startedAt, report))
+
+	require.Len(t, client.puts, 1)
+	item := client.puts[0].Item
+	assert.Equal(t, &types.AttributeValueMemberN{Value: strconv.FormatInt(startedAt.UnixMilli(), 10)}, item["Id"])
+	assert.Equal(t, &types.AttributeValueMemberS{Value: `{"ignored":3}`}, item["Report"])
+	assert.Equal(t,
+		&types.AttributeValueMemberN{Value: strconv.FormatInt(startedAt.Add(reportTTL).Unix(), 10)},
+		item[reportExpiresField],
+	)
+
+	require.Len(t, client.updates, 1)
+	assert.Equal(t, &types.AttributeValueMemberS{Value: `{"ignored":3}`}, client.updates[0].ExpressionAttributeValues[":r"])
+}
+
+func Test_SaveRunReportTooLarge(t *testing.T) {
+	client := &fakeDynamo{}
+	r := DynamoDBService{Client: client}
+
+	report := map[string]any{"errors": strings.Repeat("x", maxReportSize)}
+
+	err := r.SaveRunReport(context.Background(), time.Now(), report)
+	assert.Error(t, err)
+	assert.Empty(t, client.puts)
+	assert.Empty(t, client.updates)
+}
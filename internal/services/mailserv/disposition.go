@@ -0,0 +1,126 @@
+package mailserv
+
+import (
+	"context"
+
+	"github.com/emersion/go-imap"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+// ApplyDispositions applies the disposition of each group to its messages in
+// mailbox, which are identified by their sequence numbers. Every group is
+// applied even when another one fails.
+func (r *IMAPService) ApplyDispositions(
+	ctx context.Context,
+	mailbox string,
+	groups ...mailservtypes.DispositionGroup,
+) error {
+	var ids []uint32
+	for _, g := range groups {
+		ids = append(ids, g.IDs...)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	c, err := r.getClient()
+	if err != nil {
+		return err
+	}
+
+	if _, err := c.Select(mailbox, false); err != nil {
+		return errs.Wrap(err)
+	}
+
+	// moving messages expunges them and renumbers the rest, so UIDs are used
+	// from here on
+	uids, err := getUIDs(c, ids)
+	if err != nil {
+		return err
+	}
+
+	var group errs.Group
+	for _, g := range groups {
+		uidset := new(imap.SeqSet)
+		for _, id := range g.IDs {
+			if uid, ok := uids[id]; ok {
+				uidset.AddNum(uid)
+			}
+		}
+		if uidset.Empty() {
+			continue
+		}
+
+		if err := ctx.Err(); err != nil {
+			group.Add(errs.Wrap(err))
+			break
+		}
+
+		group.Add(applyDisposition(c, uidset, g.Disposition))
+	}
+
+	return group.Err()
+}
+
+func applyDisposition(c IMAPClient, uidset *imap.SeqSet, d mailservtypes.Disposition) error {
+	if d.Copy != "" {
+		if err := c.UidCopy(uidset, d.Copy); err != nil {
+			return errs.New("could not copy messages to %q: %w", d.Copy, err)
+		}
+	}
+
+	flags := make([]interface{}, 0, len(d.Flags)+1)
+	for _, f := range d.Flags {
+		flags = append(flags, f)
+	}
+	if d.Seen {
+		flags = append(flags, imap.SeenFlag)
+	}
+	if len(flags) > 0 {
+		item := imap.FormatFlagsOp(imap.AddFlags, true)
+		if err := c.UidStore(uidset, item, flags, nil); err != nil {
+			return errs.New("could not add flags %v to messages: %w", flags, err)
+		}
+	}
+
+	if len(d.RemoveFlags) > 0 {
+		remove := make([]interface{}, 0, len(d.RemoveFlags))
+		for _, f := range d.RemoveFlags {
+			remove = append(remove, f)
+		}
+
+		item := imap.FormatFlagsOp(imap.RemoveFlags, true)
+		if err := c.UidStore(uidset, item, remove, nil); err != nil {
+			return errs.New("could not remove flags %v from messages: %w", remove, err)
+		}
+	}
+
+	if d.Move != "" {
+		if err := c.UidMove(uidset, d.Move); err != nil {
+			return errs.New("could not move messages to %q: %w", d.Move, err)
+		}
+	}
+
+	return nil
+}
+
+func getUIDs(c IMAPClient, ids []uint32) (map[uint32]uint32, error) {
+	seqset := new(imap.SeqSet)
+	seqset.AddNum(ids...)
+
+	// the channel is big enough for every message, so that Fetch does not
+	// need to be read concurrently
+	messages := make(chan *imap.Message, len(ids))
+	if err := c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages); err != nil {
+		return nil, errs.New("could not get the UIDs of the messages: %w", err)
+	}
+
+	uids := make(map[uint32]uint32, len(ids))
+	for m := range messages {
+		uids[m.SeqNum] = m.Uid
+	}
+
+	return uids, nil
+}
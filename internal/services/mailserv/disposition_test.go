@@ -0,0 +1,208 @@
+package mailserv
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+// fakeIMAPClient records the commands that change messages, identified by
+// their UIDs.
+type fakeIMAPClient struct {
+	IMAPClient
+
+	// uids maps the sequence numbers of the selected mailbox to their UIDs
+	uids    map[uint32]uint32
+	moveErr error
+
+	// mailboxes are listed with the hierarchy delimiter of the server
+	mailboxes []*imap.MailboxInfo
+	delimiter string
+	created   []string
+
+	selected string
+	commands []string
+}
+
+func (f *fakeIMAPClient) List(_, name string, ch chan *imap.MailboxInfo) error {
+	defer close(ch)
+
+	// an empty name asks for the delimiter
+	if name == "" {
+		ch <- &imap.MailboxInfo{Delimiter: f.delimiter}
+		return nil
+	}
+
+	for _, m := range f.mailboxes {
+		ch <- m
+	}
+
+	return nil
+}
+
+func (f *fakeIMAPClient) Create(name string) error {
+	f.created = append(f.created, name)
+	f.mailboxes = append(f.mailboxes, &imap.MailboxInfo{Name: name, Delimiter: f.delimiter})
+
+	return nil
+}
+
+func (f *fakeIMAPClient) Select(name string, _ bool) (*imap.MailboxStatus, error) {
+	f.selected = name
+	return &imap.MailboxStatus{Name: name}, nil
+}
+
+func (f *fakeIMAPClient) Fetch(seqset *imap.SeqSet, _ []imap.FetchItem, ch chan *imap.Message) error {
+	defer close(ch)
+
+	for seq, uid := range f.uids {
+		if seqset.Contains(seq) {
+			ch <- &imap.Message{SeqNum: seq, Uid: uid}
+		}
+	}
+
+	return nil
+}
+
+func (f *fakeIMAPClient) UidCopy(seqset *imap.SeqSet, dest string) error {
+	f.commands = append(f.commands, fmt.Sprintf("copy %s %s", seqset, dest))
+	return nil
+}
+
+func (f *fakeIMAPClient) UidStore(
+	seqset *imap.SeqSet,
+	item imap.StoreItem,
+	value interface{},
+	_ chan *imap.Message,
+) error {
+	f.commands = append(f.commands, fmt.Sprintf("store %s %s %v", seqset, item, value))
+	return nil
+}
+
+func (f *fakeIMAPClient) UidMove(seqset *imap.SeqSet, dest string) error {
+	if f.moveErr != nil {
+		return f.moveErr
+	}
+
+	f.commands = append(f.commands, fmt.Sprintf("move %s %s", seqset, dest))
+	return nil
+}
+
+func newFakeIMAPService(c *fakeIMAPClient) *IMAPService {
+	return &IMAPService{
+		NewImapFunc: func() (IMAPClient, error) { return c, nil },
+	}
+}
+
+func Test_ApplyDispositions(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Groups   []mailservtypes.DispositionGroup
+		Commands []string
+	}{
+		{
+			Name: "move",
+			Groups: []mailservtypes.DispositionGroup{
+				{Disposition: mailservtypes.Disposition{Move: "Processed"}, IDs: []uint32{1, 3}},
+			},
+			Commands: []string{"move 101,103 Processed"},
+		},
+		{
+			Name: "copy flag and move",
+			Groups: []mailservtypes.DispositionGroup{{
+				Disposition: mailservtypes.Disposition{
+					Copy:  "Backup",
+					Move:  "Processed",
+					Flags: []string{"$ToshlSynced"},
+					Seen:  true,
+				},
+				IDs: []uint32{2},
+			}},
+			Commands: []string{
+				"copy 102 Backup",
+				`store 102 +FLAGS.SILENT [$ToshlSynced \Seen]`,
+				"move 102 Processed",
+			},
+		},
+		{
+			Name: "remove flags",
+			Groups: []mailservtypes.DispositionGroup{{
+				Disposition: mailservtypes.Disposition{RemoveFlags: []string{`\Flagged`}},
+				IDs:         []uint32{1},
+			}},
+			Commands: []string{`store 101 -FLAGS.SILENT [\Flagged]`},
+		},
+		{
+			// the first group renumbers the messages in the mailbox, so the
+			// second one only works with UIDs
+			Name: "groups with keywords",
+			Groups: []mailservtypes.DispositionGroup{
+				{Disposition: mailservtypes.Disposition{Move: "Processed"}, IDs: []uint32{1}},
+				{Disposition: mailservtypes.Disposition{Flags: []string{"$ToshlUserNotFound"}}, IDs: []uint32{2, 3}},
+			},
+			Commands: []string{
+				"move 101 Processed",
+				"store 102:103 +FLAGS.SILENT [$ToshlUserNotFound]",
+			},
+		},
+		{
+			Name: "unknown messages",
+			Groups: []mailservtypes.DispositionGroup{
+				{Disposition: mailservtypes.Disposition{Move: "Processed"}, IDs: []uint32{9}},
+			},
+		},
+		{
+			Name: "no messages",
+			Groups: []mailservtypes.DispositionGroup{
+				{Disposition: mailservtypes.Disposition{Move: "Processed"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			c := &fakeIMAPClient{uids: map[uint32]uint32{1: 101, 2: 102, 3: 103}}
+			r := newFakeIMAPService(c)
+
+			require.NoError(t, r.ApplyDispositions(context.Background(), "INBOX", tt.Groups...))
+			assert.Equal(t, tt.Commands, c.commands)
+		})
+	}
+}
+
+func Test_ApplyDispositionsErrors(t *testing.T) {
+	c := &fakeIMAPClient{
+		uids:    map[uint32]uint32{1: 101, 2: 102},
+		moveErr: errs.New("mailbox does not exist"),
+	}
+	r := newFakeIMAPService(c)
+
+	err := r.ApplyDispositions(context.Background(), "INBOX",
+		mailservtypes.DispositionGroup{Disposition: mailservtypes.Disposition{Move: "Missing"}, IDs: []uint32{1}},
+		mailservtypes.DispositionGroup{Disposition: mailservtypes.Disposition{Seen: true}, IDs: []uint32{2}},
+	)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `could not move messages to "Missing"`)
+
+	// the groups after the one that failed are still applied
+	assert.Equal(t, "INBOX", c.selected)
+	assert.Equal(t, []string{`store 102 +FLAGS.SILENT [\Seen]`}, c.commands)
+}
+
+func Test_ApplyDispositionsLoginFailed(t *testing.T) {
+	r := &IMAPService{
+		NewImapFunc: func() (IMAPClient, error) { return nil, errs.New("invalid credentials") },
+	}
+
+	err := r.ApplyDispositions(context.Background(), "INBOX",
+		mailservtypes.DispositionGroup{Disposition: mailservtypes.Disposition{Seen: true}, IDs: []uint32{1}},
+	)
+	assert.True(t, mailservtypes.ErrLogin.Has(err))
+}
@@ -0,0 +1,67 @@
+package mailserv
+
+import (
+	"io"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+// ReadMessage reads a message in RFC 5322 format, such as an .eml file, as if
+// it was fetched with sequence number id. Its envelope is taken from its
+// header.
+func ReadMessage(r io.Reader, id uint32) (mailservtypes.Message, error) {
+	h, msg, err := readMessage(r)
+	if err != nil {
+		return mailservtypes.Message{}, err
+	}
+
+	date, err := h.Date()
+	if err != nil {
+		return mailservtypes.Message{}, errs.New("invalid date: %w", err)
+	}
+
+	subject, err := h.Subject()
+	if err != nil {
+		return mailservtypes.Message{}, errs.New("invalid subject: %w", err)
+	}
+
+	envelope := &imap.Envelope{
+		Date:    date,
+		Subject: subject,
+	}
+	for _, f := range []struct {
+		name string
+		list *[]*imap.Address
+	}{
+		{"From", &envelope.From},
+		{"Sender", &envelope.Sender},
+		{"Reply-To", &envelope.ReplyTo},
+		{"To", &envelope.To},
+		{"Cc", &envelope.Cc},
+	} {
+		addrs, err := h.AddressList(f.name)
+		if err != nil {
+			return mailservtypes.Message{}, errs.New("invalid %s: %w", f.name, err)
+		}
+
+		for _, a := range addrs {
+			mailbox, host, _ := strings.Cut(a.Address, "@")
+			*f.list = append(*f.list, &imap.Address{
+				PersonalName: a.Name,
+				MailboxName:  mailbox,
+				HostName:     host,
+			})
+		}
+	}
+
+	msg.Message = imap.Message{
+		SeqNum:   id,
+		Envelope: envelope,
+	}
+
+	return msg, nil
+}
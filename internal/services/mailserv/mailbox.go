@@ -0,0 +1,216 @@
+package mailserv
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/emersion/go-imap"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+// configDelimiter separates the levels of the mailbox names in the config,
+// it is replaced by the hierarchy delimiter of the server.
+const configDelimiter = "/"
+
+func (r *IMAPService) listMailboxes(
+	ctx context.Context,
+	ref, pattern string,
+) ([]mailservtypes.Mailbox, error) {
+	c, err := r.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	rawMailboxes := make(chan *imap.MailboxInfo)
+	errCh := make(chan error)
+	go func() {
+		defer close(errCh)
+		errCh <- c.List(ref, pattern, rawMailboxes)
+	}()
+
+	var (
+		mailboxes []mailservtypes.Mailbox
+		ok        bool
+	)
+	ok = true
+	for ok {
+		var m *imap.MailboxInfo
+
+		select {
+		case <-ctx.Done():
+			return nil, errs.Wrap(ctx.Err())
+
+		case err := <-errCh:
+			if err != nil {
+				return nil, errs.Wrap(err)
+			}
+
+		case m, ok = <-rawMailboxes:
+		}
+
+		if m != nil {
+			mailboxes = append(mailboxes, mailservtypes.Mailbox{
+				Name:       m.Name,
+				Delimiter:  m.Delimiter,
+				Attributes: m.Attributes,
+			})
+		}
+	}
+
+	return mailboxes, nil
+}
+
+func (r *IMAPService) GetMailboxes(ctx context.Context) ([]mailservtypes.Mailbox, error) {
+	return r.listMailboxes(ctx, "", "*")
+}
+
+func (r *IMAPService) GetAvailableMailboxes(
+	ctx context.Context,
+) ([]string, error) {
+	mailboxes, err := r.GetMailboxes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(mailboxes))
+	for _, m := range mailboxes {
+		names = append(names, m.Name)
+	}
+
+	return names, nil
+}
+
+// getDelimiter asks for the hierarchy delimiter of the server, which is
+// empty when the server has a flat hierarchy.
+func (r *IMAPService) getDelimiter(ctx context.Context) (string, error) {
+	root, err := r.listMailboxes(ctx, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	if len(root) == 0 {
+		return "", nil
+	}
+
+	return root[0].Delimiter, nil
+}
+
+// IsSpecialUse tells whether name is a SPECIAL-USE attribute such as
+// \Archive or \Junk, instead of the name of a mailbox.
+func IsSpecialUse(name string) bool {
+	return strings.HasPrefix(name, `\`)
+}
+
+func serverName(name, delimiter string) string {
+	if delimiter == "" || delimiter == configDelimiter {
+		return name
+	}
+
+	return strings.ReplaceAll(name, configDelimiter, delimiter)
+}
+
+// ResolveMailbox returns the name in the server of a mailbox from the config,
+// see FindMailbox.
+func (r *IMAPService) ResolveMailbox(ctx context.Context, name string) (string, error) {
+	mailboxes, err := r.GetMailboxes(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	return FindMailbox(mailboxes, name)
+}
+
+// FindMailbox returns the name in mailboxes of a mailbox from the config. It
+// can be a SPECIAL-USE attribute, in which case the mailbox with that
+// attribute is returned, or a name with levels separated by "/" or by the
+// delimiter of the server.
+func FindMailbox(mailboxes []mailservtypes.Mailbox, name string) (string, error) {
+	if IsSpecialUse(name) {
+		for _, m := range mailboxes {
+			if slices.ContainsFunc(m.Attributes, func(attr string) bool {
+				return strings.EqualFold(attr, name)
+			}) {
+				return m.Name, nil
+			}
+		}
+
+		return "", mailservtypes.ErrMailboxNotFound.New("there is no mailbox with the attribute %s", name)
+	}
+
+	var delimiter string
+	candidates := []string{name}
+	for _, m := range mailboxes {
+		if m.Delimiter != "" {
+			delimiter = m.Delimiter
+			break
+		}
+	}
+	if translated := serverName(name, delimiter); translated != name {
+		candidates = append(candidates, translated)
+	}
+
+	for _, c := range candidates {
+		for _, m := range mailboxes {
+			// INBOX is case-insensitive
+			if m.Name == c || strings.EqualFold(c, "INBOX") && strings.EqualFold(m.Name, "INBOX") {
+				return m.Name, nil
+			}
+		}
+	}
+
+	return "", mailservtypes.ErrMailboxNotFound.New("%s", name)
+}
+
+// CreateMailbox creates a mailbox from the config along with its missing
+// parents, and returns its name in the server. SPECIAL-USE mailboxes can not
+// be created, they have to exist already.
+func (r *IMAPService) CreateMailbox(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		return "", errs.New("mailbox name should not be empty")
+	}
+
+	if IsSpecialUse(name) {
+		return r.ResolveMailbox(ctx, name)
+	}
+
+	delimiter, err := r.getDelimiter(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	existing, err := r.GetAvailableMailboxes(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	full := serverName(name, delimiter)
+	levels := []string{full}
+	if delimiter != "" {
+		levels = strings.Split(full, delimiter)
+	}
+
+	c, err := r.getClient()
+	if err != nil {
+		return "", err
+	}
+
+	for i := range levels {
+		mailbox := full
+		if delimiter != "" {
+			mailbox = strings.Join(levels[:i+1], delimiter)
+		}
+
+		if mailbox == "" || strings.EqualFold(mailbox, "INBOX") || slices.Contains(existing, mailbox) {
+			continue
+		}
+
+		if err := c.Create(mailbox); err != nil {
+			return "", errs.New("could not create mailbox %q: %w", mailbox, err)
+		}
+	}
+
+	return full, nil
+}
@@ -0,0 +1,136 @@
+package mailserv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+func newMailboxClient(delimiter string, names ...string) *fakeIMAPClient {
+	c := &fakeIMAPClient{delimiter: delimiter}
+	for _, name := range names {
+		c.mailboxes = append(c.mailboxes, &imap.MailboxInfo{Name: name, Delimiter: delimiter})
+	}
+
+	return c
+}
+
+func Test_ResolveMailbox(t *testing.T) {
+	dotted := newMailboxClient(".", "INBOX", "INBOX.Toshl", "INBOX.Toshl.Processed")
+	slashed := newMailboxClient("/", "INBOX", "Toshl", "Toshl/Processed")
+	flat := newMailboxClient("", "INBOX", "Processed", "Toshl/Failed")
+
+	special := newMailboxClient("/", "INBOX", "Archive")
+	special.mailboxes[1].Attributes = []string{`\HasNoChildren`, `\Archive`}
+
+	tests := []struct {
+		Name    string
+		Client  *fakeIMAPClient
+		Mailbox string
+		Want    string
+	}{
+		{Name: "dot delimiter", Client: dotted, Mailbox: "INBOX/Toshl/Processed", Want: "INBOX.Toshl.Processed"},
+		{Name: "dot delimiter in the config", Client: dotted, Mailbox: "INBOX.Toshl.Processed", Want: "INBOX.Toshl.Processed"},
+		{Name: "dot delimiter missing", Client: dotted, Mailbox: "Toshl/Processed"},
+		{Name: "slash delimiter", Client: slashed, Mailbox: "Toshl/Processed", Want: "Toshl/Processed"},
+		{Name: "inbox", Client: slashed, Mailbox: "inbox", Want: "INBOX"},
+		{Name: "flat", Client: flat, Mailbox: "Processed", Want: "Processed"},
+		{Name: "flat with slash in the name", Client: flat, Mailbox: "Toshl/Failed", Want: "Toshl/Failed"},
+		{Name: "special use", Client: special, Mailbox: `\Archive`, Want: "Archive"},
+		{Name: "special use case", Client: special, Mailbox: `\archive`, Want: "Archive"},
+		{Name: "special use missing", Client: slashed, Mailbox: `\Archive`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			r := newFakeIMAPService(tt.Client)
+
+			got, err := r.ResolveMailbox(context.Background(), tt.Mailbox)
+			if tt.Want == "" {
+				assert.True(t, mailservtypes.ErrMailboxNotFound.Has(err), "unexpected error %v", err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.Want, got)
+		})
+	}
+}
+
+func Test_CreateMailbox(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Client  *fakeIMAPClient
+		Mailbox string
+		Want    string
+		Created []string
+	}{
+		{
+			Name:    "dot delimiter under inbox",
+			Client:  newMailboxClient(".", "INBOX"),
+			Mailbox: "INBOX/Toshl/Processed",
+			Want:    "INBOX.Toshl.Processed",
+			Created: []string{"INBOX.Toshl", "INBOX.Toshl.Processed"},
+		},
+		{
+			Name:    "inbox is not created",
+			Client:  newMailboxClient(".", "inbox"),
+			Mailbox: "INBOX/Processed",
+			Want:    "INBOX.Processed",
+			Created: []string{"INBOX.Processed"},
+		},
+		{
+			Name:    "slash delimiter",
+			Client:  newMailboxClient("/", "INBOX"),
+			Mailbox: "Toshl/Processed",
+			Want:    "Toshl/Processed",
+			Created: []string{"Toshl", "Toshl/Processed"},
+		},
+		{
+			Name:    "existing parent",
+			Client:  newMailboxClient("/", "INBOX", "Toshl"),
+			Mailbox: "Toshl/Processed",
+			Want:    "Toshl/Processed",
+			Created: []string{"Toshl/Processed"},
+		},
+		{
+			Name:    "flat",
+			Client:  newMailboxClient("", "INBOX"),
+			Mailbox: "Toshl/Processed",
+			Want:    "Toshl/Processed",
+			Created: []string{"Toshl/Processed"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			r := newFakeIMAPService(tt.Client)
+
+			got, err := r.CreateMailbox(context.Background(), tt.Mailbox)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Want, got)
+			assert.Equal(t, tt.Created, tt.Client.created)
+
+			resolved, err := r.ResolveMailbox(context.Background(), tt.Mailbox)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Want, resolved)
+		})
+	}
+}
+
+func Test_CreateSpecialUseMailbox(t *testing.T) {
+	c := newMailboxClient("/", "INBOX", "Archive")
+	r := newFakeIMAPService(c)
+
+	_, err := r.CreateMailbox(context.Background(), `\Archive`)
+	assert.True(t, mailservtypes.ErrMailboxNotFound.Has(err))
+	assert.Empty(t, c.created)
+
+	_, err = r.CreateMailbox(context.Background(), "")
+	assert.Error(t, err)
+}
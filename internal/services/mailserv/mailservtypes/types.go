@@ -5,17 +5,73 @@ import (
 	"time"
 
 	"github.com/emersion/go-imap"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
 )
 
+// ErrMailboxNotFound is returned when a mailbox, or the mailbox with a
+// SPECIAL-USE attribute, does not exist.
+var ErrMailboxNotFound = errs.Class("mailbox not found")
+
+// ErrLogin is returned when there is no client to reach the server with,
+// such as when the credentials are wrong.
+var ErrLogin = errs.Class("imap login")
+
+// Mailbox is a mailbox as listed by the server.
+type Mailbox struct {
+	Name       string
+	Delimiter  string
+	Attributes []string
+}
+
+// ProcessedKeyword marks the messages that were already synced, so that they
+// can be kept in the inbox without being processed again.
+const ProcessedKeyword = "$ToshlSynced"
+
+// Disposition is what is done with a message once it was processed, an empty
+// one leaves it untouched.
+type Disposition struct {
+	// Copy and Move are the mailboxes the message is copied or moved to
+	Copy string `json:"copy,omitempty"`
+	Move string `json:"move,omitempty"`
+	// Flags are keywords such as $ToshlSynced or system flags such as
+	// \Flagged to add to the message
+	Flags       []string `json:"flags,omitempty"`
+	RemoveFlags []string `json:"remove_flags,omitempty"`
+	Seen        bool     `json:"seen,omitempty"`
+}
+
+// IsZero tells whether the disposition leaves messages untouched.
+func (d Disposition) IsZero() bool {
+	return d.Copy == "" && d.Move == "" && len(d.Flags) == 0 && len(d.RemoveFlags) == 0 && !d.Seen
+}
+
+// DispositionGroup is a disposition with the messages it applies to.
+type DispositionGroup struct {
+	Disposition
+	IDs []uint32
+}
+
 type Message struct {
 	imap.Message
-	BodyData []byte
+	// RawBodyData is the text part as it was received, BodyData is that same
+	// part converted to normalized plain text
+	RawBodyData     []byte
+	BodyData        []byte
+	AttachmentsData []banktypes.Attachment
 }
 
 func (m Message) ID() uint32 {
 	return m.Message.SeqNum
 }
 
+// MessageID is the Message-ID header, which unlike the ID stays the same when
+// the message is moved or other messages are expunged.
+func (m Message) MessageID() string {
+	return m.Message.Envelope.MessageId
+}
+
 func (m Message) From() []string {
 	addrs := m.Message.Envelope.From
 	from := make([]string, 0, len(addrs))
@@ -80,6 +136,14 @@ func (m Message) Body() []byte {
 	return m.BodyData
 }
 
+func (m Message) RawBody() []byte {
+	return m.RawBodyData
+}
+
+func (m Message) Attachments() []banktypes.Attachment {
+	return m.AttachmentsData
+}
+
 func (m Message) MarshalText() ([]byte, error) {
 	s := fmt.Sprintf("%d - %s", m.ID(), m.Subject())
 	return []byte(s), nil
@@ -0,0 +1,64 @@
+package mailserv
+
+import (
+	"time"
+
+	"github.com/emersion/go-imap"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
+)
+
+// instrumentedClient records the duration of every IMAP command.
+type instrumentedClient struct {
+	IMAPClient
+}
+
+func (c instrumentedClient) List(ref string, name string, ch chan *imap.MailboxInfo) error {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("list"), time.Now())
+	return c.IMAPClient.List(ref, name, ch)
+}
+
+func (c instrumentedClient) Select(name string, readOnly bool) (*imap.MailboxStatus, error) {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("select"), time.Now())
+	return c.IMAPClient.Select(name, readOnly)
+}
+
+func (c instrumentedClient) Search(criteria *imap.SearchCriteria) ([]uint32, error) {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("search"), time.Now())
+	return c.IMAPClient.Search(criteria)
+}
+
+func (c instrumentedClient) Fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("fetch"), time.Now())
+	return c.IMAPClient.Fetch(seqset, items, ch)
+}
+
+func (c instrumentedClient) UidCopy(seqset *imap.SeqSet, dest string) error {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("copy"), time.Now())
+	return c.IMAPClient.UidCopy(seqset, dest)
+}
+
+func (c instrumentedClient) UidStore(
+	seqset *imap.SeqSet,
+	item imap.StoreItem,
+	value interface{},
+	ch chan *imap.Message,
+) error {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("store"), time.Now())
+	return c.IMAPClient.UidStore(seqset, item, value, ch)
+}
+
+func (c instrumentedClient) UidMove(seqset *imap.SeqSet, dest string) error {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("move"), time.Now())
+	return c.IMAPClient.UidMove(seqset, dest)
+}
+
+func (c instrumentedClient) Move(seqset *imap.SeqSet, dest string) error {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("move"), time.Now())
+	return c.IMAPClient.Move(seqset, dest)
+}
+
+func (c instrumentedClient) Create(name string) error {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("create"), time.Now())
+	return c.IMAPClient.Create(name)
+}
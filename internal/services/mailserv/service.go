@@ -1,6 +1,7 @@
 package mailserv
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"runtime"
@@ -10,11 +11,15 @@ import (
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-message/mail"
 	"github.com/zeebo/errs"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/result"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilslices"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utiltext"
 )
 
 type IMAPClient interface {
@@ -22,98 +27,70 @@ type IMAPClient interface {
 	Select(name string, readOnly bool) (*imap.MailboxStatus, error)
 	Search(criteria *imap.SearchCriteria) (seqNums []uint32, err error)
 	Fetch(seqset *imap.SeqSet, items []imap.FetchItem, ch chan *imap.Message) error
-	// Copy(seqset *imap.SeqSet, dest string) error
-	// UidStore(*imap.SeqSet, imap.StoreItem, interface{}, chan *imap.Message) error
+	UidCopy(seqset *imap.SeqSet, dest string) error
+	UidStore(seqset *imap.SeqSet, item imap.StoreItem, value interface{}, ch chan *imap.Message) error
 	Move(seqset *imap.SeqSet, dest string) error
+	UidMove(seqset *imap.SeqSet, dest string) error
+	Create(name string) error
 }
 
 type MessageErr result.ConcreteResult[mailservtypes.Message]
 
 type IMAPService struct {
-	NewImapFunc func() IMAPClient
+	NewImapFunc func() (IMAPClient, error)
 
-	poolOnce sync.Once
-	clPool   sync.Pool
+	clPool sync.Pool
 }
 
-func (r *IMAPService) getClient() IMAPClient {
-	r.poolOnce.Do(func() {
-		f := func() any {
-			return r.NewImapFunc()
-		}
-		r.clPool = sync.Pool{
-			New: f,
-		}
-	})
-
-	cl := r.clPool.Get()
-	if cl == nil {
-		log := logging.New()
-		defer func() { _ = log.Sync() }()
-
-		log.Panic("could not create imap client")
+func (r *IMAPService) getClient() (IMAPClient, error) {
+	if cl, ok := r.clPool.Get().(IMAPClient); ok {
+		return instrumentedClient{cl}, nil
 	}
 
-	return cl.(IMAPClient)
-}
-
-func (r *IMAPService) GetAvailableMailboxes(
-	ctx context.Context,
-) ([]string, error) {
-	rawMailboxes := make(chan *imap.MailboxInfo)
-	errCh := make(chan error)
-	go func() {
-		defer close(errCh)
-		errCh <- r.getClient().List("", "*", rawMailboxes)
-	}()
-
-	var (
-		mailboxes []string
-		ok        bool
-	)
-	ok = true
-	for ok {
-		var m *imap.MailboxInfo
-
-		select {
-		case <-ctx.Done():
-			return nil, errs.Wrap(ctx.Err())
-
-		case err := <-errCh:
-			if err != nil {
-				return nil, errs.Wrap(err)
-			}
-
-		case m, ok = <-rawMailboxes:
-		}
-
-		if m != nil {
-			name := m.Name
-			mailboxes = append(mailboxes, name)
-		}
+	cl, err := r.NewImapFunc()
+	if err != nil {
+		return nil, mailservtypes.ErrLogin.New("could not create imap client: %w", err)
 	}
 
-	return mailboxes, nil
+	return instrumentedClient{cl}, nil
 }
 
 func (r *IMAPService) GetMessagesFromMailbox(
 	ctx context.Context,
 	mailbox string,
 	since time.Time,
-) (<-chan result.Result[mailservtypes.Message], error) {
-	client := r.getClient()
+	skipFlags ...string,
+) (_ <-chan result.Result[mailservtypes.Message], genErr error) {
+	ctx, span := tracing.Start(ctx, "GetMessagesFromMailbox",
+		attribute.String("mailbox", mailbox),
+		attribute.String("since", since.Format(time.RFC3339)),
+	)
+	// the span lasts until every message was sent
+	streaming := false
+	defer func() {
+		if !streaming {
+			tracing.End(span, genErr)
+		}
+	}()
+
+	client, err := r.getClient()
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := client.Select(mailbox, true)
+	_, err = client.Select(mailbox, true)
 	if err != nil {
 		return nil, errs.Wrap(err)
 	}
 
 	criteria := imap.NewSearchCriteria()
 	criteria.Since = since
+	criteria.WithoutFlags = skipFlags
 	ids, err := client.Search(criteria)
 	if err != nil {
 		return nil, errs.Wrap(err)
 	}
+	span.SetAttributes(attribute.Int("messages", len(ids)))
 
 	log := logging.New()
 	log.Debug("got messages since a date",
@@ -176,7 +153,9 @@ func (r *IMAPService) GetMessagesFromMailbox(
 		)
 	}
 
+	streaming = true
 	go func() {
+		defer span.End()
 		defer cancel()
 		defer close(msgs)
 		wg.Wait()
@@ -190,9 +169,12 @@ func (r *IMAPService) getMessagesFromMailbox(
 	mailbox string,
 	ids ...uint32,
 ) (<-chan result.Result[mailservtypes.Message], error) {
-	client := r.getClient()
+	client, err := r.getClient()
+	if err != nil {
+		return nil, err
+	}
 
-	_, err := client.Select(mailbox, true)
+	_, err = client.Select(mailbox, true)
 	if err != nil {
 		return nil, errs.Wrap(err)
 	}
@@ -296,36 +278,96 @@ func (r *IMAPService) getCompleteMessage(
 	if t == nil {
 		return mailservtypes.Message{}, errs.New("msg has no body")
 	}
+
+	_, complete, err := readMessage(t)
+	if err != nil {
+		return mailservtypes.Message{}, err
+	}
+	complete.Message = *msg
+
+	return complete, nil
+}
+
+// readMessage reads the header, text and attachments of a whole message, the
+// returned message has no IMAP data.
+func readMessage(t io.Reader) (mail.Header, mailservtypes.Message, error) {
 	mr, err := mail.CreateReader(t)
 	if err != nil && mr == nil {
-		return mailservtypes.Message{}, errs.New("could not create reader: %w", err)
+		return mail.Header{}, mailservtypes.Message{}, errs.New("could not create reader: %w", err)
 	}
 	defer func() { _ = mr.Close() }()
 
-	var body []byte
-	for body == nil {
+	var (
+		plain, htmlBody []byte
+		attachments     []banktypes.Attachment
+	)
+	for {
 		p, err := mr.NextPart()
 		if err == io.EOF {
 			break
 		}
+		if err != nil && p == nil {
+			return mail.Header{}, mailservtypes.Message{}, errs.New("could not read message part: %w", err)
+		}
 
-		switch p.Header.(type) {
+		switch h := p.Header.(type) {
 		case *mail.InlineHeader:
 			// This is the message's text (can be plain-text or HTML)
-			body, err = io.ReadAll(p.Body)
+			contentType, _, _ := h.ContentType()
+			data, err := io.ReadAll(p.Body)
+			if err != nil {
+				return mail.Header{}, mailservtypes.Message{}, errs.New("could not read from InlineHeader body: %w", err)
+			}
+
+			switch {
+			case contentType == "text/html":
+				if htmlBody == nil {
+					htmlBody = data
+				}
+			case contentType == "text/plain", contentType == "":
+				if plain == nil {
+					plain = data
+				}
+			}
+
+		case *mail.AttachmentHeader:
+			filename, _ := h.Filename()
+			contentType, _, _ := h.ContentType()
+			data, err := io.ReadAll(p.Body)
 			if err != nil {
-				return mailservtypes.Message{}, errs.New("could not read from InlineHeader body: %w", err)
+				return mail.Header{}, mailservtypes.Message{}, errs.New("could not read attachment %q: %w", filename, err)
 			}
+
+			attachments = append(attachments, banktypes.Attachment{
+				Filename:    filename,
+				ContentType: contentType,
+				Data:        data,
+			})
 		}
 	}
 
-	if body == nil {
-		return mailservtypes.Message{}, errs.New("no body found in msg")
+	var raw []byte
+	var text string
+	switch {
+	case plain != nil:
+		raw = plain
+		text = string(plain)
+
+	case htmlBody != nil:
+		raw = htmlBody
+		text, err = utiltext.HTMLToText(bytes.NewReader(htmlBody))
+		if err != nil {
+			return mail.Header{}, mailservtypes.Message{}, errs.New("could not convert html body to text: %w", err)
+		}
+
+	case len(attachments) == 0:
+		return mail.Header{}, mailservtypes.Message{}, errs.New("no body found in msg")
 	}
 
-	return mailservtypes.Message{
-		Message:  *msg,
-		BodyData: body,
+	return mr.Header, mailservtypes.Message{
+		RawBodyData:     raw,
+		BodyData:        []byte(utiltext.Normalize(text)),
+		AttachmentsData: attachments,
 	}, nil
 }
 
@@ -343,8 +385,12 @@ func (r *IMAPService) MoveMessagesToMailbox(
 	seqset := new(imap.SeqSet)
 	seqset.AddNum(msgIDs...)
 
-	c := r.getClient()
-	_, err := c.Select(fromMailbox, false)
+	c, err := r.getClient()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.Select(fromMailbox, false)
 	if err != nil {
 		return errs.Wrap(err)
 	}
@@ -3,19 +3,32 @@ package notificationserv
 import (
 	"context"
 
+	"github.com/zeebo/errs"
+	"go.opentelemetry.io/otel/attribute"
+
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/external/twilio/twiliotypes"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
 )
 
 type smsClient interface {
 	SendMessage(toNumber, sms string) (twiliotypes.APIResponse, error)
 }
 
+// credentialChecker is implemented by the SMS clients that can validate
+// their credentials without sending a message.
+type credentialChecker interface {
+	CheckCredentials() error
+}
+
 type NotificationService struct {
 	SMSClient smsClient
 }
 
-func (n *NotificationService) SendSMS(ctx context.Context, to, msg string) error {
+func (n *NotificationService) SendSMS(ctx context.Context, to, msg string) (genErr error) {
+	ctx, span := tracing.Start(ctx, "SendSMS", attribute.Int("msg_len", len(msg)))
+	defer func() { tracing.End(span, genErr) }()
+
 	log := logging.FromContext(ctx)
 
 	r, err := n.SMSClient.SendMessage(to, msg)
@@ -33,6 +46,16 @@ func (n *NotificationService) SendSMS(ctx context.Context, to, msg string) error
 	return err
 }
 
+// CheckSMS validates the credentials of the SMS client.
+func (n *NotificationService) CheckSMS(_ context.Context) error {
+	checker, ok := n.SMSClient.(credentialChecker)
+	if !ok {
+		return errs.New("sms client can not check its credentials")
+	}
+
+	return checker.CheckCredentials()
+}
+
 func (n *NotificationService) SendMail(ctx context.Context, email string) error {
 	log := logging.FromContext(ctx)
 
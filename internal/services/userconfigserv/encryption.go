@@ -0,0 +1,369 @@
+package userconfigserv
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/zeebo/errs"
+)
+
+const (
+	// encryptedPrefix marks the values that are encrypted with the data key
+	// of their user config
+	encryptedPrefix = "enc:v1:"
+
+	localKeyPrefix = "local:"
+	kmsKeyPrefix   = "kms:"
+
+	keySize = 32
+)
+
+var ErrEncryption = errs.Class("user config encryption")
+
+// EncryptionConfig has the master key that encrypts the data keys of the
+// user configs, a local key or a KMS key. Tokens and phone numbers are stored
+// in cleartext when neither is set.
+type EncryptionConfig struct {
+	// MasterKey is a base64 encoded 32 byte key
+	MasterKey string `json:"master_key" secret:"true"`
+	// PreviousMasterKey still decrypts the configs that have not been
+	// re-encrypted since MasterKey was rotated
+	PreviousMasterKey string `json:"previous_master_key" secret:"true"`
+	// KMSKeyID encrypts the data keys with KMS instead of MasterKey
+	KMSKeyID string `json:"kms_key_id"`
+}
+
+// MasterKeys wrap and unwrap the data keys of the user configs. The data keys
+// that were wrapped by KMS are unwrapped with KMS even when only local keys
+// are configured, so that the configs can be migrated out of it.
+type MasterKeys struct {
+	// Local keys by their ID, Current wraps the new data keys unless there is
+	// a KMSKeyID
+	Local    map[string][]byte
+	Current  string
+	KMSKeyID string
+	Region   string
+
+	once    sync.Once
+	client  *kms.Client
+	loadErr error
+}
+
+// NewMasterKeys returns the master keys of cfg, or nil when the user configs
+// are not encrypted.
+func NewMasterKeys(cfg EncryptionConfig, region string) (*MasterKeys, error) {
+	if cfg.MasterKey == "" && cfg.KMSKeyID == "" {
+		return nil, nil
+	}
+
+	keys := &MasterKeys{
+		Local:    make(map[string][]byte),
+		KMSKeyID: cfg.KMSKeyID,
+		Region:   region,
+	}
+
+	for i, encoded := range []string{cfg.MasterKey, cfg.PreviousMasterKey} {
+		if encoded == "" {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, ErrEncryption.New("master key is not base64: %w", err)
+		}
+		if len(key) != keySize {
+			return nil, ErrEncryption.New("master key should have %d bytes, it has %d", keySize, len(key))
+		}
+
+		id := keyID(key)
+		keys.Local[id] = key
+		if i == 0 {
+			keys.Current = id
+		}
+	}
+
+	return keys, nil
+}
+
+// keyID identifies a local key in the data keys it wraps, without revealing
+// it.
+func keyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+func (k *MasterKeys) kmsClient(ctx context.Context) (*kms.Client, error) {
+	k.once.Do(func() {
+		var cfg aws.Config
+		cfg, k.loadErr = config.LoadDefaultConfig(ctx, config.WithRegion(k.Region))
+		k.client = kms.NewFromConfig(cfg)
+	})
+
+	return k.client, ErrEncryption.Wrap(k.loadErr)
+}
+
+// encryptionContext binds the data keys wrapped by KMS to this table.
+var encryptionContext = map[string]string{"table": table}
+
+func (k *MasterKeys) WrapKey(ctx context.Context, key []byte) (string, error) {
+	if k.KMSKeyID != "" {
+		client, err := k.kmsClient(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		out, err := client.Encrypt(ctx, &kms.EncryptInput{
+			KeyId:             aws.String(k.KMSKeyID),
+			Plaintext:         key,
+			EncryptionContext: encryptionContext,
+		})
+		if err != nil {
+			return "", ErrEncryption.New("could not wrap data key with kms: %w", err)
+		}
+
+		return kmsKeyPrefix + base64.StdEncoding.EncodeToString(out.CiphertextBlob), nil
+	}
+
+	sealed, err := seal(k.Local[k.Current], key, localKeyPrefix)
+	if err != nil {
+		return "", err
+	}
+
+	return localKeyPrefix + k.Current + ":" + sealed, nil
+}
+
+func (k *MasterKeys) UnwrapKey(ctx context.Context, wrapped string) ([]byte, error) {
+	if blob, ok := strings.CutPrefix(wrapped, kmsKeyPrefix); ok {
+		raw, err := base64.StdEncoding.DecodeString(blob)
+		if err != nil {
+			return nil, ErrEncryption.Wrap(err)
+		}
+
+		client, err := k.kmsClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		out, err := client.Decrypt(ctx, &kms.DecryptInput{
+			CiphertextBlob:    raw,
+			EncryptionContext: encryptionContext,
+		})
+		if err != nil {
+			return nil, ErrEncryption.New("could not unwrap data key with kms: %w", err)
+		}
+
+		return out.Plaintext, nil
+	}
+
+	rest, ok := strings.CutPrefix(wrapped, localKeyPrefix)
+	if !ok {
+		return nil, ErrEncryption.New("unknown data key format")
+	}
+
+	id, sealed, _ := strings.Cut(rest, ":")
+	master, ok := k.Local[id]
+	if !ok {
+		return nil, ErrEncryption.New("data key was wrapped by unknown master key %s", id)
+	}
+
+	key, err := open(master, sealed, localKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(key), nil
+}
+
+// seal encrypts plaintext with AES-GCM, aad has to be the same to open it.
+func seal(key []byte, plaintext []byte, aad string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize(), gcm.NonceSize()+len(plaintext)+gcm.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", ErrEncryption.Wrap(err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(aad))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func open(key []byte, sealed string, aad string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", ErrEncryption.Wrap(err)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	if len(raw) < gcm.NonceSize() {
+		return "", ErrEncryption.New("ciphertext is too short")
+	}
+
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(aad))
+	if err != nil {
+		return "", ErrEncryption.New("could not decrypt: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, ErrEncryption.Wrap(err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	return gcm, ErrEncryption.Wrap(err)
+}
+
+// storedConfig is a user config as it is in the table, its tokens and phone
+// number are encrypted with DataKey, which is wrapped by a master key.
+type storedConfig struct {
+	UserConfig
+	DataKey string `dynamodbav:"DataKey,omitempty"`
+}
+
+// encryptedFields are the values of a user config that are encrypted, by the
+// name that is authenticated along with them.
+func encryptedFields(cfg *UserConfig) map[string]*string {
+	return map[string]*string{
+		"SMSDeliveryNumber": &cfg.SMSDeliveryNumber,
+		"Toshl.Token":       &cfg.Toshl.Token,
+		"Backend.Token":     &cfg.Backend.Token,
+	}
+}
+
+func (r *DynamoDBService) encrypt(ctx context.Context, cfg UserConfig) (storedConfig, error) {
+	if r.Keys == nil {
+		return storedConfig{UserConfig: cfg}, nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return storedConfig{}, ErrEncryption.Wrap(err)
+	}
+
+	wrapped, err := r.Keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return storedConfig{}, err
+	}
+
+	stored := storedConfig{UserConfig: cfg, DataKey: wrapped}
+	for name, field := range encryptedFields(&stored.UserConfig) {
+		if *field == "" {
+			continue
+		}
+
+		sealed, err := seal(dataKey, []byte(*field), cfg.Email+"/"+name)
+		if err != nil {
+			return storedConfig{}, err
+		}
+		*field = encryptedPrefix + sealed
+	}
+
+	return stored, nil
+}
+
+func (r *DynamoDBService) decrypt(ctx context.Context, stored storedConfig) (UserConfig, error) {
+	cfg := stored.UserConfig
+	fields := encryptedFields(&cfg)
+
+	if stored.DataKey == "" {
+		for name, field := range fields {
+			if strings.HasPrefix(*field, encryptedPrefix) {
+				return UserConfig{}, ErrEncryption.New("%s of %s is encrypted but there is no data key", name, cfg.Email)
+			}
+		}
+		return cfg, nil
+	}
+
+	if r.Keys == nil {
+		return UserConfig{}, ErrEncryption.New("config of %s is encrypted but there is no master key", cfg.Email)
+	}
+
+	dataKey, err := r.Keys.UnwrapKey(ctx, stored.DataKey)
+	if err != nil {
+		return UserConfig{}, ErrEncryption.New("config of %s: %w", cfg.Email, err)
+	}
+
+	for name, field := range fields {
+		sealed, ok := strings.CutPrefix(*field, encryptedPrefix)
+		if !ok {
+			continue
+		}
+
+		value, err := open(dataKey, sealed, cfg.Email+"/"+name)
+		if err != nil {
+			return UserConfig{}, ErrEncryption.New("%s of %s: %w", name, cfg.Email, err)
+		}
+		*field = value
+	}
+
+	return cfg, nil
+}
+
+// ReencryptUserConfigs encrypts every user config with a new data key wrapped
+// by the current master key, which encrypts the configs that were stored in
+// cleartext and the ones wrapped by a previous key. It returns how many
+// configs were, or would be when dryRun is set, re-encrypted.
+func (r *DynamoDBService) ReencryptUserConfigs(ctx context.Context, dryRun bool) (int, error) {
+	if r.Keys == nil {
+		return 0, ErrEncryption.New("there is no master key to encrypt the user configs with")
+	}
+
+	items, err := r.scan(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		group errs.Group
+		count int
+	)
+	for _, it := range items {
+		if err := ctx.Err(); err != nil {
+			group.Add(errs.Wrap(err))
+			break
+		}
+
+		cfg, err := r.decrypt(ctx, it)
+		if err != nil {
+			group.Add(err)
+			continue
+		}
+
+		if !dryRun {
+			stored, err := r.encrypt(ctx, cfg)
+			if err != nil {
+				group.Add(err)
+				continue
+			}
+
+			if err := r.put(ctx, stored); err != nil {
+				group.Add(errs.New("could not save config of %s: %w", cfg.Email, err))
+				continue
+			}
+		}
+		count++
+	}
+
+	return count, group.Err()
+}
@@ -0,0 +1,105 @@
+package userconfigserv
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMasterKey(t *testing.T) string {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func Test_Encryption(t *testing.T) {
+	ctx := context.Background()
+
+	oldKey, newKey := newMasterKey(t), newMasterKey(t)
+
+	keys, err := NewMasterKeys(EncryptionConfig{MasterKey: oldKey}, "us-east-1")
+	require.NoError(t, err)
+
+	cfg := UserConfig{
+		Email:             "user@example.com",
+		SMSDeliveryNumber: "+573001234567",
+		Toshl:             ToshlConfig{Token: "toshl-token"},
+		APIKeyHashes:      []string{HashAPIKey("key")},
+	}
+
+	r := &DynamoDBService{Keys: keys}
+	stored, err := r.encrypt(ctx, cfg)
+	require.NoError(t, err)
+
+	assert.Equal(t, "toshl-token", cfg.Toshl.Token, "the original config should not change")
+	assert.True(t, strings.HasPrefix(stored.Toshl.Token, encryptedPrefix))
+	assert.True(t, strings.HasPrefix(stored.SMSDeliveryNumber, encryptedPrefix))
+	assert.Empty(t, stored.Backend.Token)
+	assert.Equal(t, cfg.APIKeyHashes, stored.APIKeyHashes)
+
+	// the data key is stored next to the config
+	item, err := attributevalue.MarshalMap(stored)
+	require.NoError(t, err)
+	assert.Contains(t, item, "DataKey")
+	assert.Contains(t, item, "Email")
+
+	var read storedConfig
+	require.NoError(t, attributevalue.UnmarshalMap(item, &read))
+
+	decrypted, err := r.decrypt(ctx, read)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, decrypted)
+
+	// values can not be moved to another field or user
+	swapped := read
+	swapped.Toshl.Token = read.SMSDeliveryNumber
+	_, err = r.decrypt(ctx, swapped)
+	assert.Error(t, err)
+
+	swapped = read
+	swapped.Email = "other@example.com"
+	_, err = r.decrypt(ctx, swapped)
+	assert.Error(t, err)
+
+	// after a rotation the previous key still decrypts
+	rotated, err := NewMasterKeys(EncryptionConfig{MasterKey: newKey, PreviousMasterKey: oldKey}, "us-east-1")
+	require.NoError(t, err)
+
+	decrypted, err = (&DynamoDBService{Keys: rotated}).decrypt(ctx, read)
+	require.NoError(t, err)
+	assert.Equal(t, cfg, decrypted)
+
+	onlyNew, err := NewMasterKeys(EncryptionConfig{MasterKey: newKey}, "us-east-1")
+	require.NoError(t, err)
+
+	_, err = (&DynamoDBService{Keys: onlyNew}).decrypt(ctx, read)
+	assert.Error(t, err)
+
+	_, err = (&DynamoDBService{}).decrypt(ctx, read)
+	assert.Error(t, err)
+
+	// configs stored in cleartext are read as they are
+	plain, err := (&DynamoDBService{Keys: keys}).decrypt(ctx, storedConfig{UserConfig: cfg})
+	require.NoError(t, err)
+	assert.Equal(t, cfg, plain)
+}
+
+func Test_NewMasterKeys(t *testing.T) {
+	keys, err := NewMasterKeys(EncryptionConfig{}, "us-east-1")
+	require.NoError(t, err)
+	assert.Nil(t, keys)
+
+	_, err = NewMasterKeys(EncryptionConfig{MasterKey: "not base64!"}, "us-east-1")
+	assert.Error(t, err)
+
+	_, err = NewMasterKeys(EncryptionConfig{MasterKey: base64.StdEncoding.EncodeToString([]byte("short"))}, "us-east-1")
+	assert.Error(t, err)
+}
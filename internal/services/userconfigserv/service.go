@@ -2,7 +2,10 @@ package userconfigserv
 
 import (
 	"context"
-	"errors"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"slices"
 	"sync"
 	"time"
 
@@ -12,49 +15,178 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/patrickmn/go-cache"
 	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
 )
 
 const (
 	table = "toshl-users"
 
 	defaultExpiration = cache.NoExpiration
+
+	// refreshInterval is how old the cached configs may be, so that the users
+	// and keys added or removed while a server runs are seen
+	refreshInterval = 5 * time.Minute
+	// missRefreshInterval is how often a lookup that misses reads the table
+	// again, so that unknown keys do not scan it on every request
+	missRefreshInterval = 30 * time.Second
 )
 
+// ErrNotFound is returned when there is no user config for an email or api
+// key, other errors mean that the configs could not be read.
+var ErrNotFound = errs.Class("user config not found")
+
 type MappingConfig map[string]string
 
 type ToshlConfig struct {
 	Token string `json:"token" dynamodbav:"Token"`
 }
 
+// CategoryRule assigns Category to the transactions whose description
+// matches Pattern, a case-insensitive regexp.
+type CategoryRule struct {
+	Pattern  string `json:"pattern"  dynamodbav:"Pattern"`
+	Category string `json:"category" dynamodbav:"Category"`
+}
+
+// MerchantAlias names the merchants whose description matches Pattern, a case
+// insensitive regexp, before the built-in merchant names.
+type MerchantAlias struct {
+	Pattern string `json:"pattern" dynamodbav:"Pattern"`
+	Name    string `json:"name"    dynamodbav:"Name"`
+}
+
 type UserConfig struct {
 	Email             string                   `json:"email"               dynamodbav:"Email"`
 	SMSDeliveryNumber string                   `json:"sms_delivery_number" dynamodbav:"SMSDeliveryNumber"`
 	Toshl             ToshlConfig              `json:"toshl"               dynamodbav:"Toshl"`
 	Mapping           map[string]MappingConfig `json:"account_mappings"    dynamodbav:"AccountMappings"`
+	APIKeyHashes      []string                 `json:"api_key_hashes"      dynamodbav:"APIKeyHashes"`
+	CategoryRules     []CategoryRule           `json:"category_rules"      dynamodbav:"CategoryRules"`
+	MerchantAliases   []MerchantAlias          `json:"merchant_aliases"    dynamodbav:"MerchantAliases"`
+	// DescriptionTemplate is a text/template for the description of the
+	// entries, the default one when it is empty
+	DescriptionTemplate string `json:"description_template" dynamodbav:"DescriptionTemplate"`
+	// AlertInNotes adds the text of the alert to the notes of the entries
+	AlertInNotes bool `json:"alert_in_notes" dynamodbav:"AlertInNotes"`
+	// Backend is where the entries are registered, Toshl by default
+	Backend accountingservtypes.BackendConfig `json:"backend" dynamodbav:"Backend"`
+}
+
+// HashAPIKey returns the value stored in UserConfig.APIKeyHashes for an API
+// key, so that raw keys never need to be persisted.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c UserConfig) HasAPIKey(key string) bool {
+	hash := HashAPIKey(key)
+	return slices.ContainsFunc(c.APIKeyHashes, func(h string) bool {
+		return subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1
+	})
 }
 
 type inMemoryCache interface {
 	Set(k string, v any, t time.Duration)
 	Get(k string) (any, bool)
 	Delete(k string)
+	Items() map[string]cache.Item
 }
 
 type DynamoDBService struct {
 	Client *dynamodb.Client
+	// Keys encrypt the tokens and phone numbers, which are stored in
+	// cleartext when there are none
+	Keys *MasterKeys
 
 	once  sync.Once
 	cache inMemoryCache
+
+	mu       sync.Mutex
+	loadedAt time.Time
 }
 
-func (r *DynamoDBService) init(ctx context.Context) {
+func (r *DynamoDBService) init() {
 	r.once.Do(func() {
 		r.cache = cache.New(5*time.Minute, 1*time.Minute)
-
-		r.PreloadAllConfigs(ctx)
 	})
 }
 
+// load reads the table again when it was last read more than maxAge ago, or
+// never.
+func (r *DynamoDBService) load(ctx context.Context, maxAge time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.loadedAt.IsZero() && time.Since(r.loadedAt) < maxAge {
+		return nil
+	}
+
+	return r.preload(ctx)
+}
+
+// PreloadAllConfigs caches every user config as it is in the table, they are
+// decrypted when read.
 func (r *DynamoDBService) PreloadAllConfigs(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.preload(ctx)
+}
+
+func (r *DynamoDBService) preload(ctx context.Context) error {
+	r.init()
+
+	items, err := r.scan(ctx)
+	if err != nil {
+		return errs.New("could not load user configs: %w", err)
+	}
+
+	var expTime time.Duration = defaultExpiration
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		expTime = time.Until(deadline)
+	}
+
+	loaded := make(map[string]bool, len(items))
+	for _, it := range items {
+		r.cache.Set(it.Email, it, expTime)
+		loaded[it.Email] = true
+	}
+
+	// users that were removed from the table should not be found anymore
+	for email := range r.cache.Items() {
+		if !loaded[email] {
+			r.cache.Delete(email)
+		}
+	}
+	r.loadedAt = time.Now()
+
+	return nil
+}
+
+// GetAllUserConfigs reads every user config from the table, without going
+// through the cache.
+func (r *DynamoDBService) GetAllUserConfigs(ctx context.Context) ([]UserConfig, error) {
+	items, err := r.scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cfgs := make([]UserConfig, 0, len(items))
+	for _, it := range items {
+		cfg, err := r.decrypt(ctx, it)
+		if err != nil {
+			return nil, err
+		}
+
+		cfgs = append(cfgs, cfg)
+	}
+
+	return cfgs, nil
+}
+
+func (r *DynamoDBService) scan(ctx context.Context) ([]storedConfig, error) {
 	scanIn := &dynamodb.ScanInput{
 		TableName: aws.String(table),
 	}
@@ -63,7 +195,7 @@ func (r *DynamoDBService) PreloadAllConfigs(ctx context.Context) error {
 	for {
 		out, err := r.Client.Scan(ctx, scanIn)
 		if err != nil {
-			return errs.Wrap(err)
+			return nil, errs.Wrap(err)
 		}
 
 		items = append(items, out.Items...)
@@ -75,19 +207,31 @@ func (r *DynamoDBService) PreloadAllConfigs(ctx context.Context) error {
 		scanIn.ExclusiveStartKey = out.LastEvaluatedKey
 	}
 
-	var expTime time.Duration = defaultExpiration
-	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
-		expTime = time.Until(deadline)
-	}
-
+	stored := make([]storedConfig, 0, len(items))
 	for _, it := range items {
-		var cfg UserConfig
+		var cfg storedConfig
 		err := attributevalue.UnmarshalMap(it, &cfg)
 		if err != nil {
-			return errs.Wrap(err)
+			return nil, errs.Wrap(err)
 		}
 
-		r.cache.Set(cfg.Email, cfg, expTime)
+		stored = append(stored, cfg)
+	}
+
+	return stored, nil
+}
+
+// CheckTable verifies that the users table exists and is active.
+func (r *DynamoDBService) CheckTable(ctx context.Context) error {
+	out, err := r.Client.DescribeTable(ctx, &dynamodb.DescribeTableInput{
+		TableName: aws.String(table),
+	})
+	if err != nil {
+		return errs.New("could not describe table %s: %w", table, err)
+	}
+
+	if status := out.Table.TableStatus; status != types.TableStatusActive {
+		return errs.New("table %s is %s", table, status)
 	}
 
 	return nil
@@ -97,15 +241,25 @@ func (r *DynamoDBService) GetUserConfigFromEmail(
 	ctx context.Context,
 	email string,
 ) (UserConfig, error) {
-	r.init(ctx)
+	if err := r.load(ctx, refreshInterval); err != nil {
+		return UserConfig{}, err
+	}
+
+	if val, found := r.cache.Get(email); found {
+		return r.decrypt(ctx, val.(storedConfig))
+	}
+
+	// the user may have been added since the table was read
+	if err := r.load(ctx, missRefreshInterval); err != nil {
+		return UserConfig{}, err
+	}
 
 	if val, found := r.cache.Get(email); found {
-		cfg := val.(UserConfig)
-		return cfg, nil
-	} else {
-		return UserConfig{}, errors.New("not found")
+		return r.decrypt(ctx, val.(storedConfig))
 	}
 
+	return UserConfig{}, ErrNotFound.New("%s", email)
+
 	// key, err := attributevalue.MarshalMap(map[string]any{
 	// 	"Email": email,
 	// })
@@ -132,8 +286,61 @@ func (r *DynamoDBService) GetUserConfigFromEmail(
 	// return cfg, nil
 }
 
+func (r *DynamoDBService) GetUserConfigFromAPIKey(
+	ctx context.Context,
+	key string,
+) (UserConfig, error) {
+	if key == "" {
+		return UserConfig{}, ErrNotFound.New("api key is empty")
+	}
+
+	if err := r.load(ctx, refreshInterval); err != nil {
+		return UserConfig{}, err
+	}
+
+	if cfg, ok := r.findAPIKey(key); ok {
+		return r.decrypt(ctx, cfg)
+	}
+
+	// the key may have been added since the table was read
+	if err := r.load(ctx, missRefreshInterval); err != nil {
+		return UserConfig{}, err
+	}
+
+	if cfg, ok := r.findAPIKey(key); ok {
+		return r.decrypt(ctx, cfg)
+	}
+
+	return UserConfig{}, ErrNotFound.New("no user has the api key")
+}
+
+func (r *DynamoDBService) findAPIKey(key string) (storedConfig, bool) {
+	for _, it := range r.cache.Items() {
+		cfg, ok := it.Object.(storedConfig)
+		if ok && cfg.HasAPIKey(key) {
+			return cfg, true
+		}
+	}
+
+	return storedConfig{}, false
+}
+
 func (r *DynamoDBService) SaveUserConfig(ctx context.Context, cfg UserConfig) error {
-	it, err := attributevalue.MarshalMap(cfg)
+	stored, err := r.encrypt(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	err = r.put(ctx, stored)
+
+	r.init()
+	r.cache.Set(cfg.Email, stored, 5*time.Minute)
+
+	return err
+}
+
+func (r *DynamoDBService) put(ctx context.Context, stored storedConfig) error {
+	it, err := attributevalue.MarshalMap(stored)
 	if err != nil {
 		return errs.Wrap(err)
 	}
@@ -143,7 +350,5 @@ func (r *DynamoDBService) SaveUserConfig(ctx context.Context, cfg UserConfig) er
 		TableName: aws.String(table),
 	})
 
-	r.cache.Set(cfg.Email, cfg, 5*time.Minute)
-
 	return errs.Wrap(err)
 }
@@ -2,24 +2,36 @@ package sync
 
 import (
 	"context"
-	"fmt"
 	"regexp"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/zeebo/errs"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/merchant"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/result"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilregexp"
 	utilslices "github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utilslices"
 )
 
+var (
+	ErrUserNotFound    = errs.Class("user not found")
+	ErrUnmappedAccount = errs.Class("unmapped account")
+	// ErrSkipped is returned for the transactions that were skipped in
+	// review, their messages stay in the inbox
+	ErrSkipped = errs.Class("skipped")
+)
+
 type registerResponse struct {
 	Trx *banktypes.TrxInfo
 	Cfg userconfigserv.UserConfig
@@ -32,6 +44,10 @@ func (s *Sync) registerTrxsIntoAccounting(
 	log := logging.FromContext(ctx)
 
 	routines := runtime.NumCPU()
+	if s.Reviewer != nil {
+		// entries are reviewed in the order of their messages
+		routines = 1
+	}
 	routines = min(routines, len(trxs))
 
 	if routines == 0 {
@@ -92,78 +108,356 @@ func (s *Sync) registerTrxsIntoAccounting(
 func (s *Sync) registerSingleTrxIntoAccounting(
 	ctx context.Context,
 	trx *banktypes.TrxInfo,
-) (registerResponse, error) {
-	log := logging.FromContext(ctx)
+) (_ registerResponse, genErr error) {
+	ctx, span := tracing.Start(ctx, "registerSingleTrxIntoAccounting",
+		tracing.MessageID(trx.OriginMessage.ID()),
+		tracing.Bank(trx.Bank.String()),
+	)
+	defer func() {
+		if genErr != nil && !ErrSkipped.Has(genErr) {
+			metrics.EntryFailures.WithLabelValues(trx.Bank.String()).Inc()
+		}
+		tracing.End(span, genErr)
+	}()
+
 	zeroVal := registerResponse{
 		Trx: trx,
 	}
 
-	repo := s.deps.AccountingRepo
-
 	cfg, err := s.getUserConfigFromCandidates(ctx, trx.OriginMessage.To())
 	if err != nil {
 		return zeroVal, err
 	}
 	zeroVal.Cfg = cfg
 
-	accounts, err := repo.GetAccounts(ctx, cfg.Toshl.Token)
+	trx.Merchant = merchantName(ctx, cfg, trx)
+
+	proposal, err := s.proposeEntry(ctx, cfg, trx)
 	if err != nil {
 		return zeroVal, err
 	}
 
-	const categoryPrefix = "PENDING_"
+	if s.Reviewer != nil {
+		if err := s.review(ctx, proposal); err != nil {
+			return zeroVal, err
+		}
+	}
 
-	categoryType := trx.Type.String()
-	categoryName := categoryPrefix + strings.ToUpper(categoryType)
-	categoryID, err := s.createCategoryIfAbsent(ctx, cfg.Toshl.Token, categoryType, categoryName)
+	return zeroVal, s.createEntry(ctx, proposal)
+}
+
+// EntryProposal is the entry that would be created for a transaction, its
+// category is created along with it when it does not exist.
+type EntryProposal struct {
+	Bank         string
+	User         string
+	MessageID    uint32
+	CategoryType string
+	Category     string
+	Account      accountingservtypes.Account
+	Entry        accountingservtypes.CreateEntryInput
+
+	repo     accountingService
+	token    string
+	backend  string
+	accounts []accountingservtypes.Account
+}
+
+// Accounts are the accounts of the user that the entry can be assigned to.
+func (p *EntryProposal) Accounts() []accountingservtypes.Account {
+	return p.accounts
+}
+
+func (p *EntryProposal) Reassign(account accountingservtypes.Account) {
+	p.Account = account
+	p.Entry.AccountID = account.ID
+}
+
+func (s *Sync) proposeEntry(
+	ctx context.Context,
+	cfg userconfigserv.UserConfig,
+	trx *banktypes.TrxInfo,
+) (*EntryProposal, error) {
+	repo, token, err := s.accountingFor(ctx, cfg)
 	if err != nil {
-		return zeroVal, err
+		return nil, err
+	}
+
+	accounts, err := repo.GetAccounts(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	accountMappings := getAccountsMapping(accounts, cfg, trx.Bank.String())
+
+	account, ok := accountMappings[trx.Account]
+	if !ok {
+		account, err = openAccount(ctx, repo, token, cfg, trx)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	var notes string
+	if cfg.AlertInNotes {
+		notes = alertText(trx)
+	}
+
+	return &EntryProposal{
+		Bank:         trx.Bank.String(),
+		User:         cfg.Email,
+		MessageID:    trx.OriginMessage.ID(),
+		CategoryType: trx.Type.String(),
+		Category:     getCategoryName(ctx, cfg, trx),
+		Account:      account,
+		Entry: accountingservtypes.CreateEntryInput{
+			Date: trx.Date.In(s.deps.TimeLocale),
+			Currency: currency.Amount{
+				Code:   entryCurrency(trx),
+				Number: signedAmount(trx),
+			},
+			Description: entryDescription(ctx, cfg, trx),
+			Notes:       notes,
+			AccountID:   account.ID,
+			Metadata:    entryMetadata(trx, s.deps.TimeLocale),
+		},
+		repo:     repo,
+		token:    token,
+		backend:  backendName(cfg),
+		accounts: accounts,
+	}, nil
+}
+
+func (s *Sync) createEntry(ctx context.Context, p *EntryProposal) error {
+	log := logging.FromContext(ctx)
+
+	categoryID, err := s.createCategoryIfAbsent(ctx, p.repo, p.token, p.CategoryType, p.Category)
+	if err != nil {
+		return err
+	}
+	p.Entry.CategoryID = categoryID
+
 	log = log.With(
 		logging.String("category_id", categoryID),
-		logging.String("category_type", categoryType),
-		logging.String("category_name", categoryName),
+		logging.String("category_type", p.CategoryType),
+		logging.String("category_name", p.Category),
 	)
 
-	accountMappings := getAccountsMapping(accounts, cfg, trx.Bank.String())
+	log.Debug("entry to be created",
+		logging.Any("entry", p.Entry),
+	)
+
+	if s.DryRun {
+		log.Info("not creating entry due to dryrun")
+		// categories that do not exist have no id on dry runs
+		if categoryID == "" {
+			s.Plan.addCategory(PlannedCategory{
+				User: p.User,
+				Type: p.CategoryType,
+				Name: p.Category,
+			})
+		}
+		s.Plan.addEntry(p)
+		return nil
+	}
 
-	// log.Debug("account mappings",
-	// 	logging.Any("mappings", accountMappings),
-	// )
+	entryCtx, entrySpan := tracing.Start(ctx, "CreateEntry",
+		tracing.MessageID(p.MessageID),
+		tracing.Bank(p.Bank),
+		attribute.String("backend", p.backend),
+	)
+	err = p.repo.CreateEntry(entryCtx, p.token, p.Entry)
+	tracing.End(entrySpan, err)
+	if err == nil {
+		metrics.EntriesCreated.WithLabelValues(p.Bank, p.backend).Inc()
+	}
+
+	return err
+}
+
+func backendName(cfg userconfigserv.UserConfig) string {
+	if cfg.Backend.Type == "" {
+		return accountingservtypes.BackendToshl
+	}
+
+	return cfg.Backend.Type
+}
 
+// accountOpener is implemented by the backends where accounts do not need to
+// be created before they are used, such as plain-text journals.
+type accountOpener interface {
+	OpenAccount(ctx context.Context, token, name string) (accountingservtypes.Account, error)
+}
+
+// openAccount returns the account for a transaction without an existing
+// account. It is named after the user mapping for the account number, or
+// "<number> <bank>" when there is none.
+func openAccount(
+	ctx context.Context,
+	repo accountingService,
+	token string,
+	cfg userconfigserv.UserConfig,
+	trx *banktypes.TrxInfo,
+) (accountingservtypes.Account, error) {
+	opener, ok := repo.(accountOpener)
+	if !ok || trx.Account == "" {
+		return accountingservtypes.Account{}, ErrUnmappedAccount.New("transaction does not have an assigned account %q", trx.Account)
+	}
+
+	bank := trx.Bank.String()
+	name, ok := cfg.Mapping[bank][trx.Account]
+	if !ok {
+		name = trx.Account + " " + bank
+	}
+
+	return opener.OpenAccount(ctx, token, name)
+}
+
+// accountingFor returns the accounting backend selected by the user and the
+// token to use with it.
+func (s *Sync) accountingFor(
+	ctx context.Context,
+	cfg userconfigserv.UserConfig,
+) (accountingService, string, error) {
+	backend := cfg.Backend
+	if backend.Type == "" || backend.Type == accountingservtypes.BackendToshl {
+		token, err := s.resolveToken(ctx, cfg.Toshl.Token)
+		return s.deps.AccountingRepo, token, err
+	}
+
+	token, err := s.resolveToken(ctx, backend.Token)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// backends are kept between transactions, so that the local ones can
+	// serialize their writes
+	if repo, ok := s.backends.Load(backend); ok {
+		return repo.(accountingService), token, nil
+	}
+
+	if s.deps.NewAccountingBackend == nil {
+		return nil, "", errs.New("accounting backend %q is not available", backend.Type)
+	}
+
+	repo, err := s.deps.NewAccountingBackend(backend)
+	if err != nil {
+		return nil, "", errs.New("could not create accounting backend for %q: %w", cfg.Email, err)
+	}
+
+	actual, _ := s.backends.LoadOrStore(backend, repo)
+	return actual.(accountingService), token, nil
+}
+
+// resolveToken returns the token that a user config references, tokens can
+// also be in the config as they are.
+func (s *Sync) resolveToken(ctx context.Context, token string) (string, error) {
+	if s.deps.Secrets == nil {
+		return token, nil
+	}
+
+	return s.deps.Secrets.Resolve(ctx, token)
+}
+
+// messageIDer is implemented by the messages that have a stable identifier,
+// such as the Message-ID header of emails.
+type messageIDer interface {
+	MessageID() string
+}
+
+func entryMetadata(trx *banktypes.TrxInfo, loc *time.Location) map[string]string {
+	meta := map[string]string{
+		"bank":       trx.Bank.String(),
+		"email_date": trx.OriginMessage.Date().In(loc).Format(time.RFC3339),
+	}
+
+	// the sequence number of a message changes, so it can not tell messages
+	// apart across syncs
+	if m, ok := trx.OriginMessage.(messageIDer); ok && m.MessageID() != "" {
+		meta["message_id"] = m.MessageID()
+	}
+
+	return meta
+}
+
+// signedAmount is the value of trx as it is registered in accounting, where
+// expenses are negative.
+// defaultCurrency is the currency of the transactions that do not tell theirs,
+// such as the alerts of colombian banks.
+const defaultCurrency = "COP"
+
+func entryCurrency(trx *banktypes.TrxInfo) string {
+	if trx.Value.Code == "" {
+		return defaultCurrency
+	}
+
+	return trx.Value.Code
+}
+
+func signedAmount(trx *banktypes.TrxInfo) float64 {
 	amount := trx.Value.Number
 	if trx.Type == banktypes.Expense {
 		amount *= -1
 	}
 
-	account, ok := accountMappings[trx.Account]
-	if !ok {
-		return zeroVal, errs.New("transaction does not have an assigned account %q", trx.Account)
+	return amount
+}
+
+func getCategoryName(
+	ctx context.Context,
+	cfg userconfigserv.UserConfig,
+	trx *banktypes.TrxInfo,
+) string {
+	log := logging.FromContext(ctx)
+
+	if trx.Category != "" {
+		return trx.Category
 	}
 
-	entryInput := accountingservtypes.CreateEntryInput{
-		Date: trx.Date.In(s.deps.TimeLocale),
-		Currency: currency.Amount{
-			Code:   "COP",
-			Number: amount,
-		},
-		Description: fmt.Sprintf("** %s de %s", trx.Action, trx.Description),
-		AccountID:   account.ID,
-		CategoryID:  categoryID,
+	for _, r := range cfg.CategoryRules {
+		exp, err := regexp.Compile("(?i)" + r.Pattern)
+		if err != nil {
+			log.Warn("invalid category rule",
+				logging.String("email", cfg.Email),
+				logging.String("pattern", r.Pattern),
+				logging.Error(err),
+			)
+			continue
+		}
+
+		if exp.MatchString(trx.Description) || exp.MatchString(trx.Merchant) {
+			return r.Category
+		}
 	}
 
-	log.Debug("entry to be created",
-		logging.Any("entry", entryInput),
-	)
+	const categoryPrefix = "PENDING_"
 
-	if s.DryRun {
-		log.Info("not creating entry due to dryrun")
-		return zeroVal, nil
+	return categoryPrefix + strings.ToUpper(trx.Type.String())
+}
+
+func merchantName(
+	ctx context.Context,
+	cfg userconfigserv.UserConfig,
+	trx *banktypes.TrxInfo,
+) string {
+	log := logging.FromContext(ctx)
+
+	aliases := make([]merchant.Alias, 0, len(cfg.MerchantAliases))
+	for _, a := range cfg.MerchantAliases {
+		exp, err := regexp.Compile("(?i)" + a.Pattern)
+		if err != nil {
+			log.Warn("invalid merchant alias",
+				logging.String("email", cfg.Email),
+				logging.String("pattern", a.Pattern),
+				logging.Error(err),
+			)
+			continue
+		}
+
+		aliases = append(aliases, merchant.Alias{Regexp: exp, Name: a.Name})
 	}
 
-	err = repo.CreateEntry(ctx, cfg.Toshl.Token, entryInput)
-	return zeroVal, err
+	return merchant.Name(trx.Description, aliases)
 }
 
 func getAccountsMapping(
@@ -191,6 +485,15 @@ func getAccountsMapping(
 		for k, v := range userBankMappings {
 			if destAccount, ok := mapping[v]; ok {
 				mapping[k] = destAccount
+				continue
+			}
+
+			// backends without numbered accounts are mapped by account name
+			for _, a := range accounts {
+				if a.ID == v || a.Name == v {
+					mapping[k] = a
+					break
+				}
 			}
 		}
 	}
@@ -200,12 +503,11 @@ func getAccountsMapping(
 
 func (s *Sync) createCategoryIfAbsent(
 	ctx context.Context,
+	repo accountingService,
 	token, catType, category string,
 ) (string, error) {
 	log := logging.FromContext(ctx)
 
-	repo := s.deps.AccountingRepo
-
 	categories, err := repo.GetCategories(ctx, token)
 	if err != nil {
 		return "", errs.Wrap(err)
@@ -213,7 +515,7 @@ func (s *Sync) createCategoryIfAbsent(
 
 	for _, c := range categories {
 		if c.Name == category {
-			if c.Type != catType {
+			if c.Type != "" && c.Type != catType {
 				log.Warn("category types mismatch",
 					logging.String("actual", c.Type),
 					logging.String("expected", catType),
@@ -257,7 +559,7 @@ func (s *Sync) getUserConfigFromCandidates(
 	}
 
 	if !found {
-		return userconfigserv.UserConfig{}, errs.New("could not find user config from candidates")
+		return userconfigserv.UserConfig{}, ErrUserNotFound.New("could not find user config from candidates %v", candidates)
 	}
 
 	return userCfg, nil
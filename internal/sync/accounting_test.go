@@ -0,0 +1,63 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+func Test_ProposeEntryCurrency(t *testing.T) {
+	s := newTestSync(types.Config{}, &Dependencies{
+		TimeLocale: time.UTC,
+		AccountingRepo: &fakeAccounting{accounts: []accountingservtypes.Account{
+			{ID: "1", Name: "1234 Bancolombia"},
+		}},
+	})
+
+	cfg := userconfigserv.UserConfig{
+		Email:   "user@example.com",
+		Toshl:   userconfigserv.ToshlConfig{Token: "token"},
+		Mapping: map[string]userconfigserv.MappingConfig{"bancolombia": {"*1234": "1234"}},
+	}
+
+	tests := []struct {
+		Name  string
+		Value currency.Amount
+		Want  currency.Amount
+	}{
+		{
+			Name:  "cop",
+			Value: currency.Amount{Code: "COP", Number: 30000},
+			Want:  currency.Amount{Code: "COP", Number: -30000},
+		},
+		{
+			Name:  "usd",
+			Value: currency.Amount{Code: "USD", Number: 12.5},
+			Want:  currency.Amount{Code: "USD", Number: -12.5},
+		},
+		{
+			Name:  "unknown",
+			Value: currency.Amount{Number: 30000},
+			Want:  currency.Amount{Code: "COP", Number: -30000},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			trx := testTrx()
+			trx.Value = tt.Value
+
+			proposal, err := s.proposeEntry(context.Background(), cfg, trx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Want, proposal.Entry.Currency)
+		})
+	}
+}
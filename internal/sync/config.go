@@ -12,9 +12,12 @@ import (
 	"github.com/zeebo/errs"
 
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/statement"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/external/twilio"
-	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/secrets"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/proxy"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/dateprocessingserv"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv"
@@ -26,15 +29,14 @@ import (
 func (s *Sync) configure(ctx context.Context) error {
 	var genErr error
 
-	deps, err := getDependencies(ctx, s.Config)
-	if err != nil {
-		return err
-	}
-
 	s.configOnce.Do(func() {
-		s.deps = deps
+		s.deps, genErr = getDependencies(ctx, s.Config)
 	})
 
+	if genErr == nil && s.deps == nil {
+		genErr = errs.New("dependencies could not be configured")
+	}
+
 	return genErr
 }
 
@@ -44,24 +46,33 @@ func getDependencies(ctx context.Context, config types.Config) (*Dependencies, e
 		return nil, err
 	}
 
-	const region = "us-east-1"
-	dynamoClient, err := getDynamoDBClient(ctx, region)
+	importers, err := statement.NewImporters(config.Statements, loc)
 	if err != nil {
 		return nil, err
 	}
 
-	addr, user, pass := config.Mail.Address, config.Mail.Username, config.Mail.Password
-	newImapClientFunc := func() mailserv.IMAPClient {
-		log := logging.New()
-		defer func() { _ = log.Sync() }()
+	dynamoClient, err := getDynamoDBClient(ctx, config.Region())
+	if err != nil {
+		return nil, err
+	}
+
+	resolver, err := secrets.New(ctx, config.Secrets, config.Region())
+	if err != nil {
+		return nil, err
+	}
 
+	keys, err := userconfigserv.NewMasterKeys(config.UserEncryption, config.Region())
+	if err != nil {
+		return nil, err
+	}
+
+	addr, user, pass := config.Mail.Address, config.Mail.Username, config.Mail.Password
+	newImapClientFunc := func() (mailserv.IMAPClient, error) {
 		cl, err := getEmailClient(addr, user, pass)
 		if err != nil {
-			log.Error("could not create imap client", logging.Error(err))
-
-			return nil
+			return nil, err
 		}
-		return cl
+		return cl, nil
 	}
 
 	newToshlClientFunc := func(t string) accountingserv.ToshlClient {
@@ -74,7 +85,9 @@ func getDependencies(ctx context.Context, config types.Config) (*Dependencies, e
 
 	return &Dependencies{
 		TimeLocale: loc,
-		BanksRepo:  bank.Repository{},
+		BanksRepo: bank.Repository{
+			Importers: importers,
+		},
 		DateRepo: dateprocessingserv.DynamoDBService{
 			Client: dynamoClient,
 		},
@@ -83,10 +96,13 @@ func getDependencies(ctx context.Context, config types.Config) (*Dependencies, e
 		},
 		UserCfgRepo: &userconfigserv.DynamoDBService{
 			Client: dynamoClient,
+			Keys:   keys,
 		},
 		AccountingRepo: &accountingserv.ToshlService{
 			ClientBuilder: newToshlClientFunc,
 		},
+		NewAccountingBackend: newAccountingBackend,
+		Secrets:              resolver.Restrict(secrets.SchemeSecretsManager, secrets.SchemeSSM, secrets.SchemeAge),
 		NotificationServ: &notificationserv.NotificationService{
 			SMSClient: &twilio.Client{
 				AccountSid: config.Twilio.AccountSid,
@@ -97,6 +113,52 @@ func getDependencies(ctx context.Context, config types.Config) (*Dependencies, e
 	}, nil
 }
 
+func newAccountingBackend(cfg accountingservtypes.BackendConfig) (accountingService, error) {
+	switch cfg.Type {
+	case accountingservtypes.BackendFirefly:
+		if cfg.URL == "" {
+			return nil, errs.New("firefly backend needs an url")
+		}
+		return &accountingserv.FireflyService{
+			URL: cfg.URL,
+		}, nil
+
+	case accountingservtypes.BackendActual:
+		if cfg.URL == "" || cfg.BudgetID == "" {
+			return nil, errs.New("actual backend needs an url and a budget id")
+		}
+		currency := cfg.Currency
+		if currency == "" {
+			currency = defaultCurrency
+		}
+		return &accountingserv.ActualService{
+			URL:      cfg.URL,
+			BudgetID: cfg.BudgetID,
+			Currency: currency,
+		}, nil
+
+	case accountingservtypes.BackendLedger, accountingservtypes.BackendBeancount:
+		if cfg.Path == "" {
+			return nil, errs.New("%s backend needs a path", cfg.Type)
+		}
+		return &accountingserv.LedgerService{
+			Path:   cfg.Path,
+			Format: cfg.Type,
+		}, nil
+
+	case accountingservtypes.BackendCSV, accountingservtypes.BackendJSON:
+		if cfg.Path == "" {
+			return nil, errs.New("%s backend needs a path", cfg.Type)
+		}
+		return &accountingserv.FileSinkService{
+			Path:   cfg.Path,
+			Format: cfg.Type,
+		}, nil
+	}
+
+	return nil, errs.New("unknown accounting backend %q", cfg.Type)
+}
+
 func getTimezone(location string) (*time.Location, error) {
 	if location == "" {
 		return nil, errs.New("timezone locale should not be empty")
@@ -117,6 +179,8 @@ func getDynamoDBClient(ctx context.Context, region string) (*dynamodb.Client, er
 }
 
 func getEmailClient(addr, username, password string) (*client.Client, error) {
+	defer metrics.ObserveSince(metrics.IMAPLatency.WithLabelValues("login"), time.Now())
+
 	emailClient, err := client.DialTLS(addr, nil)
 	if err != nil {
 		return nil, errs.Wrap(err)
@@ -26,6 +26,7 @@ func (s *Sync) saveLastExecutionDate(ctx context.Context, msgs []banktypes.Messa
 
 	if s.DryRun {
 		log.Info("not changing last execution date because of dryrun")
+		s.Plan.setLastProcessedDate(earliest)
 		return nil
 	}
 
@@ -0,0 +1,95 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"text/template"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+)
+
+const defaultDescriptionTemplate = `** {{.Action}} de {{.Merchant}}`
+
+// descriptionData is what the description templates are executed with, the
+// fields of the transaction and of the message that it came from.
+type descriptionData struct {
+	*banktypes.TrxInfo
+	Subject string
+	Text    string
+}
+
+var descriptionFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+	// last returns the last n characters of s, such as the last digits of
+	// an account
+	"last": func(n int, s string) string {
+		r := []rune(s)
+		if len(r) > n {
+			return string(r[len(r)-n:])
+		}
+		return s
+	},
+}
+
+var defaultDescription = template.Must(
+	template.New("description").Funcs(descriptionFuncs).Parse(defaultDescriptionTemplate),
+)
+
+// entryDescription executes the description template of the user, or the
+// default one when the user has none or it fails.
+func entryDescription(
+	ctx context.Context,
+	cfg userconfigserv.UserConfig,
+	trx *banktypes.TrxInfo,
+) string {
+	log := logging.FromContext(ctx)
+
+	data := descriptionData{
+		TrxInfo: trx,
+		Subject: trx.OriginMessage.Subject(),
+		Text:    alertText(trx),
+	}
+
+	if cfg.DescriptionTemplate != "" {
+		description, err := executeDescription(cfg.DescriptionTemplate, data)
+		if err == nil && description != "" {
+			return description
+		}
+
+		log.Warn("invalid description template",
+			logging.String("email", cfg.Email),
+			logging.String("template", cfg.DescriptionTemplate),
+			logging.Error(err),
+		)
+	}
+
+	// the default template only uses fields of the transaction, so it can not
+	// fail
+	var b strings.Builder
+	_ = defaultDescription.Execute(&b, data)
+
+	return b.String()
+}
+
+func executeDescription(text string, data descriptionData) (string, error) {
+	tmpl, err := template.New("description").Funcs(descriptionFuncs).Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// alertText is the text of the message that a transaction came from.
+func alertText(trx *banktypes.TrxInfo) string {
+	return strings.TrimSpace(string(trx.OriginMessage.Body()))
+}
@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+type testBank string
+
+func (b testBank) String() string { return string(b) }
+
+func testTrx() *banktypes.TrxInfo {
+	return &banktypes.TrxInfo{
+		Bank:        testBank("bancolombia"),
+		Action:      "compra",
+		Description: "EXITO COLOMBIA 123",
+		Merchant:    "Exito",
+		Account:     "*1234",
+		Value:       currency.Amount{Code: "COP", Number: 30000},
+		Type:        banktypes.Expense,
+		OriginMessage: banktypes.TextMessage{
+			Key:   "alert-1",
+			Title: "Alertas y Notificaciones",
+			Sent:  time.Date(2024, time.March, 15, 14, 32, 0, 0, time.UTC),
+			Text:  "  Bancolombia le informa compra por $30.000 en EXITO COLOMBIA 123  ",
+		},
+	}
+}
+
+func Test_EntryDescription(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Template string
+		Want     string
+	}{
+		{
+			Name: "default",
+			Want: "** compra de Exito",
+		},
+		{
+			Name:     "fields",
+			Template: "{{.Merchant}} ({{.Bank}} {{.Account}})",
+			Want:     "Exito (bancolombia *1234)",
+		},
+		{
+			Name:     "message",
+			Template: "{{.Subject}}: {{.Text}}",
+			Want:     "Alertas y Notificaciones: Bancolombia le informa compra por $30.000 en EXITO COLOMBIA 123",
+		},
+		{
+			Name:     "helpers",
+			Template: "{{upper .Action}} {{lower .Description}} {{trim \"  x  \"}}",
+			Want:     "COMPRA exito colombia 123 x",
+		},
+		{
+			Name:     "last",
+			Template: "{{last 4 .Account}} {{last 10 .Account}} {{last 2 \"añoñ\"}}",
+			Want:     "1234 *1234 oñ",
+		},
+		{
+			Name:     "trimmed",
+			Template: "\n  {{.Merchant}}  \n",
+			Want:     "Exito",
+		},
+		{
+			Name:     "parse error",
+			Template: "{{.Merchant",
+			Want:     "** compra de Exito",
+		},
+		{
+			Name:     "execution error",
+			Template: "{{.Missing}}",
+			Want:     "** compra de Exito",
+		},
+		{
+			Name:     "function error",
+			Template: "{{last .Account}}",
+			Want:     "** compra de Exito",
+		},
+		{
+			Name:     "empty result",
+			Template: "{{if false}}x{{end}}",
+			Want:     "** compra de Exito",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			cfg := userconfigserv.UserConfig{
+				Email:               "user@example.com",
+				DescriptionTemplate: tt.Template,
+			}
+
+			assert.Equal(t, tt.Want, entryDescription(context.Background(), cfg, testTrx()))
+		})
+	}
+}
+
+func Test_ProposeEntryNotes(t *testing.T) {
+	s := newTestSync(types.Config{}, &Dependencies{
+		TimeLocale: time.UTC,
+		AccountingRepo: &fakeAccounting{accounts: []accountingservtypes.Account{
+			{ID: "1", Name: "1234 Bancolombia"},
+		}},
+	})
+
+	cfg := userconfigserv.UserConfig{
+		Email:               "user@example.com",
+		Toshl:               userconfigserv.ToshlConfig{Token: "token"},
+		Mapping:             map[string]userconfigserv.MappingConfig{"bancolombia": {"*1234": "1234"}},
+		DescriptionTemplate: "{{.Merchant}}",
+	}
+
+	proposal, err := s.proposeEntry(context.Background(), cfg, testTrx())
+	require.NoError(t, err)
+	assert.Equal(t, "Exito", proposal.Entry.Description)
+	assert.Empty(t, proposal.Entry.Notes)
+
+	cfg.AlertInNotes = true
+	proposal, err = s.proposeEntry(context.Background(), cfg, testTrx())
+	require.NoError(t, err)
+	assert.Equal(t, "Bancolombia le informa compra por $30.000 en EXITO COLOMBIA 123", proposal.Entry.Notes)
+}
@@ -0,0 +1,169 @@
+package sync
+
+import (
+	"context"
+	"slices"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+const (
+	OutcomeSuccess         = "success"
+	OutcomeParseError      = "parse_error"
+	OutcomeAccountingError = "accounting_error"
+	OutcomeIgnored         = "ignored"
+)
+
+var outcomes = []string{OutcomeSuccess, OutcomeParseError, OutcomeAccountingError, OutcomeIgnored}
+
+// The failure keywords are added to the messages that could not be
+// registered, along with their disposition, to tell why.
+const (
+	KeywordUserNotFound    = "$ToshlUserNotFound"
+	KeywordUnmappedAccount = "$ToshlUnmappedAccount"
+	KeywordAccountingError = "$ToshlAccountingError"
+)
+
+var FailureKeywords = []string{KeywordUserNotFound, KeywordUnmappedAccount, KeywordAccountingError}
+
+func failureKeyword(err error) string {
+	switch {
+	case ErrUserNotFound.Has(err):
+		return KeywordUserNotFound
+	case ErrUnmappedAccount.Has(err):
+		return KeywordUnmappedAccount
+	}
+
+	return KeywordAccountingError
+}
+
+// disposition returns the configured disposition for the messages of an
+// outcome, with the mailboxes as they are named in the config.
+func (s *Sync) disposition(outcome string) mailservtypes.Disposition {
+	cfg := s.Config.Dispositions
+
+	switch outcome {
+	case OutcomeSuccess:
+		if cfg.Success != nil {
+			return *cfg.Success
+		}
+		return mailservtypes.Disposition{Move: s.Config.SuccessMailbox}
+
+	case OutcomeParseError:
+		if cfg.ParseError != nil {
+			return *cfg.ParseError
+		}
+		return mailservtypes.Disposition{Move: s.Config.ParseErrorMailbox}
+
+	case OutcomeAccountingError:
+		if cfg.AccountingError != nil {
+			return *cfg.AccountingError
+		}
+		if s.Config.AccountingErrorMailbox != "" {
+			return mailservtypes.Disposition{Move: s.Config.AccountingErrorMailbox}
+		}
+
+	case OutcomeIgnored:
+		if cfg.Ignored != nil {
+			return *cfg.Ignored
+		}
+	}
+
+	return mailservtypes.Disposition{}
+}
+
+// dispositionMailboxes are the mailboxes that the dispositions copy or move
+// messages to, in the order of the outcomes.
+func (s *Sync) dispositionMailboxes() []string {
+	var mailboxes []string
+	for _, o := range outcomes {
+		d := s.disposition(o)
+		for _, m := range []string{d.Copy, d.Move} {
+			if m != "" && !slices.Contains(mailboxes, m) {
+				mailboxes = append(mailboxes, m)
+			}
+		}
+	}
+
+	return mailboxes
+}
+
+// disposeMessages applies the disposition of each outcome to its messages in
+// the inbox, along with the keyword of each message, and returns how many
+// messages it was applied to.
+func (s *Sync) disposeMessages(
+	ctx context.Context,
+	msgs map[string][]banktypes.Message,
+	keywords map[uint32]string,
+) (int, error) {
+	log := logging.FromContext(ctx)
+
+	var (
+		groups []mailservtypes.DispositionGroup
+		// groupOutcomes has the outcome of each group
+		groupOutcomes []string
+		total         int
+	)
+	for _, o := range outcomes {
+		d := s.disposition(o)
+		if len(msgs[o]) == 0 || d.IsZero() {
+			continue
+		}
+
+		d.Copy = s.mailbox(d.Copy)
+		d.Move = s.mailbox(d.Move)
+
+		// messages with different keywords need groups of their own
+		byKeyword := make(map[string]int)
+		for _, m := range msgs[o] {
+			kw := keywords[m.ID()]
+			i, ok := byKeyword[kw]
+			if !ok {
+				g := mailservtypes.DispositionGroup{
+					Disposition: d,
+				}
+				if kw != "" {
+					g.Flags = append(slices.Clip(d.Flags), kw)
+				}
+
+				i = len(groups)
+				byKeyword[kw] = i
+				groups = append(groups, g)
+				groupOutcomes = append(groupOutcomes, o)
+			}
+
+			groups[i].IDs = append(groups[i].IDs, m.ID())
+			total++
+		}
+
+		log.Debug("messages disposition",
+			logging.String("outcome", o),
+			logging.Int("msgs", len(msgs[o])),
+			logging.Any("disposition", d),
+		)
+	}
+
+	if s.DryRun {
+		log.Info("not applying message dispositions because of dryrun",
+			logging.Int("msgs", total),
+		)
+		for i, g := range groups {
+			s.Plan.addDisposition(groupOutcomes[i], g)
+		}
+		return 0, nil
+	}
+
+	if len(groups) == 0 {
+		return 0, nil
+	}
+
+	if err := s.deps.MailRepo.ApplyDispositions(ctx, "INBOX", groups...); err != nil {
+		return total, errs.New("could not apply message dispositions: %w", err)
+	}
+
+	return total, nil
+}
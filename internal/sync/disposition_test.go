@@ -0,0 +1,192 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+func Test_Disposition(t *testing.T) {
+	mailboxes := types.Config{
+		SuccessMailbox:         "Processed",
+		ParseErrorMailbox:      "Failed",
+		AccountingErrorMailbox: "Unregistered",
+	}
+
+	configured := types.Config{
+		SuccessMailbox:         "Processed",
+		ParseErrorMailbox:      "Failed",
+		AccountingErrorMailbox: "Unregistered",
+		Dispositions: types.Dispositions{
+			Success:         &mailservtypes.Disposition{Flags: []string{"$ToshlSynced"}, Seen: true},
+			ParseError:      &mailservtypes.Disposition{Copy: "Review"},
+			AccountingError: &mailservtypes.Disposition{},
+			Ignored:         &mailservtypes.Disposition{Move: "Archive"},
+		},
+	}
+
+	tests := []struct {
+		Name    string
+		Config  types.Config
+		Outcome string
+		Want    mailservtypes.Disposition
+	}{
+		{
+			Name:    "success default",
+			Config:  mailboxes,
+			Outcome: OutcomeSuccess,
+			Want:    mailservtypes.Disposition{Move: "Processed"},
+		},
+		{
+			Name:    "parse error default",
+			Config:  mailboxes,
+			Outcome: OutcomeParseError,
+			Want:    mailservtypes.Disposition{Move: "Failed"},
+		},
+		{
+			Name:    "accounting error default",
+			Config:  mailboxes,
+			Outcome: OutcomeAccountingError,
+			Want:    mailservtypes.Disposition{Move: "Unregistered"},
+		},
+		{
+			Name:    "accounting error without mailbox",
+			Config:  types.Config{SuccessMailbox: "Processed", ParseErrorMailbox: "Failed"},
+			Outcome: OutcomeAccountingError,
+		},
+		{
+			Name:    "ignored default",
+			Config:  mailboxes,
+			Outcome: OutcomeIgnored,
+		},
+		{
+			Name:    "unknown outcome",
+			Config:  configured,
+			Outcome: "other",
+		},
+		{
+			Name:    "success configured",
+			Config:  configured,
+			Outcome: OutcomeSuccess,
+			Want:    mailservtypes.Disposition{Flags: []string{"$ToshlSynced"}, Seen: true},
+		},
+		{
+			Name:    "parse error configured",
+			Config:  configured,
+			Outcome: OutcomeParseError,
+			Want:    mailservtypes.Disposition{Copy: "Review"},
+		},
+		{
+			Name:    "accounting error configured to leave messages",
+			Config:  configured,
+			Outcome: OutcomeAccountingError,
+		},
+		{
+			Name:    "ignored configured",
+			Config:  configured,
+			Outcome: OutcomeIgnored,
+			Want:    mailservtypes.Disposition{Move: "Archive"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			s := &Sync{Config: tt.Config}
+			assert.Equal(t, tt.Want, s.disposition(tt.Outcome))
+		})
+	}
+}
+
+func Test_DispositionMailboxes(t *testing.T) {
+	s := &Sync{Config: types.Config{
+		SuccessMailbox:    "Processed",
+		ParseErrorMailbox: "Failed",
+		Dispositions: types.Dispositions{
+			ParseError: &mailservtypes.Disposition{Copy: "Review", Move: "Processed"},
+			Ignored:    &mailservtypes.Disposition{Move: "Archive"},
+		},
+	}}
+
+	assert.Equal(t, []string{"Processed", "Review", "Archive"}, s.dispositionMailboxes())
+}
+
+func testMessage(id uint32) banktypes.Message {
+	return mailservtypes.Message{Message: imap.Message{SeqNum: id}}
+}
+
+func Test_DisposeMessages(t *testing.T) {
+	mail := &fakeMail{}
+	s := newTestSync(types.Config{
+		SuccessMailbox:    "Processed",
+		ParseErrorMailbox: "Failed",
+		Dispositions: types.Dispositions{
+			AccountingError: &mailservtypes.Disposition{Flags: []string{`\Flagged`}},
+		},
+	}, &Dependencies{MailRepo: mail})
+	// the configured mailbox exists with another name
+	s.mailboxes = map[string]string{"Processed": "INBOX.Processed"}
+
+	msgs := map[string][]banktypes.Message{
+		OutcomeSuccess:         {testMessage(1), testMessage(2)},
+		OutcomeAccountingError: {testMessage(3), testMessage(4), testMessage(5)},
+		OutcomeIgnored:         {testMessage(6)},
+	}
+	keywords := map[uint32]string{
+		3: KeywordUserNotFound,
+		4: KeywordUnmappedAccount,
+		5: KeywordUserNotFound,
+	}
+
+	total, err := s.disposeMessages(context.Background(), msgs, keywords)
+	require.NoError(t, err)
+	assert.Equal(t, 5, total)
+
+	assert.Equal(t, []mailservtypes.DispositionGroup{
+		{
+			Disposition: mailservtypes.Disposition{Move: "INBOX.Processed"},
+			IDs:         []uint32{1, 2},
+		},
+		{
+			Disposition: mailservtypes.Disposition{Flags: []string{`\Flagged`, KeywordUserNotFound}},
+			IDs:         []uint32{3, 5},
+		},
+		{
+			Disposition: mailservtypes.Disposition{Flags: []string{`\Flagged`, KeywordUnmappedAccount}},
+			IDs:         []uint32{4},
+		},
+	}, mail.applied)
+}
+
+func Test_DisposeMessagesDryRun(t *testing.T) {
+	mail := &fakeMail{}
+	s := newTestSync(types.Config{SuccessMailbox: "Processed"}, &Dependencies{MailRepo: mail})
+	s.DryRun = true
+	s.Plan = &Plan{}
+
+	msgs := map[string][]banktypes.Message{
+		OutcomeSuccess: {testMessage(2), testMessage(1)},
+	}
+
+	total, err := s.disposeMessages(context.Background(), msgs, nil)
+	require.NoError(t, err)
+	assert.Zero(t, total)
+	assert.Empty(t, mail.applied)
+
+	require.Len(t, s.Plan.Messages, 1)
+	assert.Equal(t, OutcomeSuccess, s.Plan.Messages[0].Outcome)
+	assert.Equal(t, []uint32{1, 2}, s.Plan.Messages[0].MessageIDs)
+}
+
+func Test_FailureKeyword(t *testing.T) {
+	assert.Equal(t, KeywordUserNotFound, failureKeyword(ErrUserNotFound.New("user@example.com")))
+	assert.Equal(t, KeywordUnmappedAccount, failureKeyword(ErrUnmappedAccount.New("1234")))
+	assert.Equal(t, KeywordAccountingError, failureKeyword(errs.New("could not create entry")))
+}
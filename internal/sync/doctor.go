@@ -0,0 +1,223 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+)
+
+const (
+	CheckPass = "pass"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// Check is the result of verifying one dependency of the sync.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type DoctorOptions struct {
+	// CreateMailbox is asked whether a missing mailbox should be created,
+	// missing mailboxes are only reported when it is nil
+	CreateMailbox func(name string) bool
+}
+
+// tableChecker, userLister and smsChecker are the optional capabilities of
+// the dependencies used to diagnose them.
+type tableChecker interface {
+	CheckTable(ctx context.Context) error
+}
+
+type userLister interface {
+	GetAllUserConfigs(ctx context.Context) ([]userconfigserv.UserConfig, error)
+}
+
+type smsChecker interface {
+	CheckSMS(ctx context.Context) error
+}
+
+type doctor struct {
+	checks []Check
+}
+
+func (d *doctor) add(name string, err error, detail string) bool {
+	c := Check{
+		Name:   name,
+		Status: CheckPass,
+		Detail: detail,
+	}
+	if err != nil {
+		c.Status = CheckFail
+		c.Detail = err.Error()
+	}
+	d.checks = append(d.checks, c)
+
+	return err == nil
+}
+
+func (d *doctor) skip(name, reason string) {
+	d.checks = append(d.checks, Check{
+		Name:   name,
+		Status: CheckSkip,
+		Detail: reason,
+	})
+}
+
+// Doctor checks every dependency of the sync without changing anything,
+// except for the mailboxes that opts allows to create.
+func (s *Sync) Doctor(ctx context.Context, opts DoctorOptions) []Check {
+	var d doctor
+
+	_, err := getTimezone(s.Config.Timezone)
+	d.add("timezone", err, s.Config.Timezone)
+
+	if !d.add("configuration", s.configure(ctx), "") {
+		return d.checks
+	}
+
+	s.checkMail(ctx, &d, opts)
+
+	tables := []struct {
+		name string
+		repo any
+	}{
+		{"state store: dates", s.deps.DateRepo},
+		{"state store: users", s.deps.UserCfgRepo},
+	}
+	for _, t := range tables {
+		checker, ok := t.repo.(tableChecker)
+		if !ok {
+			d.skip(t.name, "not supported")
+			continue
+		}
+		d.add(t.name, checker.CheckTable(ctx), "")
+	}
+
+	s.checkUsers(ctx, &d)
+
+	if checker, ok := s.deps.NotificationServ.(smsChecker); ok {
+		d.add("twilio", checker.CheckSMS(ctx), "")
+	} else {
+		d.skip("twilio", "not supported")
+	}
+
+	return d.checks
+}
+
+func (s *Sync) checkMail(ctx context.Context, d *doctor, opts DoctorOptions) {
+	available, err := s.deps.MailRepo.GetMailboxes(ctx)
+	if mailservtypes.ErrLogin.Has(err) {
+		d.add("imap login", err, "")
+		d.skip("mailboxes", "imap login failed")
+		return
+	}
+	d.add("imap login", nil, s.Config.Mail.Address)
+
+	if !d.add("mailboxes", err, fmt.Sprintf("%d available", len(available))) {
+		return
+	}
+
+	for _, name := range append([]string{"INBOX"}, s.dispositionMailboxes()...) {
+		check := "mailbox " + name
+
+		actual, err := mailserv.FindMailbox(available, name)
+		if err == nil {
+			d.add(check, nil, actual)
+			continue
+		}
+		if !mailservtypes.ErrMailboxNotFound.Has(err) || mailserv.IsSpecialUse(name) ||
+			opts.CreateMailbox == nil || !opts.CreateMailbox(name) {
+			d.add(check, err, "")
+			continue
+		}
+
+		actual, err = s.deps.MailRepo.CreateMailbox(ctx, name)
+		d.add(check, err, "created "+actual)
+	}
+}
+
+func (s *Sync) checkUsers(ctx context.Context, d *doctor) {
+	lister, ok := s.deps.UserCfgRepo.(userLister)
+	if !ok {
+		d.skip("users", "not supported")
+		return
+	}
+
+	cfgs, err := lister.GetAllUserConfigs(ctx)
+	if !d.add("users", err, fmt.Sprintf("%d configured", len(cfgs))) {
+		return
+	}
+
+	for _, cfg := range cfgs {
+		d.add("user "+cfg.Email, s.checkUser(ctx, cfg), backendName(cfg))
+	}
+}
+
+// checkUser verifies that the accounting backend of a user can be reached
+// with its token and that its account mappings point to existing accounts.
+func (s *Sync) checkUser(ctx context.Context, cfg userconfigserv.UserConfig) error {
+	if backendName(cfg) == accountingservtypes.BackendToshl && cfg.Toshl.Token == "" {
+		return errs.New("there is no toshl token")
+	}
+
+	repo, token, err := s.accountingFor(ctx, cfg)
+	if err != nil {
+		return err
+	}
+
+	accounts, err := repo.GetAccounts(ctx, token)
+	if err != nil {
+		return errs.New("could not get accounts: %w", err)
+	}
+
+	if _, opens := repo.(accountOpener); len(accounts) == 0 && !opens {
+		return errs.New("there are no accounts")
+	}
+
+	var group errs.Group
+	for bank, mappings := range cfg.Mapping {
+		resolved := getAccountsMapping(accounts, cfg, bank)
+		for number, target := range mappings {
+			if _, ok := resolved[number]; !ok {
+				group.Add(errs.New("account %q of %s is mapped to %q, which does not exist", number, bank, target))
+			}
+		}
+	}
+
+	return group.Err()
+}
+
+// ChecksFailed tells whether any of the checks failed.
+func ChecksFailed(checks []Check) bool {
+	return slices.ContainsFunc(checks, func(c Check) bool {
+		return c.Status == CheckFail
+	})
+}
+
+// WriteChecks writes the checks in a human readable form, followed by a
+// summary.
+func WriteChecks(out io.Writer, checks []Check) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	counts := make(map[string]int)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+	for _, c := range checks {
+		counts[c.Status]++
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+	}
+	fmt.Fprintf(w, "\n%d passed, %d failed, %d skipped\n", counts[CheckPass], counts[CheckFail], counts[CheckSkip])
+
+	return w.Flush()
+}
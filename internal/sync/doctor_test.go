@@ -0,0 +1,321 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/result"
+)
+
+// newTestSync returns a sync that uses deps instead of configuring its own.
+func newTestSync(cfg types.Config, deps *Dependencies) *Sync {
+	s := &Sync{Config: cfg}
+	s.configOnce.Do(func() {})
+	s.deps = deps
+
+	return s
+}
+
+type fakeMail struct {
+	mailboxes []string
+	err       error
+
+	// messages are in every mailbox
+	messages []mailservtypes.Message
+
+	lists     int
+	created   []string
+	fetched   []string
+	appliedTo []string
+	applied   []mailservtypes.DispositionGroup
+}
+
+func (f *fakeMail) GetMailboxes(context.Context) ([]mailservtypes.Mailbox, error) {
+	f.lists++
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	mailboxes := make([]mailservtypes.Mailbox, 0, len(f.mailboxes))
+	for _, name := range f.mailboxes {
+		mailboxes = append(mailboxes, mailservtypes.Mailbox{Name: name, Delimiter: "/"})
+	}
+
+	return mailboxes, nil
+}
+
+func (f *fakeMail) ResolveMailbox(_ context.Context, name string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	if !slices.Contains(f.mailboxes, name) {
+		return "", mailservtypes.ErrMailboxNotFound.New("%s", name)
+	}
+
+	return name, nil
+}
+
+func (f *fakeMail) CreateMailbox(_ context.Context, name string) (string, error) {
+	f.created = append(f.created, name)
+	f.mailboxes = append(f.mailboxes, name)
+
+	return name, nil
+}
+
+func (f *fakeMail) GetMessagesFromMailbox(
+	_ context.Context, mailbox string, _ time.Time, _ ...string,
+) (<-chan result.Result[mailservtypes.Message], error) {
+	f.fetched = append(f.fetched, mailbox)
+
+	ch := make(chan result.Result[mailservtypes.Message], len(f.messages))
+	for _, m := range f.messages {
+		ch <- result.ConcreteResult[mailservtypes.Message]{Val: m}
+	}
+	close(ch)
+
+	return ch, nil
+}
+
+func (f *fakeMail) ApplyDispositions(
+	_ context.Context,
+	mailbox string,
+	groups ...mailservtypes.DispositionGroup,
+) error {
+	f.appliedTo = append(f.appliedTo, mailbox)
+	f.applied = append(f.applied, groups...)
+	return nil
+}
+
+type fakeDates struct {
+	last     time.Time
+	saved    []time.Time
+	tableErr error
+}
+
+func (f *fakeDates) GetLastProcessedDate(context.Context) (time.Time, error) {
+	return f.last, nil
+}
+
+func (f *fakeDates) SaveProcessedDate(_ context.Context, t time.Time) error {
+	f.saved = append(f.saved, t)
+	f.last = t
+
+	return nil
+}
+
+func (f *fakeDates) SaveRunReport(context.Context, time.Time, any) error { return nil }
+
+func (f *fakeDates) CheckTable(context.Context) error { return f.tableErr }
+
+type fakeUsers struct {
+	configs []userconfigserv.UserConfig
+}
+
+func (f *fakeUsers) GetUserConfigFromEmail(_ context.Context, email string) (userconfigserv.UserConfig, error) {
+	for _, cfg := range f.configs {
+		if cfg.Email == email {
+			return cfg, nil
+		}
+	}
+
+	return userconfigserv.UserConfig{}, userconfigserv.ErrNotFound.New("%s", email)
+}
+
+func (f *fakeUsers) GetUserConfigFromAPIKey(context.Context, string) (userconfigserv.UserConfig, error) {
+	return userconfigserv.UserConfig{}, userconfigserv.ErrNotFound.New("no user has the api key")
+}
+
+func (f *fakeUsers) GetAllUserConfigs(context.Context) ([]userconfigserv.UserConfig, error) {
+	return f.configs, nil
+}
+
+type fakeAccounting struct {
+	accounts   []accountingservtypes.Account
+	categories []accountingservtypes.Category
+
+	entries []accountingservtypes.CreateEntryInput
+}
+
+func (f *fakeAccounting) GetAccounts(context.Context, string) ([]accountingservtypes.Account, error) {
+	return f.accounts, nil
+}
+
+func (f *fakeAccounting) GetCategories(context.Context, string) ([]accountingservtypes.Category, error) {
+	return f.categories, nil
+}
+
+func (f *fakeAccounting) CreateCategory(
+	_ context.Context, _, catType, category string,
+) (accountingservtypes.Category, error) {
+	return accountingservtypes.Category{ID: category, Name: category, Type: catType}, nil
+}
+
+func (f *fakeAccounting) CreateEntry(_ context.Context, _ string, in accountingservtypes.CreateEntryInput) error {
+	f.entries = append(f.entries, in)
+	return nil
+}
+
+func (f *fakeAccounting) GetEntries(context.Context, string, time.Time, time.Time) ([]accountingservtypes.Entry, error) {
+	return nil, nil
+}
+
+type fakeNotifications struct {
+	smsErr error
+}
+
+func (f *fakeNotifications) SendSMS(context.Context, string, string) error { return nil }
+
+func (f *fakeNotifications) SendMail(context.Context, string) error { return nil }
+
+func (f *fakeNotifications) CheckSMS(context.Context) error { return f.smsErr }
+
+func newDoctorSync() (*Sync, *Dependencies) {
+	deps := &Dependencies{
+		TimeLocale: time.UTC,
+		DateRepo:   &fakeDates{},
+		MailRepo:   &fakeMail{mailboxes: []string{"INBOX", "Processed", "Failed"}},
+		UserCfgRepo: &fakeUsers{configs: []userconfigserv.UserConfig{{
+			Email:   "user@example.com",
+			Toshl:   userconfigserv.ToshlConfig{Token: "token"},
+			Mapping: map[string]userconfigserv.MappingConfig{"bancolombia": {"5678": "1234"}},
+		}}},
+		AccountingRepo: &fakeAccounting{accounts: []accountingservtypes.Account{
+			{ID: "1", Name: "1234 Bancolombia"},
+		}},
+		NotificationServ: &fakeNotifications{},
+	}
+
+	cfg := types.Config{
+		Timezone:          "UTC",
+		SuccessMailbox:    "Processed",
+		ParseErrorMailbox: "Failed",
+	}
+
+	return newTestSync(cfg, deps), deps
+}
+
+func checkStatuses(checks []Check) map[string]string {
+	statuses := make(map[string]string, len(checks))
+	for _, c := range checks {
+		statuses[c.Name] = c.Status
+	}
+
+	return statuses
+}
+
+func Test_DoctorPass(t *testing.T) {
+	s, _ := newDoctorSync()
+
+	checks := s.Doctor(context.Background(), DoctorOptions{})
+
+	assert.Equal(t, map[string]string{
+		"timezone":              CheckPass,
+		"configuration":         CheckPass,
+		"imap login":            CheckPass,
+		"mailboxes":             CheckPass,
+		"mailbox INBOX":         CheckPass,
+		"mailbox Processed":     CheckPass,
+		"mailbox Failed":        CheckPass,
+		"state store: dates":    CheckPass,
+		"state store: users":    CheckSkip,
+		"users":                 CheckPass,
+		"user user@example.com": CheckPass,
+		"twilio":                CheckPass,
+	}, checkStatuses(checks))
+	assert.False(t, ChecksFailed(checks))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteChecks(&buf, checks))
+	assert.Contains(t, buf.String(), "11 passed, 0 failed, 1 skipped")
+}
+
+func Test_DoctorLoginFailed(t *testing.T) {
+	s, deps := newDoctorSync()
+	deps.MailRepo = &fakeMail{err: mailservtypes.ErrLogin.New("invalid credentials")}
+
+	checks := s.Doctor(context.Background(), DoctorOptions{})
+
+	statuses := checkStatuses(checks)
+	assert.Equal(t, CheckFail, statuses["imap login"])
+	assert.Equal(t, CheckSkip, statuses["mailboxes"])
+	assert.NotContains(t, statuses, "mailbox INBOX")
+	// the other dependencies are still checked
+	assert.Equal(t, CheckPass, statuses["twilio"])
+	assert.True(t, ChecksFailed(checks))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteChecks(&buf, checks))
+	assert.Contains(t, buf.String(), "1 failed, 2 skipped")
+	assert.Contains(t, buf.String(), "invalid credentials")
+}
+
+func Test_DoctorMissingMailbox(t *testing.T) {
+	s, deps := newDoctorSync()
+	mail := &fakeMail{mailboxes: []string{"INBOX", "Processed"}}
+	deps.MailRepo = mail
+
+	checks := s.Doctor(context.Background(), DoctorOptions{})
+	assert.Equal(t, CheckFail, checkStatuses(checks)["mailbox Failed"])
+	assert.True(t, ChecksFailed(checks))
+	assert.Empty(t, mail.created)
+
+	var asked []string
+	checks = s.Doctor(context.Background(), DoctorOptions{
+		CreateMailbox: func(name string) bool {
+			asked = append(asked, name)
+			return true
+		},
+	})
+	assert.Equal(t, CheckPass, checkStatuses(checks)["mailbox Failed"])
+	assert.False(t, ChecksFailed(checks))
+	assert.Equal(t, []string{"Failed"}, asked)
+	assert.Equal(t, []string{"Failed"}, mail.created)
+}
+
+func Test_DoctorFailures(t *testing.T) {
+	s, deps := newDoctorSync()
+	s.Config.Timezone = "Nowhere/Atlantis"
+	deps.DateRepo = &fakeDates{tableErr: errs.New("table toshl-data is CREATING")}
+	deps.NotificationServ = &fakeNotifications{smsErr: errs.New("invalid auth token")}
+	deps.UserCfgRepo = &fakeUsers{configs: []userconfigserv.UserConfig{
+		{
+			Email:   "unmapped@example.com",
+			Toshl:   userconfigserv.ToshlConfig{Token: "token"},
+			Mapping: map[string]userconfigserv.MappingConfig{"bancolombia": {"5678": "9999"}},
+		},
+		{Email: "notoken@example.com"},
+	}}
+
+	checks := s.Doctor(context.Background(), DoctorOptions{})
+
+	statuses := checkStatuses(checks)
+	assert.Equal(t, CheckFail, statuses["timezone"])
+	assert.Equal(t, CheckFail, statuses["state store: dates"])
+	assert.Equal(t, CheckFail, statuses["twilio"])
+	assert.Equal(t, CheckPass, statuses["users"])
+	assert.Equal(t, CheckFail, statuses["user unmapped@example.com"])
+	assert.Equal(t, CheckFail, statuses["user notoken@example.com"])
+	assert.True(t, ChecksFailed(checks))
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteChecks(&buf, checks))
+	assert.Contains(t, buf.String(), "5 failed")
+	assert.Contains(t, buf.String(), `account "5678" of bancolombia is mapped to "9999"`)
+}
+
+func Test_ChecksFailed(t *testing.T) {
+	assert.False(t, ChecksFailed(nil))
+	assert.False(t, ChecksFailed([]Check{{Status: CheckPass}, {Status: CheckSkip}}))
+	assert.True(t, ChecksFailed([]Check{{Status: CheckPass}, {Status: CheckFail}}))
+}
@@ -0,0 +1,222 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+)
+
+var ErrDuplicateEntry = errs.Class("duplicate entry")
+
+// Import registers transactions read from files, such as bank exports, for
+// the user with the given email. Transactions that already have a matching
+// entry in accounting (same day, account and amount) are skipped.
+func (s *Sync) Import(
+	ctx context.Context,
+	email string,
+	trxs []*banktypes.TrxInfo,
+) (_ []IngestResult, genErr error) {
+	log := logging.FromContext(ctx)
+	defer func() { genErr = syncErr.Wrap(genErr) }()
+
+	if err := s.configure(ctx); err != nil {
+		return nil, err
+	}
+
+	cfg, err := s.deps.UserCfgRepo.GetUserConfigFromEmail(ctx, email)
+	if err != nil {
+		return nil, errs.New("could not get user config for %q: %w", email, err)
+	}
+
+	for n, t := range trxs {
+		if t.OriginMessage != nil {
+			continue
+		}
+
+		// registering looks up the user from the recipients of the message
+		t.OriginMessage = banktypes.TextMessage{
+			Key:       fmt.Sprintf("import/%s/%d", t.Bank, n),
+			Sender:    t.Bank.String(),
+			Recipient: cfg.Email,
+			Sent:      t.Date,
+			Text:      t.Description,
+		}
+	}
+
+	duplicates, err := s.findDuplicates(ctx, cfg, trxs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]IngestResult, 0, len(trxs))
+	pending := make([]*banktypes.TrxInfo, 0, len(trxs))
+	for _, t := range trxs {
+		if duplicates[t] {
+			results = append(results, IngestResult{
+				Message: t.OriginMessage,
+				Trx:     t,
+				Err: ErrDuplicateEntry.New(
+					"%s %s %.2f",
+					t.Date.In(s.deps.TimeLocale).Format("2006-01-02"),
+					t.Account,
+					signedAmount(t),
+				),
+			})
+			continue
+		}
+
+		pending = append(pending, t)
+	}
+
+	log.Info("importing transactions",
+		logging.String("email", cfg.Email),
+		logging.Int("trxs", len(trxs)),
+		logging.Int("duplicates", len(trxs)-len(pending)),
+	)
+
+	processed, err := s.registerTrxsIntoAccounting(ctx, pending)
+	if err != nil {
+		return nil, err
+	}
+
+	for r := range processed {
+		v := r.Value()
+		results = append(results, IngestResult{
+			Message: v.Trx.OriginMessage,
+			Trx:     v.Trx,
+			Err:     r.Err(),
+		})
+	}
+
+	return results, nil
+}
+
+// skipRegistered returns the transactions of the statement in msg without the
+// ones that already have an entry in accounting, and how many were left out,
+// so that a statement that is retried after some of its rows failed does not
+// register the other rows twice.
+func (s *Sync) skipRegistered(
+	ctx context.Context,
+	msg banktypes.Message,
+	trxs []*banktypes.TrxInfo,
+) ([]*banktypes.TrxInfo, int, error) {
+	if len(trxs) == 0 {
+		return trxs, 0, nil
+	}
+
+	cfg, err := s.getUserConfigFromCandidates(ctx, msg.To())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	duplicates, err := s.findDuplicates(ctx, cfg, trxs)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pending := make([]*banktypes.TrxInfo, 0, len(trxs))
+	for _, t := range trxs {
+		if !duplicates[t] {
+			pending = append(pending, t)
+		}
+	}
+
+	return pending, len(trxs) - len(pending), nil
+}
+
+func (s *Sync) findDuplicates(
+	ctx context.Context,
+	cfg userconfigserv.UserConfig,
+	trxs []*banktypes.TrxInfo,
+) (map[*banktypes.TrxInfo]bool, error) {
+	if len(trxs) == 0 {
+		return nil, nil
+	}
+
+	loc := s.deps.TimeLocale
+
+	repo, token, err := s.accountingFor(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	accounts, err := repo.GetAccounts(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	from, to := trxs[0].Date, trxs[0].Date
+	for _, t := range trxs {
+		if t.Date.Before(from) {
+			from = t.Date
+		}
+		if t.Date.After(to) {
+			to = t.Date
+		}
+	}
+
+	entries, err := repo.GetEntries(ctx, token, from.In(loc), to.In(loc))
+	if err != nil {
+		return nil, err
+	}
+
+	type entryKey struct {
+		Date      string
+		AccountID string
+		Cents     int64
+	}
+
+	const dateFormat = "2006-01-02"
+	cents := func(v float64) int64 {
+		return int64(math.Round(v * 100))
+	}
+
+	// counted, so that two identical purchases on the same day in the file
+	// only match two existing entries
+	existing := make(map[entryKey]int, len(entries))
+	for _, e := range entries {
+		k := entryKey{
+			Date:      e.Date.Format(dateFormat),
+			AccountID: e.AccountID,
+			Cents:     cents(e.Currency.Number),
+		}
+		existing[k]++
+	}
+
+	mappings := make(map[string]map[string]accountingservtypes.Account)
+	duplicates := make(map[*banktypes.TrxInfo]bool)
+	for _, t := range trxs {
+		bank := t.Bank.String()
+		mapping, ok := mappings[bank]
+		if !ok {
+			mapping = getAccountsMapping(accounts, cfg, bank)
+			mappings[bank] = mapping
+		}
+
+		account, ok := mapping[t.Account]
+		if !ok {
+			// registering will report the missing account
+			continue
+		}
+
+		k := entryKey{
+			Date:      t.Date.In(loc).Format(dateFormat),
+			AccountID: account.ID,
+			Cents:     cents(signedAmount(t)),
+		}
+
+		if existing[k] > 0 {
+			existing[k]--
+			duplicates[t] = true
+		}
+	}
+
+	return duplicates, nil
+}
@@ -0,0 +1,87 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+)
+
+var ErrNoBankMatched = errs.Class("no bank matched")
+
+type IngestResult struct {
+	Message banktypes.Message
+	Trx     *banktypes.TrxInfo
+	Err     error
+}
+
+// Ingest runs messages that did not come from the mailbox through the same
+// parsing and accounting steps as Run. Mailboxes and the last processed date
+// are left untouched.
+func (s *Sync) Ingest(
+	ctx context.Context,
+	msgs ...banktypes.Message,
+) (_ []IngestResult, genErr error) {
+	log := logging.FromContext(ctx)
+	defer func() { genErr = syncErr.Wrap(genErr) }()
+
+	if err := s.configure(ctx); err != nil {
+		return nil, err
+	}
+
+	banks := s.deps.BanksRepo.GetBanks(ctx)
+
+	results := make([]IngestResult, 0, len(msgs))
+	trxs := make([]*banktypes.TrxInfo, 0, len(msgs))
+	for _, msg := range msgs {
+		trx, bank, err := parseMessage(ctx, banks, msg)
+		if bank == nil {
+			err = ErrNoBankMatched.New("from %v", msg.From())
+		}
+
+		if err != nil {
+			results = append(results, IngestResult{
+				Message: msg,
+				Err:     err,
+			})
+			continue
+		}
+
+		trxs = append(trxs, trx)
+	}
+
+	log.Debug("ingesting messages",
+		logging.Int("msgs", len(msgs)),
+		logging.Int("trxs", len(trxs)),
+	)
+
+	processed, err := s.registerTrxsIntoAccounting(ctx, trxs)
+	if err != nil {
+		return nil, err
+	}
+
+	for r := range processed {
+		v := r.Value()
+		results = append(results, IngestResult{
+			Message: v.Trx.OriginMessage,
+			Trx:     v.Trx,
+			Err:     r.Err(),
+		})
+	}
+
+	return results, nil
+}
+
+func (s *Sync) GetUserConfigFromAPIKey(
+	ctx context.Context,
+	key string,
+) (userconfigserv.UserConfig, error) {
+	if err := s.configure(ctx); err != nil {
+		return userconfigserv.UserConfig{}, syncErr.Wrap(err)
+	}
+
+	return s.deps.UserCfgRepo.GetUserConfigFromAPIKey(ctx, key)
+}
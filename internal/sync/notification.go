@@ -10,7 +10,8 @@ import (
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
 )
 
-func (s *Sync) notifyUsers(ctx context.Context, responses []registerResponse) error {
+// notifyUsers returns the result of the notification of every user, by email.
+func (s *Sync) notifyUsers(ctx context.Context, responses []registerResponse) map[string]error {
 	log := logging.FromContext(ctx)
 
 	notifPerUser := make(map[string][]registerResponse, len(responses))
@@ -27,6 +28,7 @@ func (s *Sync) notifyUsers(ctx context.Context, responses []registerResponse) er
 		notifPerUser[email] = v
 	}
 
+	results := make(map[string]error, len(notifPerUser))
 	for k, v := range notifPerUser {
 		smsNumber := v[0].Cfg.SMSDeliveryNumber
 		err := s.notifyUserWithSMS(ctx, smsNumber, v)
@@ -37,9 +39,10 @@ func (s *Sync) notifyUsers(ctx context.Context, responses []registerResponse) er
 				logging.Error(err),
 			)
 		}
+		results[k] = err
 	}
 
-	return nil
+	return results
 }
 
 func (s *Sync) notifyUserWithSMS(
@@ -68,7 +71,10 @@ func (s *Sync) notifyUserWithSMS(
 
 		r := responses[i]
 		date := r.Trx.Date
-		description := r.Trx.Description
+		description := r.Trx.Merchant
+		if description == "" {
+			description = r.Trx.Description
+		}
 		value := r.Trx.Value.Number
 		sign := ""
 
@@ -98,6 +104,11 @@ func (s *Sync) notifyUserWithSMS(
 			logging.String("to_number", toNumber),
 			logging.String("msg", msg),
 		)
+		s.Plan.addNotification(PlannedNotification{
+			User:    responses[0].Cfg.Email,
+			To:      toNumber,
+			Message: msg,
+		})
 		return nil
 	}
 
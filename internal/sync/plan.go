@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+// Plan is what a dry run would have done. Its items are sorted, so that the
+// plans of different runs or versions can be compared.
+type Plan struct {
+	Entries       []PlannedEntry        `json:"entries"`
+	Categories    []PlannedCategory     `json:"categories"`
+	Messages      []PlannedDisposition  `json:"messages"`
+	Notifications []PlannedNotification `json:"notifications"`
+	// LastProcessedDate is the date that the next run would fetch messages
+	// from
+	LastProcessedDate time.Time `json:"last_processed_date"`
+
+	mu sync.Mutex
+}
+
+type PlannedEntry struct {
+	User         string                               `json:"user"`
+	Bank         string                               `json:"bank"`
+	MessageID    uint32                               `json:"message_id"`
+	Category     string                               `json:"category"`
+	CategoryType string                               `json:"category_type"`
+	Account      string                               `json:"account"`
+	Entry        accountingservtypes.CreateEntryInput `json:"entry"`
+}
+
+type PlannedCategory struct {
+	User string `json:"user"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// PlannedDisposition is a disposition applied to messages of the inbox, with
+// the mailboxes as they are named in the server.
+type PlannedDisposition struct {
+	Outcome     string                    `json:"outcome"`
+	MessageIDs  []uint32                  `json:"message_ids"`
+	Disposition mailservtypes.Disposition `json:"disposition"`
+}
+
+type PlannedNotification struct {
+	User    string `json:"user"`
+	To      string `json:"to"`
+	Message string `json:"message"`
+}
+
+// The plan is only recorded when there is one, so these are safe to call on
+// a nil plan.
+
+func (p *Plan) addEntry(e *EntryProposal) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Entries = append(p.Entries, PlannedEntry{
+		User:         e.User,
+		Bank:         e.Bank,
+		MessageID:    e.MessageID,
+		Category:     e.Category,
+		CategoryType: e.CategoryType,
+		Account:      e.Account.Name,
+		Entry:        e.Entry,
+	})
+}
+
+func (p *Plan) addCategory(c PlannedCategory) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !slices.Contains(p.Categories, c) {
+		p.Categories = append(p.Categories, c)
+	}
+}
+
+func (p *Plan) addDisposition(outcome string, g mailservtypes.DispositionGroup) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ids := slices.Clone(g.IDs)
+	slices.Sort(ids)
+
+	p.Messages = append(p.Messages, PlannedDisposition{
+		Outcome:     outcome,
+		MessageIDs:  ids,
+		Disposition: g.Disposition,
+	})
+}
+
+func (p *Plan) addNotification(n PlannedNotification) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.Notifications = append(p.Notifications, n)
+}
+
+func (p *Plan) setLastProcessedDate(t time.Time) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.LastProcessedDate = t
+}
+
+// sort orders the items that are recorded concurrently.
+func (p *Plan) sort() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	slices.SortStableFunc(p.Entries, func(a, b PlannedEntry) int {
+		if c := cmp.Compare(a.MessageID, b.MessageID); c != 0 {
+			return c
+		}
+		if c := a.Entry.Date.Compare(b.Entry.Date); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Entry.Description, b.Entry.Description)
+	})
+	slices.SortFunc(p.Categories, func(a, b PlannedCategory) int {
+		if c := cmp.Compare(a.User, b.User); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Type, b.Type); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Name, b.Name)
+	})
+	slices.SortFunc(p.Notifications, func(a, b PlannedNotification) int {
+		return cmp.Compare(a.User, b.User)
+	})
+}
@@ -0,0 +1,109 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+func testProposal(repo accountingService, id uint32, category, description string) *EntryProposal {
+	return &EntryProposal{
+		Bank:         "bancolombia",
+		User:         "user@example.com",
+		MessageID:    id,
+		CategoryType: "expense",
+		Category:     category,
+		Account:      accountingservtypes.Account{ID: "1", Name: "1234 Bancolombia"},
+		Entry: accountingservtypes.CreateEntryInput{
+			Date:        time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC),
+			Currency:    currency.Amount{Code: "COP", Number: -30000},
+			Description: description,
+			AccountID:   "1",
+		},
+		repo:  repo,
+		token: "token",
+	}
+}
+
+func Test_DryRunPlan(t *testing.T) {
+	ctx := context.Background()
+
+	mail := &fakeMail{}
+	accounting := &fakeAccounting{categories: []accountingservtypes.Category{
+		{ID: "c1", Name: "Mercado", Type: "expense"},
+	}}
+	s := newTestSync(types.Config{SuccessMailbox: "Processed", ParseErrorMailbox: "Failed"}, &Dependencies{
+		MailRepo:       mail,
+		AccountingRepo: accounting,
+	})
+	s.DryRun = true
+	s.Plan = &Plan{}
+
+	// the entries are recorded concurrently, so in any order
+	require.NoError(t, s.createEntry(ctx, testProposal(accounting, 3, "Restaurantes", "** compra de Crepes")))
+	require.NoError(t, s.createEntry(ctx, testProposal(accounting, 1, "Mercado", "** compra de Exito")))
+	require.NoError(t, s.createEntry(ctx, testProposal(accounting, 2, "Restaurantes", "** compra de Wok")))
+
+	_, err := s.disposeMessages(ctx, map[string][]banktypes.Message{
+		OutcomeSuccess:    {testMessage(3), testMessage(1), testMessage(2)},
+		OutcomeParseError: {testMessage(4)},
+	}, nil)
+	require.NoError(t, err)
+
+	s.Plan.addNotification(PlannedNotification{User: "z@example.com", To: "+570000000002", Message: "b"})
+	s.Plan.addNotification(PlannedNotification{User: "a@example.com", To: "+570000000001", Message: "a"})
+	s.Plan.setLastProcessedDate(time.Date(2024, time.March, 15, 14, 32, 0, 0, time.UTC))
+
+	s.Plan.sort()
+
+	raw, err := json.MarshalIndent(s.Plan, "", "  ")
+	require.NoError(t, err)
+
+	golden, err := os.ReadFile(filepath.Join("testdata", "plan.golden.json"))
+	require.NoError(t, err)
+	assert.Equal(t, string(golden), string(raw)+"\n")
+
+	// nothing was written
+	assert.Empty(t, mail.applied)
+}
+
+func Test_NilPlan(t *testing.T) {
+	var p *Plan
+
+	assert.NotPanics(t, func() {
+		p.addEntry(&EntryProposal{})
+		p.addCategory(PlannedCategory{Name: "Mercado"})
+		p.addDisposition(OutcomeSuccess, mailservtypes.DispositionGroup{IDs: []uint32{1}})
+		p.addNotification(PlannedNotification{User: "user@example.com"})
+		p.setLastProcessedDate(time.Now())
+		p.sort()
+	})
+
+	// a dry run without a plan still does not write anything
+	mail := &fakeMail{}
+	accounting := &fakeAccounting{}
+	s := newTestSync(types.Config{SuccessMailbox: "Processed"}, &Dependencies{
+		MailRepo:       mail,
+		AccountingRepo: accounting,
+	})
+	s.DryRun = true
+
+	require.NoError(t, s.createEntry(context.Background(), testProposal(accounting, 1, "Mercado", "** compra de Exito")))
+	_, err := s.disposeMessages(context.Background(), map[string][]banktypes.Message{
+		OutcomeSuccess: {testMessage(1)},
+	}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, mail.applied)
+}
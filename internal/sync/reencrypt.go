@@ -0,0 +1,29 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/zeebo/errs"
+)
+
+type userReencrypter interface {
+	ReencryptUserConfigs(ctx context.Context, dryRun bool) (int, error)
+}
+
+// ReencryptUsers encrypts the tokens and phone numbers of every user config
+// with the current master key, and returns how many configs were encrypted,
+// or would be on a dry run.
+func (s *Sync) ReencryptUsers(ctx context.Context) (_ int, genErr error) {
+	defer func() { genErr = syncErr.Wrap(genErr) }()
+
+	if err := s.configure(ctx); err != nil {
+		return 0, err
+	}
+
+	reencrypter, ok := s.deps.UserCfgRepo.(userReencrypter)
+	if !ok {
+		return 0, errs.New("user configs can not be encrypted")
+	}
+
+	return reencrypter.ReencryptUserConfigs(ctx, s.DryRun)
+}
@@ -0,0 +1,220 @@
+package sync
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+)
+
+const (
+	StageFetch    = "fetch"
+	StageParse    = "parse"
+	StageRegister = "register"
+	StageMove     = "move"
+	StageNotify   = "notify"
+)
+
+// RunReport summarizes an execution of Run.
+type RunReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DryRun     bool      `json:"dry_run"`
+	Version    string    `json:"version"`
+	// Ignored are the messages that no bank or statement importer handles
+	Ignored int `json:"ignored"`
+	// Skipped are the transactions that were skipped in review
+	Skipped int `json:"skipped,omitempty"`
+	// Duplicates are the rows of statements that were already registered
+	Duplicates int                      `json:"duplicates,omitempty"`
+	Stages     []*StageReport           `json:"stages"`
+	Banks      map[string]*ReportCounts `json:"banks"`
+	Users      map[string]*ReportCounts `json:"users"`
+	Errors     []ReportError            `json:"errors"`
+	// OmittedErrors are the errors left out of a saved report
+	OmittedErrors int `json:"omitted_errors,omitempty"`
+}
+
+// The errors of saved reports are limited, so that a run where everything
+// fails still fits in a DynamoDB item.
+const (
+	maxSavedErrors      = 200
+	maxSavedErrorLength = 1000
+)
+
+type StageReport struct {
+	Name       string `json:"name"`
+	Succeeded  int    `json:"succeeded"`
+	Failed     int    `json:"failed"`
+	DurationMS int64  `json:"duration_ms"`
+
+	started time.Time
+}
+
+type ReportCounts struct {
+	Parsed         int `json:"parsed,omitempty"`
+	ParseFailed    int `json:"parse_failed,omitempty"`
+	Registered     int `json:"registered,omitempty"`
+	RegisterFailed int `json:"register_failed,omitempty"`
+}
+
+// ReportError is an error of a stage, with the message it happened with when
+// there is one.
+type ReportError struct {
+	Stage     string    `json:"stage"`
+	MessageID uint32    `json:"message_id,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Date      time.Time `json:"date"`
+	Bank      string    `json:"bank,omitempty"`
+	User      string    `json:"user,omitempty"`
+	Error     string    `json:"error"`
+}
+
+func newRunReport(dryRun bool, version string) *RunReport {
+	return &RunReport{
+		StartedAt: time.Now(),
+		DryRun:    dryRun,
+		Version:   version,
+		Banks:     make(map[string]*ReportCounts),
+		Users:     make(map[string]*ReportCounts),
+	}
+}
+
+func (r *RunReport) startStage(name string) *StageReport {
+	s := &StageReport{
+		Name:    name,
+		started: time.Now(),
+	}
+	r.Stages = append(r.Stages, s)
+
+	return s
+}
+
+func (s *StageReport) finish() {
+	s.DurationMS = time.Since(s.started).Milliseconds()
+}
+
+func (r *RunReport) bank(name string) *ReportCounts {
+	c, ok := r.Banks[name]
+	if !ok {
+		c = &ReportCounts{}
+		r.Banks[name] = c
+	}
+
+	return c
+}
+
+func (r *RunReport) user(email string) *ReportCounts {
+	c, ok := r.Users[email]
+	if !ok {
+		c = &ReportCounts{}
+		r.Users[email] = c
+	}
+
+	return c
+}
+
+func (r *RunReport) addError(stage string, msg banktypes.Message, err error) *ReportError {
+	e := ReportError{
+		Stage: stage,
+		Error: err.Error(),
+	}
+
+	if msg != nil {
+		e.MessageID = msg.ID()
+		e.Subject = msg.Subject()
+		e.Date = msg.Date()
+	}
+
+	r.Errors = append(r.Errors, e)
+
+	return &r.Errors[len(r.Errors)-1]
+}
+
+// truncated returns a copy of the report with at most maxErrors errors, each
+// of them cut to maxLength characters.
+func (r RunReport) truncated(maxErrors, maxLength int) RunReport {
+	kept := r.Errors
+	if len(kept) > maxErrors {
+		r.OmittedErrors += len(kept) - maxErrors
+		kept = kept[:maxErrors]
+	}
+
+	r.Errors = make([]ReportError, len(kept))
+	for n, e := range kept {
+		if msg := []rune(e.Error); len(msg) > maxLength {
+			e.Error = string(msg[:maxLength]) + "..."
+		}
+		r.Errors[n] = e
+	}
+
+	return r
+}
+
+// WriteTable writes the report in a human readable form.
+func (r RunReport) WriteTable(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	mode := "execute"
+	if r.DryRun {
+		mode = "dry run"
+	}
+	fmt.Fprintf(w, "run %s (%s), version %s, took %s\n",
+		r.StartedAt.Format(time.RFC3339),
+		mode,
+		r.Version,
+		r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond),
+	)
+	fmt.Fprintf(w, "ignored messages: %d\n", r.Ignored)
+	if r.Skipped > 0 {
+		fmt.Fprintf(w, "skipped in review: %d\n", r.Skipped)
+	}
+	if r.Duplicates > 0 {
+		fmt.Fprintf(w, "already registered: %d\n", r.Duplicates)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintln(w, "STAGE\tSUCCEEDED\tFAILED\tDURATION")
+	for _, s := range r.Stages {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n",
+			s.Name, s.Succeeded, s.Failed, time.Duration(s.DurationMS)*time.Millisecond,
+		)
+	}
+
+	writeCounts := func(title string, counts map[string]*ReportCounts) {
+		if len(counts) == 0 {
+			return
+		}
+
+		names := make([]string, 0, len(counts))
+		for n := range counts {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(w, "\n%s\tPARSED\tPARSE FAILED\tREGISTERED\tREGISTER FAILED\n", strings.ToUpper(title))
+		for _, n := range names {
+			c := counts[n]
+			fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", n, c.Parsed, c.ParseFailed, c.Registered, c.RegisterFailed)
+		}
+	}
+	writeCounts("bank", r.Banks)
+	writeCounts("user", r.Users)
+
+	if len(r.Errors) > 0 {
+		fmt.Fprintln(w, "\nSTAGE\tMESSAGE\tSUBJECT\tERROR")
+		for _, e := range r.Errors {
+			msg := "-"
+			if e.MessageID != 0 {
+				msg = fmt.Sprint(e.MessageID)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Stage, msg, e.Subject, e.Error)
+		}
+	}
+
+	return w.Flush()
+}
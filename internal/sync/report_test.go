@@ -0,0 +1,79 @@
+package sync
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+)
+
+func Test_RunReport(t *testing.T) {
+	report := newRunReport(true, "abc123")
+
+	fetch := report.startStage(StageFetch)
+	fetch.Succeeded = 2
+	fetch.finish()
+
+	report.bank("bancolombia").Parsed++
+	report.bank("bancolombia").Parsed++
+	report.bank("bancolombia").RegisterFailed++
+	report.user("user@example.com").Registered++
+	report.Ignored = 3
+
+	msg := banktypes.TextMessage{
+		Key:   "alert-1",
+		Title: "Alertas y Notificaciones",
+		Sent:  time.Date(2024, time.March, 15, 14, 32, 0, 0, time.UTC),
+	}
+	report.addError(StageRegister, msg, errs.New("account not mapped")).Bank = "bancolombia"
+	report.addError(StageMove, nil, errs.New("mailbox not found"))
+
+	require.Len(t, report.Errors, 2)
+	assert.Equal(t, msg.ID(), report.Errors[0].MessageID)
+	assert.Equal(t, "Alertas y Notificaciones", report.Errors[0].Subject)
+	assert.Equal(t, "bancolombia", report.Errors[0].Bank)
+	assert.Equal(t, "account not mapped", report.Errors[0].Error)
+	assert.Zero(t, report.Errors[1].MessageID)
+	assert.Equal(t, 2, report.Banks["bancolombia"].Parsed)
+
+	var buf bytes.Buffer
+	require.NoError(t, report.WriteTable(&buf))
+
+	out := buf.String()
+	assert.Contains(t, out, "(dry run), version abc123")
+	assert.Contains(t, out, "ignored messages: 3")
+	assert.NotContains(t, out, "skipped in review")
+	assert.Regexp(t, `fetch\s+2\s+0`, out)
+	assert.Regexp(t, `bancolombia\s+2\s+0\s+0\s+1`, out)
+	assert.Regexp(t, `user@example.com\s+0\s+0\s+1\s+0`, out)
+	assert.Regexp(t, `register\s+\d+\s+Alertas y Notificaciones\s+account not mapped`, out)
+	assert.Regexp(t, `move\s+-\s+mailbox not found`, out)
+}
+
+func Test_RunReportTruncated(t *testing.T) {
+	report := newRunReport(false, "dev")
+	for n := 0; n < 5; n++ {
+		report.addError(StageParse, nil, errs.New("%s", strings.Repeat("x", 20)))
+	}
+
+	saved := report.truncated(3, 10)
+
+	require.Len(t, saved.Errors, 3)
+	assert.Equal(t, 2, saved.OmittedErrors)
+	assert.Equal(t, strings.Repeat("x", 10)+"...", saved.Errors[0].Error)
+
+	// the report itself is left as it is
+	assert.Len(t, report.Errors, 5)
+	assert.Zero(t, report.OmittedErrors)
+	assert.Equal(t, strings.Repeat("x", 20), report.Errors[0].Error)
+
+	saved = report.truncated(maxSavedErrors, maxSavedErrorLength)
+	assert.Len(t, saved.Errors, 5)
+	assert.Zero(t, saved.OmittedErrors)
+}
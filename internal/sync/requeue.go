@@ -0,0 +1,105 @@
+package sync
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+)
+
+// Requeue moves the messages that could not be registered back to the inbox,
+// so that the next run processes them again. Only the messages with any of
+// the given failure keywords are moved, or all of them when there are none.
+func (s *Sync) Requeue(ctx context.Context, keywords ...string) (_ int, genErr error) {
+	defer func() { genErr = syncErr.Wrap(genErr) }()
+
+	log := logging.FromContext(ctx)
+
+	if err := s.configure(ctx); err != nil {
+		return 0, err
+	}
+
+	mailbox := s.disposition(OutcomeAccountingError).Move
+	if mailbox == "" {
+		return 0, errs.New("messages that could not be registered are not moved to a mailbox")
+	}
+
+	mailbox, err := s.deps.MailRepo.ResolveMailbox(ctx, mailbox)
+	if err != nil {
+		return 0, err
+	}
+
+	messages, err := s.deps.MailRepo.GetMessagesFromMailbox(ctx, mailbox, time.Time{})
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		group    errs.Group
+		ids      []uint32
+		earliest time.Time
+	)
+	for me := range messages {
+		if me.Err() != nil {
+			group.Add(me.Err())
+			continue
+		}
+
+		msg := me.Value()
+		if len(keywords) > 0 && !slices.ContainsFunc(msg.Flags(), func(f string) bool {
+			return slices.Contains(keywords, f)
+		}) {
+			continue
+		}
+
+		ids = append(ids, msg.ID())
+		if earliest.IsZero() || msg.Date().Before(earliest) {
+			earliest = msg.Date()
+		}
+	}
+	if err := group.Err(); err != nil {
+		return 0, err
+	}
+
+	log.Info("messages to requeue",
+		logging.String("mailbox", mailbox),
+		logging.Int("msgs", len(ids)),
+	)
+
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	if s.DryRun {
+		log.Info("not requeueing messages because of dryrun")
+		return len(ids), nil
+	}
+
+	err = s.deps.MailRepo.ApplyDispositions(ctx, mailbox, mailservtypes.DispositionGroup{
+		Disposition: mailservtypes.Disposition{
+			Move:        "INBOX",
+			RemoveFlags: FailureKeywords,
+		},
+		IDs: ids,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// messages older than the last processed date would not be fetched
+	last, err := s.deps.DateRepo.GetLastProcessedDate(ctx)
+	if err != nil {
+		return len(ids), err
+	}
+	if earliest.Before(last) {
+		if err := s.deps.DateRepo.SaveProcessedDate(ctx, earliest); err != nil {
+			return len(ids), err
+		}
+	}
+
+	return len(ids), nil
+}
@@ -0,0 +1,121 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+func failedMessage(id uint32, date time.Time, flags ...string) mailservtypes.Message {
+	return mailservtypes.Message{Message: imap.Message{
+		SeqNum:   id,
+		Envelope: &imap.Envelope{Date: date},
+		Flags:    flags,
+	}}
+}
+
+func Test_Requeue(t *testing.T) {
+	last := time.Date(2024, time.March, 15, 0, 0, 0, 0, time.UTC)
+
+	messages := []mailservtypes.Message{
+		failedMessage(1, last.AddDate(0, 0, 1), imap.SeenFlag, KeywordUserNotFound),
+		failedMessage(2, last.AddDate(0, 0, -2), KeywordUnmappedAccount),
+		failedMessage(3, last.AddDate(0, 0, -5), KeywordAccountingError),
+		failedMessage(4, last.AddDate(0, 0, -9)),
+	}
+
+	tests := []struct {
+		Name     string
+		Keywords []string
+		DryRun   bool
+		IDs      []uint32
+		// Saved is the watermark that is saved, if any
+		Saved []time.Time
+	}{
+		{
+			Name:  "all",
+			IDs:   []uint32{1, 2, 3, 4},
+			Saved: []time.Time{last.AddDate(0, 0, -9)},
+		},
+		{
+			Name:     "keyword",
+			Keywords: []string{KeywordUnmappedAccount},
+			IDs:      []uint32{2},
+			Saved:    []time.Time{last.AddDate(0, 0, -2)},
+		},
+		{
+			Name:     "keywords",
+			Keywords: []string{KeywordUserNotFound, KeywordAccountingError},
+			IDs:      []uint32{1, 3},
+			Saved:    []time.Time{last.AddDate(0, 0, -5)},
+		},
+		{
+			Name:     "after the watermark",
+			Keywords: []string{KeywordUserNotFound},
+			IDs:      []uint32{1},
+		},
+		{
+			Name:     "dry run",
+			Keywords: []string{KeywordUnmappedAccount},
+			DryRun:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			mail := &fakeMail{
+				mailboxes: []string{"INBOX", "Toshl/Unregistered"},
+				messages:  messages,
+			}
+			dates := &fakeDates{last: last}
+			s := newTestSync(types.Config{
+				AccountingErrorMailbox: "Toshl/Unregistered",
+			}, &Dependencies{MailRepo: mail, DateRepo: dates})
+			s.DryRun = tt.DryRun
+
+			n, err := s.Requeue(context.Background(), tt.Keywords...)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"Toshl/Unregistered"}, mail.fetched)
+			assert.Equal(t, tt.Saved, dates.saved)
+
+			if tt.DryRun {
+				assert.Equal(t, 1, n)
+				assert.Empty(t, mail.applied)
+				return
+			}
+
+			assert.Equal(t, len(tt.IDs), n)
+			assert.Equal(t, []string{"Toshl/Unregistered"}, mail.appliedTo)
+			assert.Equal(t, []mailservtypes.DispositionGroup{{
+				Disposition: mailservtypes.Disposition{
+					Move:        "INBOX",
+					RemoveFlags: FailureKeywords,
+				},
+				IDs: tt.IDs,
+			}}, mail.applied)
+		})
+	}
+}
+
+func Test_RequeueErrors(t *testing.T) {
+	// failed messages are left in the inbox
+	s := newTestSync(types.Config{}, &Dependencies{MailRepo: &fakeMail{}, DateRepo: &fakeDates{}})
+	_, err := s.Requeue(context.Background())
+	assert.ErrorContains(t, err, "not moved to a mailbox")
+
+	mail := &fakeMail{mailboxes: []string{"INBOX"}}
+	s = newTestSync(types.Config{AccountingErrorMailbox: "Unregistered"}, &Dependencies{
+		MailRepo: mail,
+		DateRepo: &fakeDates{},
+	})
+	_, err = s.Requeue(context.Background())
+	assert.True(t, mailservtypes.ErrMailboxNotFound.Has(err))
+	assert.Empty(t, mail.fetched)
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Reviewer decides on every entry before it is created. It can edit the
+// proposal, and returns whether the entry is approved.
+type Reviewer interface {
+	Review(ctx context.Context, p *EntryProposal) (bool, error)
+}
+
+func (s *Sync) review(ctx context.Context, p *EntryProposal) error {
+	approved, err := s.Reviewer.Review(ctx, p)
+	if err != nil {
+		return ErrSkipped.New("could not review entry: %w", err)
+	}
+	if !approved {
+		return ErrSkipped.New("entry was skipped in review")
+	}
+
+	return nil
+}
+
+// PromptReviewer asks what to do with each entry on a terminal. Once the
+// review is quit or there is no more input, the remaining entries are
+// skipped.
+type PromptReviewer struct {
+	In  *bufio.Reader
+	Out io.Writer
+
+	done bool
+}
+
+func NewPromptReviewer(in io.Reader, out io.Writer) *PromptReviewer {
+	return &PromptReviewer{
+		In:  bufio.NewReader(in),
+		Out: out,
+	}
+}
+
+func (r *PromptReviewer) Review(ctx context.Context, p *EntryProposal) (bool, error) {
+	if r.done {
+		return false, nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return false, err
+		}
+
+		r.printProposal(p)
+
+		answer, ok := r.ask("[a]pprove, [s]kip, edit [d]escription, edit [c]ategory, [r]eassign account, [q]uit? ")
+		if !ok {
+			r.done = true
+			return false, nil
+		}
+
+		switch strings.ToLower(answer) {
+		case "a", "approve":
+			return true, nil
+
+		case "s", "skip":
+			return false, nil
+
+		case "q", "quit":
+			r.done = true
+			return false, nil
+
+		case "d", "description":
+			if description, ok := r.ask("description: "); ok && description != "" {
+				p.Entry.Description = description
+			}
+
+		case "c", "category":
+			if category, ok := r.ask("category: "); ok && category != "" {
+				p.Category = category
+			}
+
+		case "r", "reassign":
+			r.reassign(p)
+
+		default:
+			fmt.Fprintf(r.Out, "unknown answer %q\n", answer)
+		}
+	}
+}
+
+func (r *PromptReviewer) printProposal(p *EntryProposal) {
+	w := tabwriter.NewWriter(r.Out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "\nmessage %d from %s for %s\n", p.MessageID, p.Bank, p.User)
+	fmt.Fprintf(w, "  date\t%s\n", p.Entry.Date.Format("2006-01-02 15:04"))
+	fmt.Fprintf(w, "  amount\t%s\n", p.Entry.Currency)
+	fmt.Fprintf(w, "  description\t%s\n", p.Entry.Description)
+	fmt.Fprintf(w, "  category\t%s (%s)\n", p.Category, p.CategoryType)
+	fmt.Fprintf(w, "  account\t%s\n", p.Account.Name)
+
+	_ = w.Flush()
+}
+
+func (r *PromptReviewer) reassign(p *EntryProposal) {
+	accounts := p.Accounts()
+	if len(accounts) == 0 {
+		fmt.Fprintln(r.Out, "there are no accounts to choose from")
+		return
+	}
+
+	for i, a := range accounts {
+		fmt.Fprintf(r.Out, "  %d) %s\n", i+1, a.Name)
+	}
+
+	answer, ok := r.ask("account: ")
+	if !ok || answer == "" {
+		return
+	}
+
+	i, err := strconv.Atoi(answer)
+	if err != nil || i < 1 || i > len(accounts) {
+		fmt.Fprintf(r.Out, "there is no account %q\n", answer)
+		return
+	}
+
+	p.Reassign(accounts[i-1])
+}
+
+// ask returns the trimmed answer to question, and false when there is no more
+// input.
+func (r *PromptReviewer) ask(question string) (string, bool) {
+	fmt.Fprint(r.Out, question)
+
+	answer, err := r.In.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(r.Out)
+		return "", false
+	}
+
+	return strings.TrimSpace(answer), true
+}
@@ -0,0 +1,175 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+var reviewAccounts = []accountingservtypes.Account{
+	{ID: "1", Name: "1234 Bancolombia"},
+	{ID: "2", Name: "5678 Nequi"},
+}
+
+func reviewProposal() *EntryProposal {
+	p := testProposal(nil, 1, "Mercado", "** compra de Exito")
+	p.accounts = reviewAccounts
+
+	return p
+}
+
+func Test_PromptReviewer(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Input    string
+		Approved bool
+		// Edit changes a proposal as the answers are expected to
+		Edit   func(p *EntryProposal)
+		Output string
+	}{
+		{Name: "approve", Input: "a\n", Approved: true},
+		{Name: "approve without newline", Input: "approve", Approved: true},
+		{Name: "skip", Input: "s\n"},
+		{
+			Name:     "edit description",
+			Input:    "d\nExito Laureles\na\n",
+			Approved: true,
+			Edit:     func(p *EntryProposal) { p.Entry.Description = "Exito Laureles" },
+		},
+		{
+			Name:     "empty description is kept",
+			Input:    "d\n\na\n",
+			Approved: true,
+		},
+		{
+			Name:     "edit category",
+			Input:    "C\nRestaurantes\na\n",
+			Approved: true,
+			Edit:     func(p *EntryProposal) { p.Category = "Restaurantes" },
+		},
+		{
+			Name:     "reassign",
+			Input:    "r\n2\na\n",
+			Approved: true,
+			Edit:     func(p *EntryProposal) { p.Reassign(reviewAccounts[1]) },
+			Output:   "2) 5678 Nequi",
+		},
+		{
+			Name:     "reassign to a missing account",
+			Input:    "r\n3\na\n",
+			Approved: true,
+			Output:   `there is no account "3"`,
+		},
+		{
+			Name:     "unknown answer",
+			Input:    "x\na\n",
+			Approved: true,
+			Output:   `unknown answer "x"`,
+		},
+		{Name: "edit then skip", Input: "d\nOther\ns\n", Edit: func(p *EntryProposal) { p.Entry.Description = "Other" }},
+		{Name: "quit", Input: "q\n"},
+		{Name: "eof", Input: ""},
+		{Name: "eof while editing", Input: "d\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			var out bytes.Buffer
+			r := NewPromptReviewer(strings.NewReader(tt.Input), &out)
+
+			p := reviewProposal()
+			want := reviewProposal()
+			if tt.Edit != nil {
+				tt.Edit(want)
+			}
+
+			approved, err := r.Review(context.Background(), p)
+			require.NoError(t, err)
+			assert.Equal(t, tt.Approved, approved)
+			assert.Equal(t, want, p)
+			assert.Contains(t, out.String(), "message 1 from bancolombia for user@example.com")
+			assert.Contains(t, out.String(), tt.Output)
+		})
+	}
+}
+
+func Test_PromptReviewerDone(t *testing.T) {
+	ctx := context.Background()
+
+	// the entries after quitting are skipped, even if there is more input
+	r := NewPromptReviewer(strings.NewReader("q\na\n"), &bytes.Buffer{})
+
+	approved, err := r.Review(ctx, reviewProposal())
+	require.NoError(t, err)
+	assert.False(t, approved)
+
+	approved, err = r.Review(ctx, reviewProposal())
+	require.NoError(t, err)
+	assert.False(t, approved)
+
+	r = NewPromptReviewer(strings.NewReader("a\n"), &bytes.Buffer{})
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = r.Review(canceled, reviewProposal())
+	assert.Error(t, err)
+}
+
+func Test_RegisterReviewed(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Input   string
+		Skipped bool
+	}{
+		{Name: "approved", Input: "a\n"},
+		{Name: "skipped", Input: "s\n", Skipped: true},
+		{Name: "quit", Input: "q\n", Skipped: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			accounting := &fakeAccounting{
+				accounts:   []accountingservtypes.Account{{ID: "1", Name: "1234 Bancolombia"}},
+				categories: []accountingservtypes.Category{{ID: "c1", Name: "Mercado", Type: "expense"}},
+			}
+			s := newTestSync(types.Config{}, &Dependencies{
+				TimeLocale: time.UTC,
+				UserCfgRepo: &fakeUsers{configs: []userconfigserv.UserConfig{{
+					Email:   "user@example.com",
+					Toshl:   userconfigserv.ToshlConfig{Token: "token"},
+					Mapping: map[string]userconfigserv.MappingConfig{"bancolombia": {"*1234": "1234"}},
+				}}},
+				AccountingRepo: accounting,
+			})
+			s.Reviewer = NewPromptReviewer(strings.NewReader(tt.Input), &bytes.Buffer{})
+
+			trx := testTrx()
+			msg := trx.OriginMessage.(banktypes.TextMessage)
+			msg.Recipient = "user@example.com"
+			trx.OriginMessage = msg
+			trx.Category = "Mercado"
+
+			_, err := s.registerSingleTrxIntoAccounting(context.Background(), trx)
+			if !tt.Skipped {
+				require.NoError(t, err)
+				assert.Len(t, accounting.entries, 1)
+				return
+			}
+
+			// skipped entries are not created, and their messages are left
+			// in the inbox
+			assert.True(t, ErrSkipped.Has(err), "unexpected error %v", err)
+			assert.Empty(t, accounting.entries)
+		})
+	}
+}
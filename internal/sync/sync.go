@@ -2,20 +2,23 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"sync"
 	"time"
 
-	"slices"
-
 	"github.com/zeebo/errs"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/accountingserv/accountingservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
 	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/result"
 )
 
@@ -23,23 +26,28 @@ var syncErr = errs.Class("sync")
 
 type banksService interface {
 	GetBanks(context.Context) []banktypes.BankDelegate
+	GetStatementImporters(context.Context) []banktypes.StatementImporter
 }
 
 type dateService interface {
 	GetLastProcessedDate(context.Context) (time.Time, error)
 	SaveProcessedDate(context.Context, time.Time) error
+	SaveRunReport(_ context.Context, startedAt time.Time, report any) error
 }
 
 type mailService interface {
-	GetAvailableMailboxes(context.Context) ([]string, error)
+	GetMailboxes(context.Context) ([]mailservtypes.Mailbox, error)
+	ResolveMailbox(_ context.Context, name string) (string, error)
+	CreateMailbox(_ context.Context, name string) (string, error)
 	GetMessagesFromMailbox(
-		context.Context, string, time.Time,
+		_ context.Context, _ string, _ time.Time, skipFlags ...string,
 	) (<-chan result.Result[mailservtypes.Message], error)
-	MoveMessagesToMailbox(_ context.Context, _, _ string, _ ...uint32) error
+	ApplyDispositions(_ context.Context, mailbox string, _ ...mailservtypes.DispositionGroup) error
 }
 
 type userConfigService interface {
 	GetUserConfigFromEmail(context.Context, string) (userconfigserv.UserConfig, error)
+	GetUserConfigFromAPIKey(context.Context, string) (userconfigserv.UserConfig, error)
 }
 
 type accountingService interface {
@@ -54,6 +62,15 @@ type accountingService interface {
 		token string,
 		entryInput accountingservtypes.CreateEntryInput,
 	) error
+	GetEntries(
+		ctx context.Context,
+		token string,
+		from, to time.Time,
+	) ([]accountingservtypes.Entry, error)
+}
+
+type secretResolver interface {
+	Resolve(ctx context.Context, value string) (string, error)
 }
 
 type notificationService interface {
@@ -69,48 +86,132 @@ type Dependencies struct {
 	UserCfgRepo      userConfigService
 	AccountingRepo   accountingService
 	NotificationServ notificationService
+	// NewAccountingBackend builds the backends selected in the user configs
+	// other than Toshl, which is AccountingRepo
+	NewAccountingBackend func(accountingservtypes.BackendConfig) (accountingService, error)
+	// Secrets resolves the tokens of the users that reference secrets, it
+	// should not resolve references to the environment or files of the host
+	Secrets secretResolver
 }
 
 type Sync struct {
 	Config types.Config
 	DryRun bool
+	// Reviewer approves each entry before it is created, entries are created
+	// without review when it is nil
+	Reviewer Reviewer
+	// Plan records what a dry run would do when it is not nil
+	Plan *Plan
 
 	configOnce sync.Once
 	deps       *Dependencies
+	backends   sync.Map
+	// mailboxes has the names in the server of the configured mailboxes
+	mailboxes map[string]string
 }
 
 func (s *Sync) mailSanityCheck(ctx context.Context) error {
 	log := logging.New()
 
-	mailboxes, err := s.deps.MailRepo.GetAvailableMailboxes(ctx)
+	// the configured mailboxes are all resolved against a single listing
+	mailboxes, err := s.deps.MailRepo.GetMailboxes(ctx)
 	if err != nil {
 		return err
 	}
-	log.Debug("mailboxes", zap.Strings("mailboxes", mailboxes))
+	log.Debug("mailboxes", zap.Any("mailboxes", mailboxes))
 
 	const inboxMailbox = "INBOX"
-	if !slices.Contains(mailboxes, inboxMailbox) {
+	if _, err := mailserv.FindMailbox(mailboxes, inboxMailbox); err != nil {
 		return errs.New("there is no inbox mailbox")
 	}
 
-	if !slices.Contains(mailboxes, s.Config.ParseErrorMailbox) {
-		return errs.New("there is no parse error mailbox: %s", s.Config.ParseErrorMailbox)
+	s.mailboxes = make(map[string]string)
+	for _, name := range s.dispositionMailboxes() {
+		if err := s.resolveMailbox(ctx, mailboxes, name); err != nil {
+			return errs.New("there is no mailbox %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveMailbox finds the configured mailbox in the server, and creates it
+// when it is missing and the config allows it.
+func (s *Sync) resolveMailbox(ctx context.Context, mailboxes []mailservtypes.Mailbox, name string) error {
+	log := logging.FromContext(ctx)
+
+	if name == "" {
+		return errs.New("mailbox is not configured")
+	}
+
+	actual, err := mailserv.FindMailbox(mailboxes, name)
+	if err == nil {
+		s.mailboxes[name] = actual
+		return nil
+	}
+	if !mailservtypes.ErrMailboxNotFound.Has(err) || !s.Config.CreateMailboxes {
+		return err
 	}
 
-	if !slices.Contains(mailboxes, s.Config.SuccessMailbox) {
-		return errs.New("there is no success mailbox: %s", s.Config.SuccessMailbox)
+	if s.DryRun {
+		log.Info("not creating missing mailbox because of dryrun", logging.String("mailbox", name))
+		s.mailboxes[name] = name
+		return nil
 	}
 
+	actual, err = s.deps.MailRepo.CreateMailbox(ctx, name)
+	if err != nil {
+		return err
+	}
+	log.Info("created missing mailbox",
+		logging.String("mailbox", name),
+		logging.String("name", actual),
+	)
+	s.mailboxes[name] = actual
+
 	return nil
 }
 
-func (s *Sync) Run(ctx context.Context) (genErr error) {
+// mailbox returns the name in the server of a configured mailbox.
+func (s *Sync) mailbox(name string) string {
+	if actual, ok := s.mailboxes[name]; ok {
+		return actual
+	}
+
+	return name
+}
+
+// Run processes the new messages in the inbox, the returned report is
+// complete even when there is an error.
+func (s *Sync) Run(ctx context.Context) (runReport RunReport, genErr error) {
+	ctx, span := tracing.Start(ctx, "Sync.Run", attribute.Bool("dryrun", s.DryRun))
+
 	log := logging.New()
 	defer func() { _ = log.Sync() }()
-	defer func() { genErr = syncErr.Wrap(genErr) }()
+
+	version, _ := ctx.Value(types.VersionCtxKey{}).(string)
+	report := newRunReport(s.DryRun, version)
+	defer func() {
+		genErr = syncErr.Wrap(genErr)
+		tracing.End(span, genErr)
+		s.Plan.sort()
+
+		report.FinishedAt = time.Now()
+		metrics.LastRunTimestamp.Set(float64(report.FinishedAt.Unix()))
+		metrics.LastRunDuration.Set(report.FinishedAt.Sub(report.StartedAt).Seconds())
+		if genErr != nil {
+			report.addError("run", nil, genErr)
+		}
+		if s.deps != nil {
+			s.saveRunReport(ctx, report)
+		}
+
+		// the report is updated after the return values are set
+		runReport = *report
+	}()
 
 	if err := s.configure(ctx); err != nil {
-		return err
+		return *report, err
 	}
 
 	log.Debug("timelocale set", logging.String("timezone", s.Config.Timezone))
@@ -126,19 +227,19 @@ func (s *Sync) Run(ctx context.Context) (genErr error) {
 
 	// TODO: get available banks
 	banks := s.deps.BanksRepo.GetBanks(ctx)
-	_ = banks
+	importers := s.deps.BanksRepo.GetStatementImporters(ctx)
 
 	// TODO: get last successful transaction timestamp
 	lastProcessedDate, err := s.deps.DateRepo.GetLastProcessedDate(ctx)
 	if err != nil {
-		return err
+		return *report, err
 	}
 
 	log.Info("last processed date", logging.Time("last_processed_date", lastProcessedDate))
 
 	// TODO: get mailboxes
 	if err = s.mailSanityCheck(ctx); err != nil {
-		return err
+		return *report, err
 	}
 
 	mailCtx := ctx
@@ -161,48 +262,114 @@ func (s *Sync) Run(ctx context.Context) (genErr error) {
 		defer cancel()
 	}
 
+	fetchStage := report.startStage(StageFetch)
+	parseStage := report.startStage(StageParse)
+
 	// TODO: get all mail entries from mailbox, also beware of context cancelation
 	messages, err := s.deps.MailRepo.GetMessagesFromMailbox(
 		mailCtx,
 		"INBOX",
 		lastProcessedDate,
+		mailservtypes.ProcessedKeyword,
 	)
 	if err != nil {
-		return err
+		return *report, err
 	}
 
 	// TODO: when processing each mail, get each user config for handling notifications (use a cache aswell)
 	var (
-		fetchFailedMsgs int = 0
-		totalMsgs       int = 0
-		// successMsgs     int = 0
+		totalMsgs       int
 		parseFailedMsgs []banktypes.Message
+		ignoredMsgs     []banktypes.Message
+		// registeredMsgs are the statements whose rows were all registered
+		// by an earlier run
+		registeredMsgs []banktypes.Message
 
 		trxs []*banktypes.TrxInfo
 	)
 	for me := range messages {
+		totalMsgs++
+
 		if me.Err() != nil {
-			fetchFailedMsgs++
+			metrics.MessagesFetched.WithLabelValues("error").Inc()
+			fetchStage.Failed++
+			report.addError(StageFetch, nil, me.Err())
 			continue
 		}
+		metrics.MessagesFetched.WithLabelValues("ok").Inc()
+		fetchStage.Succeeded++
 
 		msg := me.Value()
 
-		for _, bank := range banks {
-			if bank.ComesFrom(msg.From()) && bank.FilterMessage(msg) {
-				trx, extractErr := bank.ExtractTransactionInfoFromMessage(msg)
-				if extractErr != nil {
-					parseFailedMsgs = append(parseFailedMsgs, msg)
-					break
-				}
+		stmtTrxs, importer, importErr := importStatements(importers, msg)
+		if importer != nil {
+			counts := report.bank(importer.String())
+			if importErr != nil {
+				log.Error("could not import statement",
+					logging.Uint("msg_id", msg.ID()),
+					logging.Error(importErr),
+				)
+				parseFailedMsgs = append(parseFailedMsgs, msg)
+				parseStage.Failed++
+				counts.ParseFailed++
+				report.addError(StageParse, msg, importErr).Bank = importer.String()
+				metrics.ParseFailures.WithLabelValues(importer.String(), "statement").Inc()
+				continue
+			}
 
-				trxs = append(trxs, trx)
+			pending, registered, dupErr := s.skipRegistered(ctx, msg, stmtTrxs)
+			if dupErr != nil {
+				// registering reports the errors of each row
+				log.Warn("could not look for statement rows that are already registered",
+					logging.Uint("msg_id", msg.ID()),
+					logging.Error(dupErr),
+				)
+				pending, registered = stmtTrxs, 0
 			}
+			if registered > 0 {
+				log.Info("skipping statement rows that are already registered",
+					logging.Uint("msg_id", msg.ID()),
+					logging.Int("registered", registered),
+				)
+				report.Duplicates += registered
+			}
+			if len(pending) == 0 {
+				registeredMsgs = append(registeredMsgs, msg)
+			}
+
+			trxs = append(trxs, pending...)
+			parseStage.Succeeded++
+			counts.Parsed += len(stmtTrxs)
+			continue
+		}
+
+		trx, bank, extractErr := parseMessage(ctx, banks, msg)
+		if bank == nil {
+			metrics.MessagesIgnored.Inc()
+			report.Ignored++
+			ignoredMsgs = append(ignoredMsgs, msg)
+			continue
 		}
+
+		counts := report.bank(bank.String())
+		if extractErr != nil {
+			parseFailedMsgs = append(parseFailedMsgs, msg)
+			parseStage.Failed++
+			counts.ParseFailed++
+			report.addError(StageParse, msg, extractErr).Bank = bank.String()
+			metrics.ParseFailures.WithLabelValues(bank.String(), regexpLabel(extractErr)).Inc()
+			continue
+		}
+
+		trxs = append(trxs, trx)
+		parseStage.Succeeded++
+		counts.Parsed++
 	}
+	fetchStage.finish()
+	parseStage.finish()
 
 	log.Debug("message fetching status",
-		logging.Int("failed", fetchFailedMsgs),
+		logging.Int("failed", fetchStage.Failed),
 		logging.Int("parse_failed", len(parseFailedMsgs)),
 		logging.Int("total", totalMsgs),
 	)
@@ -211,15 +378,12 @@ func (s *Sync) Run(ctx context.Context) (genErr error) {
 		logging.Int("len_trxs", len(trxs)),
 	)
 
-	// TODO: if there are parse errors, each should be archived into the "error parsing" mailbox
-	if moveErr := s.moveFailedToParseMessages(ctx, parseFailedMsgs); moveErr != nil {
-		return moveErr
-	}
+	registerStage := report.startStage(StageRegister)
 
 	// TODO: successful parses, are now being registered into the accounting software
 	processedTrxs, err := s.registerTrxsIntoAccounting(ctx, trxs)
 	if err != nil {
-		return err
+		return *report, err
 	}
 
 	// TODO: each sucessfull to register into accounting is to be archived into the 'processed' mailbox
@@ -227,99 +391,198 @@ func (s *Sync) Run(ctx context.Context) (genErr error) {
 		registries  []registerResponse
 		successMsgs []banktypes.Message
 		failedMsgs  []banktypes.Message
+		skippedMsgs []banktypes.Message
 	)
+	failedIDs := make(map[uint32]struct{})
+	keywords := make(map[uint32]string)
 	for t := range processedTrxs {
 		v := t.Value()
+		bank := v.Trx.Bank.String()
 		if t.Err() == nil {
 			registries = append(registries, v)
 			successMsgs = append(successMsgs, v.Trx.OriginMessage)
+			registerStage.Succeeded++
+			report.bank(bank).Registered++
+			report.user(v.Cfg.Email).Registered++
+		} else if ErrSkipped.Has(t.Err()) {
+			// skipped messages are left in the inbox for a later run
+			skippedMsgs = append(skippedMsgs, v.Trx.OriginMessage)
+			failedIDs[v.Trx.OriginMessage.ID()] = struct{}{}
+			report.Skipped++
 		} else {
 			failedMsgs = append(failedMsgs, v.Trx.OriginMessage)
+			failedIDs[v.Trx.OriginMessage.ID()] = struct{}{}
+			if _, ok := keywords[v.Trx.OriginMessage.ID()]; !ok {
+				keywords[v.Trx.OriginMessage.ID()] = failureKeyword(t.Err())
+			}
+			registerStage.Failed++
+			report.bank(bank).RegisterFailed++
+			if v.Cfg.Email != "" {
+				report.user(v.Cfg.Email).RegisterFailed++
+			}
+
+			e := report.addError(StageRegister, v.Trx.OriginMessage, t.Err())
+			e.Bank = bank
+			e.User = v.Cfg.Email
 		}
 	}
-	moveErr := s.moveSuccessfulMessages(ctx, successMsgs)
+	registerStage.finish()
+
+	moveStage := report.startStage(StageMove)
+
+	// statements yield many transactions from the same message, which is only
+	// successful when all of them were registered
+	successMsgs = uniqueMessages(append(successMsgs, registeredMsgs...), failedIDs)
+	disposed, moveErr := s.disposeMessages(ctx, map[string][]banktypes.Message{
+		OutcomeSuccess:         successMsgs,
+		OutcomeParseError:      parseFailedMsgs,
+		OutcomeAccountingError: uniqueMessages(failedMsgs, nil),
+		OutcomeIgnored:         ignoredMsgs,
+	}, keywords)
 	if moveErr != nil {
-		log.Error("could not move successful messages to success mailbox",
-			logging.Error(moveErr),
-		)
+		log.Error("could not apply message dispositions", logging.Error(moveErr))
+		moveStage.Failed += disposed
+		report.addError(StageMove, nil, moveErr)
+	} else {
+		moveStage.Succeeded += disposed
 	}
-	log.Info("moved successful messages",
-		logging.Int("msgs", len(successMsgs)),
-	)
+	moveStage.finish()
+
+	// the failed messages are fetched again unless they left the inbox, in
+	// which case they are requeued explicitly
+	pendingMsgs := failedMsgs
+	if moveErr == nil && s.disposition(OutcomeAccountingError).Move != "" {
+		pendingMsgs = nil
+	}
+	pendingMsgs = append(pendingMsgs, skippedMsgs...)
 
 	// TODO: save last execution date
-	if saveErr := s.saveLastExecutionDate(ctx, failedMsgs); saveErr != nil {
+	if saveErr := s.saveLastExecutionDate(ctx, pendingMsgs); saveErr != nil {
 		log.Error("could not save last execution date", logging.Error(saveErr))
+		report.addError("save_date", nil, saveErr)
 	}
 
+	notifyStage := report.startStage(StageNotify)
+
 	// TODO: notify each user with the processing report
-	if notifErr := s.notifyUsers(ctx, registries); notifErr != nil {
-		log.Error("could not notify users", logging.Error(notifErr))
+	for email, notifErr := range s.notifyUsers(ctx, registries) {
+		if notifErr != nil {
+			metrics.NotificationFailures.WithLabelValues("sms").Inc()
+			notifyStage.Failed++
+			report.addError(StageNotify, nil, notifErr).User = email
+			continue
+		}
+		notifyStage.Succeeded++
 	}
+	notifyStage.finish()
 
-	return nil
+	log.Info("run finished",
+		logging.Int("total_msgs", totalMsgs),
+		logging.Int("trxs", len(trxs)),
+		logging.Int("registered", registerStage.Succeeded),
+		logging.Int("errors", len(report.Errors)),
+	)
+
+	return *report, nil
 }
 
-func (s *Sync) moveFailedToParseMessages(ctx context.Context, msgs []banktypes.Message) error {
+func (s *Sync) saveRunReport(ctx context.Context, report *RunReport) {
 	log := logging.FromContext(ctx)
 
 	if s.DryRun {
-		log.Info("not moving failed parse messages",
-			logging.Int("len_msgs", len(msgs)),
-		)
-		return nil
+		log.Info("not saving run report because of dryrun")
+		return
 	}
 
-	if len(msgs) == 0 {
-		log.Debug("no failed parse messages to move")
-		return nil
-	}
-
-	ids := make([]uint32, 0, len(msgs))
-	for _, msg := range msgs {
-		ids = append(ids, msg.ID())
+	saved := report.truncated(maxSavedErrors, maxSavedErrorLength)
+	if err := s.deps.DateRepo.SaveRunReport(ctx, report.StartedAt, saved); err != nil {
+		log.Error("could not save run report", logging.Error(err))
 	}
+}
 
-	err := s.deps.MailRepo.MoveMessagesToMailbox(ctx, "INBOX", s.Config.ParseErrorMailbox, ids...)
-	if err != nil {
-		return errs.New(
-			"could not move mails that had parse errors to designated mailbox %q: %w",
-			s.Config.ParseErrorMailbox,
-			err,
-		)
+// regexpLabel identifies the regexp of the bank that a message matched before
+// failing to be parsed, "none" when it matched none.
+func regexpLabel(err error) string {
+	var regexpErr *banktypes.RegexpError
+	if errors.As(err, &regexpErr) {
+		return regexpErr.Regexp
 	}
 
-	return nil
+	return "none"
 }
 
-func (s *Sync) moveSuccessfulMessages(ctx context.Context, msgs []banktypes.Message) error {
-	log := logging.FromContext(ctx)
+// parseMessage returns the transaction in msg and the bank that handles it,
+// which is nil when no bank does.
+func parseMessage(
+	ctx context.Context,
+	banks []banktypes.BankDelegate,
+	msg banktypes.Message,
+) (*banktypes.TrxInfo, banktypes.BankDelegate, error) {
+	for _, bank := range banks {
+		if banktypes.ComesFrom(bank, msg) && bank.FilterMessage(msg) {
+			_, span := tracing.Start(ctx, "ExtractTransactionInfoFromMessage",
+				tracing.MessageID(msg.ID()),
+				tracing.Bank(bank.String()),
+			)
+			trx, err := bank.ExtractTransactionInfoFromMessage(msg)
+			if err != nil {
+				span.SetAttributes(attribute.String("regexp", regexpLabel(err)))
+			}
+			tracing.End(span, err)
 
-	if s.DryRun {
-		log.Info("not moving successful messages because of dryrun",
-			logging.Int("len_msgs", len(msgs)),
-		)
-		return nil
+			return trx, bank, err
+		}
 	}
 
-	if len(msgs) == 0 {
-		log.Debug("no successful messages to move")
-		return nil
+	return nil, nil, nil
+}
+
+// importStatements returns the transactions of the first attachment of msg
+// that a statement importer accepts, and that importer.
+func importStatements(
+	importers []banktypes.StatementImporter,
+	msg banktypes.Message,
+) ([]*banktypes.TrxInfo, banktypes.StatementImporter, error) {
+	withAttachments, ok := msg.(banktypes.MessageWithAttachments)
+	if !ok {
+		return nil, nil, nil
 	}
 
-	ids := make([]uint32, 0, len(msgs))
-	for _, msg := range msgs {
-		ids = append(ids, msg.ID())
+	for _, importer := range importers {
+		if !importer.ComesFrom(msg.From()) {
+			continue
+		}
+
+		for _, a := range withAttachments.Attachments() {
+			if importer.AcceptsAttachment(a) {
+				trxs, err := importer.ImportStatement(msg, a)
+				// a statement without rows would otherwise get no
+				// disposition, it is most likely not read as it should
+				if err == nil && len(trxs) == 0 {
+					err = errs.New("statement %s has no transactions", a.Filename)
+				}
+				return trxs, importer, err
+			}
+		}
 	}
 
-	err := s.deps.MailRepo.MoveMessagesToMailbox(ctx, "INBOX", s.Config.SuccessMailbox, ids...)
-	if err != nil {
-		return errs.New(
-			"could not move mails that had parse errors to designated mailbox %q: %w",
-			s.Config.ParseErrorMailbox,
-			err,
-		)
+	return nil, nil, nil
+}
+
+func uniqueMessages(msgs []banktypes.Message, exclude map[uint32]struct{}) []banktypes.Message {
+	seen := make(map[uint32]struct{}, len(msgs))
+	unique := make([]banktypes.Message, 0, len(msgs))
+	for _, m := range msgs {
+		id := m.ID()
+		if _, ok := exclude[id]; ok {
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, m)
 	}
 
-	return nil
+	return unique
 }
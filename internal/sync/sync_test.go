@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/emersion/go-imap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/sync/types"
+)
+
+func Test_MailSanityCheck(t *testing.T) {
+	mail := &fakeMail{mailboxes: []string{"INBOX", "Toshl/Processed"}}
+	s := newTestSync(types.Config{
+		SuccessMailbox:    "Toshl/Processed",
+		ParseErrorMailbox: "Toshl/Failed",
+		CreateMailboxes:   true,
+		Dispositions: types.Dispositions{
+			Ignored: &mailservtypes.Disposition{Move: "Toshl/Processed"},
+		},
+	}, &Dependencies{MailRepo: mail})
+
+	require.NoError(t, s.mailSanityCheck(context.Background()))
+
+	// every configured mailbox is resolved against a single listing
+	assert.Equal(t, 1, mail.lists)
+	assert.Equal(t, []string{"Toshl/Failed"}, mail.created)
+	assert.Equal(t, "Toshl/Processed", s.mailbox("Toshl/Processed"))
+	assert.Equal(t, "Toshl/Failed", s.mailbox("Toshl/Failed"))
+}
+
+func Test_MailSanityCheckErrors(t *testing.T) {
+	cfg := types.Config{SuccessMailbox: "Processed", ParseErrorMailbox: "Failed"}
+
+	s := newTestSync(cfg, &Dependencies{MailRepo: &fakeMail{mailboxes: []string{"Processed", "Failed"}}})
+	assert.ErrorContains(t, s.mailSanityCheck(context.Background()), "there is no inbox mailbox")
+
+	mail := &fakeMail{mailboxes: []string{"INBOX", "Processed"}}
+	s = newTestSync(cfg, &Dependencies{MailRepo: mail})
+	assert.ErrorContains(t, s.mailSanityCheck(context.Background()), "there is no mailbox Failed")
+	assert.Empty(t, mail.created)
+}
+
+type fakeImporter struct {
+	trxs []*banktypes.TrxInfo
+}
+
+func (f fakeImporter) ComesFrom([]string) bool { return true }
+
+func (f fakeImporter) AcceptsAttachment(a banktypes.Attachment) bool {
+	return a.Filename == "extracto.csv"
+}
+
+func (f fakeImporter) ImportStatement(banktypes.Message, banktypes.Attachment) ([]*banktypes.TrxInfo, error) {
+	return f.trxs, nil
+}
+
+func (f fakeImporter) String() string { return "Bancolombia" }
+
+func Test_ImportStatements(t *testing.T) {
+	msg := mailservtypes.Message{
+		Message: imap.Message{SeqNum: 1, Envelope: &imap.Envelope{}},
+		AttachmentsData: []banktypes.Attachment{
+			{Filename: "terms.pdf"},
+			{Filename: "extracto.csv"},
+		},
+	}
+
+	importer := fakeImporter{trxs: []*banktypes.TrxInfo{testTrx()}}
+	trxs, matched, err := importStatements([]banktypes.StatementImporter{importer}, msg)
+	require.NoError(t, err)
+	assert.Equal(t, importer, matched)
+	assert.Len(t, trxs, 1)
+
+	// a statement without rows is a parse error instead of being left alone
+	empty := fakeImporter{}
+	_, matched, err = importStatements([]banktypes.StatementImporter{empty}, msg)
+	assert.Equal(t, empty, matched)
+	assert.ErrorContains(t, err, "statement extracto.csv has no transactions")
+
+	// messages without an accepted attachment are not statements
+	msg.AttachmentsData = msg.AttachmentsData[:1]
+	_, matched, err = importStatements([]banktypes.StatementImporter{importer}, msg)
+	require.NoError(t, err)
+	assert.Nil(t, matched)
+}
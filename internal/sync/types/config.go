@@ -1,30 +1,83 @@
 package types
 
+import (
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/statement"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/metrics"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/secrets"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/mailserv/mailservtypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/tracing"
+)
+
 type Config struct {
 	Credentials
 	Timezone          string `json:"timezone"`
 	ParseErrorMailbox string `json:"parse_error_mailbox"`
 	SuccessMailbox    string `json:"success_mailbox"`
+	// AccountingErrorMailbox receives the messages that were parsed but could
+	// not be registered, they are left in the inbox when it is empty
+	AccountingErrorMailbox string `json:"accounting_error_mailbox"`
+	// CreateMailboxes creates the configured mailboxes that do not exist
+	// instead of failing the run
+	CreateMailboxes bool `json:"create_mailboxes"`
+	// Dispositions are what is done with the messages of each outcome
+	Dispositions Dispositions       `json:"dispositions"`
+	Statements   []statement.Config `json:"statements"`
+	Metrics      metrics.Config     `json:"metrics"`
+	Tracing      tracing.Config     `json:"tracing"`
+	AWS          AWS                `json:"aws"`
+	Secrets      secrets.Config     `json:"secrets"`
+}
+
+const DefaultRegion = "us-east-1"
+
+type AWS struct {
+	// Region of the DynamoDB tables and secrets, DefaultRegion by default
+	Region string `json:"region"`
+}
+
+func (c Config) Region() string {
+	if c.AWS.Region == "" {
+		return DefaultRegion
+	}
+
+	return c.AWS.Region
+}
+
+// Dispositions has the disposition of the messages for each outcome of the
+// sync. When unset, successful messages are moved to SuccessMailbox, messages
+// that could not be parsed to ParseErrorMailbox, the ones that could not be
+// registered to AccountingErrorMailbox, and the rest are left untouched.
+type Dispositions struct {
+	Success         *mailservtypes.Disposition `json:"success"`
+	ParseError      *mailservtypes.Disposition `json:"parse_error"`
+	AccountingError *mailservtypes.Disposition `json:"accounting_error"`
+	Ignored         *mailservtypes.Disposition `json:"ignored"`
 }
 
+// Credentials can be references to secrets, such as env:MAIL_PASSWORD, which
+// are resolved when the config is loaded.
 type Credentials struct {
 	Mail   Mail   `json:"mail"`
 	Twilio Twilio `json:"twilio"`
 	Toshl  Toshl  `json:"toshl"`
+	// UserEncryption is the master key of the tokens and phone numbers in the
+	// user configs
+	UserEncryption userconfigserv.EncryptionConfig `json:"user_encryption"`
 }
 
 type Mail struct {
 	Address  string `json:"addr"`
 	Username string `json:"username"`
-	Password string `json:"password"`
+	Password string `json:"password" secret:"true"`
 }
 
 type Twilio struct {
 	AccountSid string `json:"account-sid"`
-	AuthToken  string `json:"auth-token"`
+	AuthToken  string `json:"auth-token" secret:"true"`
 	FromNumber string `json:"from-number"`
 }
 
 type Toshl struct {
-	Token string `json:"token"`
+	Token string `json:"token" secret:"true"`
 }
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"github.com/zeebo/errs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/Philanthropists/toshl-email-autosync/v2"
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+type Config struct {
+	// Exporter is ExporterOTLP or ExporterStdout, tracing is disabled when it
+	// is empty
+	Exporter string `json:"exporter"`
+	// Endpoint is the host:port of the OTLP/HTTP collector, the
+	// OTEL_EXPORTER_OTLP_* environment variables are used when it is empty
+	Endpoint string `json:"endpoint"`
+	Insecure bool   `json:"insecure"`
+}
+
+// Setup installs the global tracer provider selected in cfg. The returned
+// function flushes the pending spans and should be called before exiting.
+func Setup(
+	ctx context.Context,
+	cfg Config,
+	service, version string,
+) (shutdown func(context.Context) error, _ error) {
+	var exporter sdktrace.SpanExporter
+
+	switch cfg.Exporter {
+	case "":
+		return func(context.Context) error { return nil }, nil
+
+	case ExporterStdout:
+		// stderr, since stdout has the output of the commands
+		e, err := stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		exporter = e
+
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if cfg.Endpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(cfg.Endpoint))
+		}
+		if cfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+
+		e, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			return nil, errs.Wrap(err)
+		}
+		exporter = e
+
+	default:
+		return nil, errs.New("unknown trace exporter %q", cfg.Exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(service),
+		semconv.ServiceVersion(version),
+	))
+	if err != nil {
+		return nil, errs.Wrap(err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return provider.Shutdown, nil
+}
+
+// Start starts a span, which is a no-op when tracing is not set up.
+func Start(
+	ctx context.Context,
+	name string,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, recording err when it is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func MessageID(id uint32) attribute.KeyValue {
+	return attribute.Int64("message.id", int64(id))
+}
+
+func Bank(name string) attribute.KeyValue {
+	return attribute.String("bank", name)
+}
@@ -0,0 +1,154 @@
+// Package utilparse parses the values that banks write in their messages.
+package utilparse
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zeebo/errs"
+)
+
+var (
+	ErrInvalidAmount   = errs.Class("invalid amount")
+	ErrAmbiguousAmount = errs.Class("ambiguous amount")
+)
+
+// AmountFormat are the separators that a source uses in its amounts. Amounts
+// may always be written without decimals or without thousands separators.
+type AmountFormat struct {
+	// Thousands separates the groups of three digits of the integer part, the
+	// integer part can not be grouped when it is 0
+	Thousands rune
+	// Decimal separates the decimal part, amounts have no decimals when it
+	// is 0
+	Decimal rune
+	// Decimals is the number of digits after Decimal, any number of them
+	// when it is 0
+	Decimals int
+}
+
+var (
+	// FormatCO is the format of Colombian pesos, 1.234.567,00
+	FormatCO = AmountFormat{Thousands: '.', Decimal: ',', Decimals: 2}
+	// FormatUS is the format of US dollars, 1,234,567.00
+	FormatUS = AmountFormat{Thousands: ',', Decimal: '.', Decimals: 2}
+)
+
+func (f AmountFormat) String() string {
+	s := "1234567"
+	if f.Thousands != 0 {
+		s = "1" + string(f.Thousands) + "234" + string(f.Thousands) + "567"
+	}
+	if f.Decimal != 0 {
+		if f.Decimals == 0 {
+			s += string(f.Decimal) + "0..."
+		} else {
+			s += string(f.Decimal) + strings.Repeat("0", f.Decimals)
+		}
+	}
+
+	return s
+}
+
+// ParseAmount parses s in the first of formats that it is valid in. It fails
+// when s is valid in several of them but means a different amount in each,
+// such as 1.234 when either dots or commas may be the decimal separator.
+func ParseAmount(s string, formats ...AmountFormat) (float64, error) {
+	s = strings.TrimSpace(s)
+	if len(formats) == 0 {
+		return 0, ErrInvalidAmount.New("there are no formats to parse %q in", s)
+	}
+
+	var (
+		value  float64
+		format AmountFormat
+		found  bool
+	)
+	for _, f := range formats {
+		v, ok := f.parse(s)
+		if !ok {
+			continue
+		}
+
+		if !found {
+			value, format, found = v, f, true
+			continue
+		}
+
+		if v != value {
+			return 0, ErrAmbiguousAmount.New(
+				"%q is %v written as %s and %v written as %s",
+				s, value, format, v, f,
+			)
+		}
+	}
+
+	if !found {
+		return 0, ErrInvalidAmount.New("%q is not written as %s", s, formatList(formats))
+	}
+
+	return value, nil
+}
+
+func formatList(formats []AmountFormat) string {
+	names := make([]string, 0, len(formats))
+	for _, f := range formats {
+		names = append(names, f.String())
+	}
+
+	return strings.Join(names, " or ")
+}
+
+func (f AmountFormat) parse(s string) (float64, bool) {
+	integer, decimal := s, ""
+	if f.Decimal != 0 {
+		if i := strings.IndexRune(s, f.Decimal); i >= 0 {
+			integer, decimal = s[:i], s[i+len(string(f.Decimal)):]
+
+			if !isDigits(decimal) {
+				return 0, false
+			}
+			if f.Decimals != 0 && len(decimal) != f.Decimals {
+				return 0, false
+			}
+		}
+	}
+
+	if f.Thousands != 0 && strings.ContainsRune(integer, f.Thousands) {
+		groups := strings.Split(integer, string(f.Thousands))
+		if groups[0] == "" || len(groups[0]) > 3 || groups[0][0] == '0' {
+			return 0, false
+		}
+		for _, g := range groups[1:] {
+			if len(g) != 3 {
+				return 0, false
+			}
+		}
+		integer = strings.Join(groups, "")
+	}
+
+	if !isDigits(integer) {
+		return 0, false
+	}
+
+	if decimal != "" {
+		integer += "." + decimal
+	}
+
+	value, err := strconv.ParseFloat(integer, 64)
+	return value, err == nil
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,153 @@
+package utilparse
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var anyDecimals = []AmountFormat{
+	{Thousands: '.', Decimal: ','},
+	{Thousands: ',', Decimal: '.'},
+}
+
+func Test_ParseAmount(t *testing.T) {
+	tests := []struct {
+		In      string
+		Formats []AmountFormat
+		Out     float64
+		Err     bool
+	}{
+		{In: "30,000.00", Formats: []AmountFormat{FormatCO, FormatUS}, Out: 30000},
+		{In: "30.000,00", Formats: []AmountFormat{FormatCO, FormatUS}, Out: 30000},
+		{In: "30.000", Formats: []AmountFormat{FormatCO, FormatUS}, Out: 30000},
+		{In: "78,000", Formats: []AmountFormat{FormatCO, FormatUS}, Out: 78000},
+		{In: "8.300.000,00", Formats: []AmountFormat{FormatCO, FormatUS}, Out: 8300000},
+		{In: " 1.234,5 ", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: "1.234,56", Formats: []AmountFormat{FormatCO}, Out: 1234.56},
+		{In: "1234", Formats: []AmountFormat{FormatCO}, Out: 1234},
+		{In: "0,50", Formats: []AmountFormat{FormatCO}, Out: 0.5},
+		{In: "1.234", Formats: []AmountFormat{FormatUS}, Err: true},
+		{In: "1.234", Formats: anyDecimals, Err: true},
+		{In: "1.23", Formats: anyDecimals, Out: 1.23},
+		{In: "1.234.567", Formats: anyDecimals, Out: 1234567},
+		{In: "1.2345", Formats: []AmountFormat{{Decimal: '.'}}, Out: 1.2345},
+		{In: "1,234", Formats: []AmountFormat{{Decimal: '.'}}, Err: true},
+		{In: "12.34.567", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: "1234.567", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: ".234", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: "0.234", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: "1.234,", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: "1,2,3", Formats: []AmountFormat{FormatCO, FormatUS}, Err: true},
+		{In: "-1.234", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: "", Formats: []AmountFormat{FormatCO}, Err: true},
+		{In: "1234", Err: true},
+	}
+
+	for _, tt := range tests {
+		value, err := ParseAmount(tt.In, tt.Formats...)
+		if tt.Err {
+			assert.Error(t, err, tt.In)
+			continue
+		}
+
+		assert.NoError(t, err, tt.In)
+		assert.Equal(t, tt.Out, value, tt.In)
+	}
+}
+
+func Test_ParseAmount_Errors(t *testing.T) {
+	_, err := ParseAmount("1.234", anyDecimals...)
+	assert.True(t, ErrAmbiguousAmount.Has(err))
+	assert.ErrorContains(t, err, `"1.234" is 1234 written as 1.234.567,0... and 1.234 written as 1,234,567.0...`)
+
+	_, err = ParseAmount("1.2.3", FormatCO, FormatUS)
+	assert.True(t, ErrInvalidAmount.Has(err))
+	assert.ErrorContains(t, err, `"1.2.3" is not written as 1.234.567,00 or 1,234,567.00`)
+}
+
+// formatAmount writes cents in f, grouping the thousands when group is set.
+func formatAmount(f AmountFormat, cents uint32, group bool) string {
+	integer := strconv.FormatUint(uint64(cents/100), 10)
+	if group && f.Thousands != 0 {
+		var groups []string
+		for len(integer) > 3 {
+			groups = append([]string{integer[len(integer)-3:]}, groups...)
+			integer = integer[:len(integer)-3]
+		}
+		integer = strings.Join(append([]string{integer}, groups...), string(f.Thousands))
+	}
+
+	if f.Decimal == 0 {
+		return integer
+	}
+	return integer + string(f.Decimal) + strconv.FormatUint(uint64(cents%100+100), 10)[1:]
+}
+
+func FuzzParseAmount_RoundTrip(f *testing.F) {
+	f.Add(uint32(0), true)
+	f.Add(uint32(123456789), true)
+	f.Add(uint32(3000000), false)
+
+	f.Fuzz(func(t *testing.T, cents uint32, group bool) {
+		for _, format := range []AmountFormat{FormatCO, FormatUS} {
+			s := formatAmount(format, cents, group)
+
+			value, err := ParseAmount(s, format)
+			if err != nil {
+				t.Fatalf("%q: %v", s, err)
+			}
+			if math.Round(value*100) != float64(cents) {
+				t.Fatalf("%q is %v, it should be %d cents", s, value, cents)
+			}
+
+			// the decimals of both formats are explicit, so there is only one
+			// way to read an amount written in either
+			both, err := ParseAmount(s, FormatCO, FormatUS)
+			if err != nil {
+				t.Fatalf("%q in both formats: %v", s, err)
+			}
+			if both != value {
+				t.Fatalf("%q is %v in both formats, it should be %v", s, both, value)
+			}
+		}
+	})
+}
+
+func FuzzParseAmount(f *testing.F) {
+	for _, s := range []string{"30,000.00", "30.000,00", "30.000", "1.234", "1,2,3", "0,50", ".5"} {
+		f.Add(s)
+	}
+
+	f.Fuzz(func(t *testing.T, s string) {
+		formats := append([]AmountFormat{FormatCO, FormatUS}, anyDecimals...)
+
+		value, err := ParseAmount(s, formats...)
+		if err != nil {
+			if !ErrInvalidAmount.Has(err) && !ErrAmbiguousAmount.Has(err) {
+				t.Fatalf("%q: unexpected error %v", s, err)
+			}
+			return
+		}
+
+		if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+			t.Fatalf("%q is %v", s, value)
+		}
+
+		// every format that s is valid in reads the same amount
+		for _, f := range formats {
+			if v, err := ParseAmount(s, f); err == nil && v != value {
+				t.Fatalf("%q is %v written as %s, but was parsed as %v", s, v, f, value)
+			}
+		}
+
+		for _, c := range strings.TrimSpace(s) {
+			if (c < '0' || c > '9') && c != '.' && c != ',' {
+				t.Fatalf("%q has %q, but was parsed as %v", s, c, value)
+			}
+		}
+	})
+}
@@ -0,0 +1,353 @@
+package utilparse
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/util/utiltext"
+)
+
+var ErrInvalidDate = errs.Class("invalid date")
+
+// clockSkew is how far after the reference a time without a date may be, so
+// that a transaction at 23:59 that is sent at 00:01 is not taken as today's
+var clockSkew = time.Hour
+
+var months = map[string]time.Month{
+	"ene": time.January, "enero": time.January,
+	"feb": time.February, "febrero": time.February,
+	"mar": time.March, "marzo": time.March,
+	"abr": time.April, "abril": time.April,
+	"may": time.May, "mayo": time.May,
+	"jun": time.June, "junio": time.June,
+	"jul": time.July, "julio": time.July,
+	"ago": time.August, "agosto": time.August,
+	"sep": time.September, "sept": time.September, "set": time.September,
+	"septiembre": time.September, "setiembre": time.September,
+	"oct": time.October, "octubre": time.October,
+	"nov": time.November, "noviembre": time.November,
+	"dic": time.December, "diciembre": time.December,
+}
+
+var relativeDays = map[string]int{
+	"hoy":      0,
+	"ayer":     1,
+	"anteayer": 2,
+	"antier":   2,
+}
+
+var units = map[string]time.Duration{
+	"segundo": time.Second, "segundos": time.Second, "seg": time.Second,
+	"minuto": time.Minute, "minutos": time.Minute, "min": time.Minute,
+	"hora": time.Hour, "horas": time.Hour, "h": time.Hour,
+	"dia": 24 * time.Hour, "dias": 24 * time.Hour,
+	"semana": 7 * 24 * time.Hour, "semanas": 7 * 24 * time.Hour,
+}
+
+// fillers are the words around the dates of the alerts, such as in
+// "el 12/03/2024 a las 21:14"
+var fillers = map[string]bool{
+	"el": true, "de": true, "del": true, "a": true, "la": true, "las": true, "en": true, "hora": true,
+	"lunes": true, "martes": true, "miercoles": true, "jueves": true,
+	"viernes": true, "sabado": true, "domingo": true,
+}
+
+var (
+	numericDateRegexp = regexp.MustCompile(`^(\d{1,4})[/-](\d{1,2})(?:[/-](\d{2,4}))?$`)
+	clockRegexp       = regexp.MustCompile(`^(\d{1,2}):(\d{2})(?::(\d{2}))?(am|pm)?$`)
+	numberRegexp      = regexp.MustCompile(`^\d+$`)
+)
+
+var dateReplacer = strings.NewReplacer(
+	"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u",
+	"a. m.", "am", "p. m.", "pm", "a.m.", "am", "p.m.", "pm",
+	",", " ",
+)
+
+type dateParts struct {
+	hasDate, hasYear bool
+	monthName        bool
+	year, day        int
+	month            time.Month
+	// numbers are the day and year of a date with a month name
+	numbers []string
+
+	relativeDay bool
+	daysAgo     int
+
+	hasClock       bool
+	hour, min, sec int
+	meridiem       string
+
+	hasAgo bool
+	ago    time.Duration
+}
+
+// ParseDate parses a date written in Spanish, such as "15/03/2024 14:32",
+// "el 12/03/2024 a las 21:14", "15 de marzo", "mar 15 2:32 pm", "ayer a las
+// 21:14" or "hace 5 minutos". The dates without a year, the days without a
+// date and the relative times are taken from ref, the latest time that s can
+// be. The times are in loc, or in the location of ref when it is nil.
+func ParseDate(s string, ref time.Time, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = ref.Location()
+	}
+	ref = ref.In(loc)
+
+	p, err := splitDate(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if p.hasAgo {
+		if p.hasDate || p.hasClock || p.relativeDay {
+			return time.Time{}, ErrInvalidDate.New("%q has both a relative time and a date", s)
+		}
+		return ref.Add(-p.ago), nil
+	}
+	if !p.hasDate && !p.hasClock && !p.relativeDay {
+		return time.Time{}, ErrInvalidDate.New("%q has no date", s)
+	}
+
+	hour, err := p.hour24()
+	if err != nil {
+		return time.Time{}, ErrInvalidDate.New("%q: %w", s, err)
+	}
+	if p.min > 59 || p.sec > 59 {
+		return time.Time{}, ErrInvalidDate.New("%q has an invalid time", s)
+	}
+
+	year, month, day := ref.Date()
+	switch {
+	case p.hasDate:
+		month, day = p.month, p.day
+		if p.hasYear {
+			year = p.year
+		}
+	case p.relativeDay:
+		year, month, day = ref.AddDate(0, 0, -p.daysAgo).Date()
+	}
+
+	t := time.Date(year, month, day, hour, p.min, p.sec, 0, loc)
+	if t.Day() != day || t.Month() != month {
+		return time.Time{}, ErrInvalidDate.New("%q is not a valid date", s)
+	}
+
+	switch {
+	case p.hasDate && !p.hasYear && t.Sub(ref) > 24*time.Hour:
+		t = time.Date(year-1, month, day, hour, p.min, p.sec, 0, loc)
+		if t.Day() != day {
+			return time.Time{}, ErrInvalidDate.New("%q is not a valid date", s)
+		}
+	case !p.hasDate && !p.relativeDay && t.Sub(ref) > clockSkew:
+		t = t.AddDate(0, 0, -1)
+	}
+
+	return t, nil
+}
+
+// AttachLocation returns the time with the same wall clock as t in loc, for
+// the times that were parsed without a zone.
+func AttachLocation(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+func dateTokens(s string) []string {
+	s = dateReplacer.Replace(strings.ToLower(utiltext.Normalize(s)))
+
+	var tokens []string
+	for _, tok := range strings.Fields(s) {
+		if tok = strings.TrimRight(tok, "."); tok != "" {
+			tokens = append(tokens, tok)
+		}
+	}
+
+	return tokens
+}
+
+func splitDate(s string) (dateParts, error) {
+	var p dateParts
+
+	tokens := dateTokens(s)
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+
+		if tok == "hace" {
+			if i+2 >= len(tokens) {
+				return p, ErrInvalidDate.New("%q has an incomplete relative time", s)
+			}
+
+			n, err := strconv.Atoi(tokens[i+1])
+			unit, ok := units[tokens[i+2]]
+			if err != nil || !ok {
+				return p, ErrInvalidDate.New("%q has an invalid relative time", s)
+			}
+
+			p.hasAgo = true
+			p.ago += time.Duration(n) * unit
+			i += 2
+			continue
+		}
+
+		if fillers[tok] {
+			continue
+		}
+
+		if n, ok := relativeDays[tok]; ok {
+			if p.relativeDay {
+				return p, ErrInvalidDate.New("%q has more than one date", s)
+			}
+			p.relativeDay, p.daysAgo = true, n
+			continue
+		}
+
+		if tok == "am" || tok == "pm" {
+			if !p.hasClock || p.meridiem != "" {
+				return p, ErrInvalidDate.New("%q has %s without a time", s, tok)
+			}
+			p.meridiem = tok
+			continue
+		}
+
+		if m, ok := months[tok]; ok {
+			if p.hasDate {
+				return p, ErrInvalidDate.New("%q has more than one date", s)
+			}
+			p.hasDate, p.monthName, p.month = true, true, m
+			continue
+		}
+
+		if match := clockRegexp.FindStringSubmatch(tok); match != nil {
+			if p.hasClock {
+				return p, ErrInvalidDate.New("%q has more than one time", s)
+			}
+			p.hasClock = true
+			p.hour, _ = strconv.Atoi(match[1])
+			p.min, _ = strconv.Atoi(match[2])
+			if match[3] != "" {
+				p.sec, _ = strconv.Atoi(match[3])
+			}
+			p.meridiem = match[4]
+			continue
+		}
+
+		if match := numericDateRegexp.FindStringSubmatch(tok); match != nil {
+			if p.hasDate {
+				return p, ErrInvalidDate.New("%q has more than one date", s)
+			}
+			if err := p.setNumericDate(match[1], match[2], match[3]); err != nil {
+				return p, ErrInvalidDate.New("%q: %w", s, err)
+			}
+			continue
+		}
+
+		if numberRegexp.MatchString(tok) {
+			p.numbers = append(p.numbers, tok)
+			continue
+		}
+
+		return p, ErrInvalidDate.New("%q has an unknown word %q", s, tok)
+	}
+
+	if len(p.numbers) > 0 {
+		if !p.monthName {
+			return p, ErrInvalidDate.New("%q has numbers that are not a date", s)
+		}
+		if err := p.setMonthNumbers(); err != nil {
+			return p, ErrInvalidDate.New("%q: %w", s, err)
+		}
+	} else if p.monthName {
+		return p, ErrInvalidDate.New("%q has a month without a day", s)
+	}
+
+	if p.hasDate && p.relativeDay {
+		return p, ErrInvalidDate.New("%q has more than one date", s)
+	}
+
+	return p, nil
+}
+
+// setNumericDate sets a day first date, or a year first one when first has
+// four digits.
+func (p *dateParts) setNumericDate(first, second, third string) error {
+	day, month, year := first, second, third
+	if len(first) == 4 {
+		if len(third) != 1 && len(third) != 2 {
+			return errs.New("year first dates should have a day")
+		}
+		year, day = first, third
+	} else if len(first) > 2 {
+		return errs.New("%s is not a day", first)
+	}
+
+	p.hasDate = true
+	p.day, _ = strconv.Atoi(day)
+	m, _ := strconv.Atoi(month)
+	p.month = time.Month(m)
+	if year != "" {
+		p.hasYear = true
+		p.year = parseYear(year)
+	}
+
+	if p.month < time.January || p.month > time.December {
+		return errs.New("%s is not a month", month)
+	}
+
+	return nil
+}
+
+// setMonthNumbers takes the day and year of a date with a month name from the
+// numbers around it.
+func (p *dateParts) setMonthNumbers() error {
+	for _, n := range p.numbers {
+		switch {
+		case len(n) <= 2 && p.day == 0:
+			p.day, _ = strconv.Atoi(n)
+		case len(n) == 4 && !p.hasYear:
+			p.hasYear = true
+			p.year = parseYear(n)
+		default:
+			return errs.New("%s is not the day or the year", n)
+		}
+	}
+
+	if p.day == 0 {
+		return errs.New("%s has no day", p.month)
+	}
+
+	return nil
+}
+
+func parseYear(s string) int {
+	year, _ := strconv.Atoi(s)
+	if len(s) == 2 {
+		year += 2000
+	}
+
+	return year
+}
+
+func (p dateParts) hour24() (int, error) {
+	switch p.meridiem {
+	case "":
+		if p.hour > 23 {
+			return 0, errs.New("%d is not an hour", p.hour)
+		}
+		return p.hour, nil
+
+	default:
+		if p.hour < 1 || p.hour > 12 {
+			return 0, errs.New("%d %s is not an hour", p.hour, p.meridiem)
+		}
+
+		hour := p.hour % 12
+		if p.meridiem == "pm" {
+			hour += 12
+		}
+		return hour, nil
+	}
+}
@@ -0,0 +1,80 @@
+package utilparse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ParseDate(t *testing.T) {
+	bogota := time.FixedZone("COT", -5*60*60)
+	ref := time.Date(2024, time.March, 15, 14, 40, 0, 0, bogota)
+
+	tests := []struct {
+		In  string
+		Ref time.Time
+		Out time.Time
+		Err bool
+	}{
+		{In: "15/03/2024 14:32", Out: time.Date(2024, time.March, 15, 14, 32, 0, 0, bogota)},
+		{In: "el 12/03/2024 a las 21:14", Out: time.Date(2024, time.March, 12, 21, 14, 0, 0, bogota)},
+		{In: "Hora 16:44 01/09/2022", Out: time.Date(2022, time.September, 1, 16, 44, 0, 0, bogota)},
+		{In: "19:02. 20/09/2022", Out: time.Date(2022, time.September, 20, 19, 2, 0, 0, bogota)},
+		{In: "2024-03-15 08:05:09", Out: time.Date(2024, time.March, 15, 8, 5, 9, 0, bogota)},
+		{In: "01/02/24", Out: time.Date(2024, time.February, 1, 0, 0, 0, 0, bogota)},
+		{In: "mar 15", Out: time.Date(2024, time.March, 15, 0, 0, 0, 0, bogota)},
+		{In: "15 de marzo de 2023", Out: time.Date(2023, time.March, 15, 0, 0, 0, 0, bogota)},
+		{In: "Viernes, 15 Mar. 2:32 p. m.", Out: time.Date(2024, time.March, 15, 14, 32, 0, 0, bogota)},
+		{In: "12 am 1 ene", Err: true},
+		{In: "1 ene 12:05am", Out: time.Date(2024, time.January, 1, 0, 5, 0, 0, bogota)},
+		{In: "20 dic", Out: time.Date(2023, time.December, 20, 0, 0, 0, 0, bogota)},
+		{In: "16 mar", Out: time.Date(2024, time.March, 16, 0, 0, 0, 0, bogota)},
+		{In: "ayer a las 21:14", Out: time.Date(2024, time.March, 14, 21, 14, 0, 0, bogota)},
+		{In: "hoy", Out: time.Date(2024, time.March, 15, 0, 0, 0, 0, bogota)},
+		{In: "14:32", Out: time.Date(2024, time.March, 15, 14, 32, 0, 0, bogota)},
+		{In: "23:59", Out: time.Date(2024, time.March, 14, 23, 59, 0, 0, bogota)},
+		{In: "hace 5 minutos", Out: ref.Add(-5 * time.Minute)},
+		{In: "hace 2 días", Out: ref.Add(-48 * time.Hour)},
+		{In: "15/03/2024 14:32", Ref: ref.UTC(), Out: time.Date(2024, time.March, 15, 14, 32, 0, 0, bogota)},
+		{In: "hace 5 minutos 14:32", Err: true},
+		{In: "hace minutos", Err: true},
+		{In: "31/02/2024", Err: true},
+		{In: "15/13/2024", Err: true},
+		{In: "25:00", Err: true},
+		{In: "13:00 pm", Err: true},
+		{In: "15/03/2024 16/03/2024", Err: true},
+		{In: "ayer 15/03/2024", Err: true},
+		{In: "marzo", Err: true},
+		{In: "15 2024", Err: true},
+		{In: "15/03/2024 T.Cred", Err: true},
+		{In: "", Err: true},
+	}
+
+	for _, tt := range tests {
+		r := ref
+		if !tt.Ref.IsZero() {
+			r = tt.Ref
+		}
+
+		date, err := ParseDate(tt.In, r, bogota)
+		if tt.Err {
+			assert.Error(t, err, tt.In)
+			continue
+		}
+
+		assert.NoError(t, err, tt.In)
+		assert.Equal(t, tt.Out, date, tt.In)
+	}
+}
+
+func Test_AttachLocation(t *testing.T) {
+	bogota := time.FixedZone("COT", -5*60*60)
+
+	parsed, err := time.Parse("02/01/2006 15:04", "15/03/2024 14:32")
+	assert.NoError(t, err)
+
+	date := AttachLocation(parsed, bogota)
+	assert.Equal(t, time.Date(2024, time.March, 15, 14, 32, 0, 0, bogota), date)
+	assert.Equal(t, time.Date(2024, time.March, 15, 19, 32, 0, 0, time.UTC), date.UTC())
+}
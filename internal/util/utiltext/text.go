@@ -0,0 +1,109 @@
+package utiltext
+
+import (
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/zeebo/errs"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize returns s in NFC form with non-breaking and zero-width spaces
+// replaced and every run of whitespace collapsed into a single space.
+func Normalize(s string) string {
+	s = norm.NFC.String(s)
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	space := false
+	for _, r := range s {
+		switch r {
+		case '\u200b', '\u200c', '\u200d', '\ufeff':
+			// zero-width characters are dropped altogether
+			continue
+		}
+
+		// unicode.IsSpace includes the no-break spaces, U+00A0, U+2007 and
+		// U+202F
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// HTMLToText extracts the text of an HTML document, decoding its entities and
+// ignoring scripts, styles and comments. Block elements are separated by
+// newlines, the result is not normalized.
+func HTMLToText(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+
+	var (
+		b    strings.Builder
+		skip int
+	)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return "", errs.Wrap(err)
+			}
+			return b.String(), nil
+
+		case html.TextToken:
+			if skip == 0 {
+				b.Write(z.Text())
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if a == atom.Script || a == atom.Style || a == atom.Head {
+				// self-closing tags have no end tag to stop skipping at, and
+				// nothing after them is their raw text
+				if tt == html.SelfClosingTagToken {
+					z.NextIsNotRawText()
+				} else {
+					skip++
+				}
+			}
+			if isBlock(a) {
+				b.WriteByte('\n')
+			}
+
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			if (a == atom.Script || a == atom.Style || a == atom.Head) && skip > 0 {
+				skip--
+			}
+			if isBlock(a) {
+				b.WriteByte('\n')
+			}
+		}
+	}
+}
+
+func isBlock(a atom.Atom) bool {
+	switch a {
+	case atom.Br, atom.P, atom.Div, atom.Tr, atom.Td, atom.Th, atom.Li,
+		atom.Table, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		return true
+	}
+
+	return false
+}
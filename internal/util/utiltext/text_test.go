@@ -0,0 +1,47 @@
+package utiltext
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Normalize(t *testing.T) {
+	tests := []struct {
+		In  string
+		Out string
+	}{
+		{In: "  Bancolombia le\ninforma   compra ", Out: "Bancolombia le informa compra"},
+		{In: "por\u00a0$30,000.00\u202fa Prueba", Out: "por $30,000.00 a Prueba"},
+		{In: "cafe\u0301\u200b", Out: "caf\u00e9"},
+		{In: "$\u00a030.000", Out: "$ 30.000"},
+		{In: "30\u2007000\u202fCOP", Out: "30 000 COP"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.Out, Normalize(tt.In))
+	}
+}
+
+func Test_HTMLToText(t *testing.T) {
+	doc := `<html><head><style>p { color: red; }</style></head>
+<body><p>Bancolombia le informa compra por $30,000.00 a ALMACEN&nbsp;&Eacute;XITO</p>
+<script>var x = 1;</script><div>desde cta *0000.</div></body></html>`
+
+	text, err := HTMLToText(strings.NewReader(doc))
+	assert.NoError(t, err)
+	assert.Equal(t,
+		"Bancolombia le informa compra por $30,000.00 a ALMACEN ÉXITO desde cta *0000.",
+		Normalize(text),
+	)
+}
+
+func Test_HTMLToTextSelfClosing(t *testing.T) {
+	doc := `<html><head/><body><script src="track.js"/><style/>
+<p>Bancolombia le informa compra por $30,000.00<br/>en EXITO</p></body></html>`
+
+	text, err := HTMLToText(strings.NewReader(doc))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bancolombia le informa compra por $30,000.00 en EXITO", Normalize(text))
+}
@@ -0,0 +1,343 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	syncpkg "github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
+)
+
+const (
+	apiKeyHeader         = "X-API-Key"
+	idempotencyKeyHeader = "Idempotency-Key"
+	replayedHeader       = "Idempotent-Replayed"
+
+	defaultIdempotencyTTL = 24 * time.Hour
+	maxBodySize           = 64 << 10
+)
+
+type ingester interface {
+	Ingest(context.Context, ...banktypes.Message) ([]syncpkg.IngestResult, error)
+	GetUserConfigFromAPIKey(context.Context, string) (userconfigserv.UserConfig, error)
+}
+
+type inMemoryCache interface {
+	Add(k string, v any, t time.Duration) error
+	Set(k string, v any, t time.Duration)
+	Get(k string) (any, bool)
+	Delete(k string)
+}
+
+type signatureValidator interface {
+	ValidateSignature(url string, params map[string]string, signature string) bool
+}
+
+type Server struct {
+	Ingester       ingester
+	IdempotencyTTL time.Duration
+
+	// TwilioValidator checks the signature of inbound Twilio messages, inbound
+	// messages are refused when it is nil unless AllowUnsignedSMS is set.
+	TwilioValidator  signatureValidator
+	AllowUnsignedSMS bool
+	// PublicURL is the scheme and host Twilio uses to reach the server, it is
+	// needed to validate signatures behind a proxy.
+	PublicURL string
+
+	once  sync.Once
+	cache inMemoryCache
+}
+
+type AlertRequest struct {
+	From           string    `json:"from"`
+	Subject        string    `json:"subject"`
+	Text           string    `json:"text"`
+	Date           time.Time `json:"date"`
+	IdempotencyKey string    `json:"idempotency_key"`
+}
+
+type AlertResponse struct {
+	Status      string  `json:"status"`
+	Bank        string  `json:"bank,omitempty"`
+	Account     string  `json:"account,omitempty"`
+	Type        string  `json:"type,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Amount      float64 `json:"amount,omitempty"`
+	Currency    string  `json:"currency,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+const (
+	statusRegistered = "registered"
+	statusFailed     = "failed"
+	statusPending    = "pending"
+)
+
+type storedResponse struct {
+	Code int
+	Body AlertResponse
+}
+
+func (s *Server) init() {
+	s.once.Do(func() {
+		ttl := defaultIdempotencyTTL
+		if s.IdempotencyTTL != 0 {
+			ttl = s.IdempotencyTTL
+		}
+
+		s.cache = cache.New(ttl, time.Hour)
+	})
+}
+
+func (s *Server) Handler() http.Handler {
+	s.init()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/alerts", s.handleAlert)
+	mux.HandleFunc("/sms/twilio", s.handleTwilioSMS)
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return mux
+}
+
+func (s *Server) handleAlert(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeJSON(w, http.StatusMethodNotAllowed, AlertResponse{
+			Status: statusFailed,
+			Error:  "method not allowed",
+		})
+		return
+	}
+
+	cfg, err := s.Ingester.GetUserConfigFromAPIKey(ctx, apiKeyFromRequest(r))
+	if userconfigserv.ErrNotFound.Has(err) {
+		writeJSON(w, http.StatusUnauthorized, AlertResponse{
+			Status: statusFailed,
+			Error:  "invalid api key",
+		})
+		return
+	} else if err != nil {
+		logging.FromContext(ctx).Error("could not read user configs", logging.Error(err))
+		writeJSON(w, http.StatusServiceUnavailable, AlertResponse{
+			Status: statusFailed,
+			Error:  "could not check api key",
+		})
+		return
+	}
+
+	req, err := decodeAlertRequest(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, AlertResponse{
+			Status: statusFailed,
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	if key := r.Header.Get(idempotencyKeyHeader); key != "" {
+		req.IdempotencyKey = key
+	}
+
+	if err := req.validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, AlertResponse{
+			Status: statusFailed,
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	msg := banktypes.TextMessage{
+		Key:       req.IdempotencyKey,
+		Sender:    req.From,
+		Recipient: cfg.Email,
+		Title:     req.Subject,
+		Sent:      req.Date,
+		Text:      req.Text,
+	}
+
+	code, resp, replayed := s.ingestOnce(ctx, cfg, req.IdempotencyKey, msg)
+	if replayed {
+		w.Header().Set(replayedHeader, "true")
+	}
+
+	writeJSON(w, code, resp)
+}
+
+// ingestOnce ingests msg unless a message with the same idempotency key was
+// already ingested for the user, in which case the stored response is returned.
+func (s *Server) ingestOnce(
+	ctx context.Context,
+	cfg userconfigserv.UserConfig,
+	idempotencyKey string,
+	msg banktypes.Message,
+) (_ int, _ AlertResponse, replayed bool) {
+	log := logging.FromContext(ctx).With(
+		logging.String("email", cfg.Email),
+		logging.String("idempotency_key", idempotencyKey),
+	)
+
+	// keys are scoped per user, so that one user cannot replay another's responses
+	cacheKey := cfg.Email + "/" + idempotencyKey
+	pending := storedResponse{
+		Code: http.StatusConflict,
+		Body: AlertResponse{
+			Status: statusPending,
+			Error:  "a request with this idempotency key is still being processed",
+		},
+	}
+	if err := s.cache.Add(cacheKey, pending, cache.DefaultExpiration); err != nil {
+		v, _ := s.cache.Get(cacheKey)
+		if stored, ok := v.(storedResponse); ok {
+			log.Info("replaying response for already seen idempotency key")
+			return stored.Code, stored.Body, true
+		}
+	}
+
+	code, resp := s.ingest(log.GetContext(ctx), msg)
+	if code >= http.StatusInternalServerError {
+		// let the client retry with the same key
+		s.cache.Delete(cacheKey)
+	} else {
+		s.cache.Set(cacheKey, storedResponse{Code: code, Body: resp}, cache.DefaultExpiration)
+	}
+
+	return code, resp, false
+}
+
+func (s *Server) ingest(ctx context.Context, msg banktypes.Message) (int, AlertResponse) {
+	log := logging.FromContext(ctx)
+
+	results, err := s.Ingester.Ingest(ctx, msg)
+	if err != nil {
+		log.Error("could not ingest alert", logging.Error(err))
+		return http.StatusInternalServerError, AlertResponse{
+			Status: statusFailed,
+			Error:  "could not ingest alert",
+		}
+	}
+
+	if len(results) == 0 {
+		return http.StatusServiceUnavailable, AlertResponse{
+			Status: statusFailed,
+			Error:  "alert was not processed",
+		}
+	}
+
+	res := results[0]
+	if res.Trx == nil {
+		log.Info("alert could not be parsed", logging.Error(res.Err))
+		return http.StatusUnprocessableEntity, AlertResponse{
+			Status: statusFailed,
+			Error:  res.Err.Error(),
+		}
+	}
+
+	resp := AlertResponse{
+		Status:      statusRegistered,
+		Bank:        res.Trx.Bank.String(),
+		Account:     res.Trx.Account,
+		Type:        res.Trx.Type.String(),
+		Description: res.Trx.Description,
+		Amount:      res.Trx.Value.Number,
+		Currency:    res.Trx.Value.Code,
+	}
+
+	if res.Err != nil {
+		log.Error("alert could not be registered", logging.Error(res.Err))
+		resp.Status = statusFailed
+		resp.Error = res.Err.Error()
+		return http.StatusUnprocessableEntity, resp
+	}
+
+	log.Info("alert registered")
+
+	return http.StatusOK, resp
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+
+	const bearer = "Bearer "
+	auth := r.Header.Get("Authorization")
+	if strings.HasPrefix(auth, bearer) {
+		return strings.TrimPrefix(auth, bearer)
+	}
+
+	return ""
+}
+
+func decodeAlertRequest(r *http.Request) (AlertRequest, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+
+	var req AlertRequest
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.HasPrefix(contentType, "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return AlertRequest{}, errs.New("invalid json body: %w", err)
+		}
+		return req, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return AlertRequest{}, errs.New("invalid form body: %w", err)
+	}
+
+	req.From = r.PostForm.Get("from")
+	req.Subject = r.PostForm.Get("subject")
+	req.Text = r.PostForm.Get("text")
+	req.IdempotencyKey = r.PostForm.Get("idempotency_key")
+
+	if d := r.PostForm.Get("date"); d != "" {
+		date, err := time.Parse(time.RFC3339, d)
+		if err != nil {
+			return AlertRequest{}, errs.New("date %q is not in RFC3339 format", d)
+		}
+		req.Date = date
+	}
+
+	return req, nil
+}
+
+func (r *AlertRequest) validate() error {
+	if strings.TrimSpace(r.Text) == "" {
+		return errs.New("text should not be empty")
+	}
+
+	if r.From == "" {
+		return errs.New("from should not be empty")
+	}
+
+	if r.IdempotencyKey == "" {
+		return errs.New("an idempotency key is required")
+	}
+
+	if r.Date.IsZero() {
+		r.Date = time.Now()
+	}
+
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
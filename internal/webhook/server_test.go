@@ -0,0 +1,318 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zeebo/errs"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+	syncpkg "github.com/Philanthropists/toshl-email-autosync/v2/internal/sync"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/types/currency"
+)
+
+const testAPIKey = "test-api-key"
+
+type testBank string
+
+func (b testBank) String() string { return string(b) }
+
+type fakeIngester struct {
+	configs map[string]userconfigserv.UserConfig
+	cfgErr  error
+
+	mu       sync.Mutex
+	ingested []banktypes.Message
+}
+
+func (f *fakeIngester) GetUserConfigFromAPIKey(
+	_ context.Context,
+	key string,
+) (userconfigserv.UserConfig, error) {
+	if f.cfgErr != nil {
+		return userconfigserv.UserConfig{}, f.cfgErr
+	}
+
+	cfg, ok := f.configs[key]
+	if !ok {
+		return userconfigserv.UserConfig{}, userconfigserv.ErrNotFound.New("no user has the api key")
+	}
+
+	return cfg, nil
+}
+
+func (f *fakeIngester) Ingest(
+	_ context.Context,
+	msgs ...banktypes.Message,
+) ([]syncpkg.IngestResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	results := make([]syncpkg.IngestResult, 0, len(msgs))
+	for _, msg := range msgs {
+		f.ingested = append(f.ingested, msg)
+
+		if !strings.Contains(string(msg.Body()), "compra") {
+			results = append(results, syncpkg.IngestResult{
+				Message: msg,
+				Err:     errs.New("no bank matched the alert"),
+			})
+			continue
+		}
+
+		results = append(results, syncpkg.IngestResult{
+			Message: msg,
+			Trx: &banktypes.TrxInfo{
+				Bank:        testBank("bancolombia"),
+				Type:        banktypes.Expense,
+				Description: "EXITO",
+				Account:     "1234",
+				Value:       currency.Amount{Code: "COP", Number: 30000},
+			},
+		})
+	}
+
+	return results, nil
+}
+
+func (f *fakeIngester) messages() []banktypes.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]banktypes.Message{}, f.ingested...)
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, *fakeIngester) {
+	ingester := &fakeIngester{
+		configs: map[string]userconfigserv.UserConfig{
+			testAPIKey: {Email: "user@example.com"},
+		},
+	}
+
+	srv := httptest.NewServer((&Server{Ingester: ingester}).Handler())
+	t.Cleanup(srv.Close)
+
+	return srv, ingester
+}
+
+func postAlert(
+	t *testing.T,
+	srv *httptest.Server,
+	contentType, body string,
+	headers map[string]string,
+) (*http.Response, AlertResponse) {
+	req, err := http.NewRequest(http.MethodPost, srv.URL+"/alerts", strings.NewReader(body))
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := srv.Client().Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	var resp AlertResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&resp))
+
+	return res, resp
+}
+
+func Test_AlertAPIKey(t *testing.T) {
+	srv, ingester := newTestServer(t)
+
+	body := `{"from": "alertas@bancolombia.com", "text": "Bancolombia le informa compra", "idempotency_key": "1"}`
+
+	tests := []struct {
+		Name    string
+		Headers map[string]string
+		Code    int
+	}{
+		{Name: "missing", Code: http.StatusUnauthorized},
+		{Name: "wrong", Headers: map[string]string{apiKeyHeader: "other-key"}, Code: http.StatusUnauthorized},
+		{Name: "header", Headers: map[string]string{apiKeyHeader: testAPIKey}, Code: http.StatusOK},
+		{Name: "bearer", Headers: map[string]string{"Authorization": "Bearer " + testAPIKey, idempotencyKeyHeader: "2"}, Code: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			res, resp := postAlert(t, srv, "application/json", body, tt.Headers)
+			assert.Equal(t, tt.Code, res.StatusCode)
+
+			if tt.Code == http.StatusUnauthorized {
+				assert.Equal(t, statusFailed, resp.Status)
+				assert.Equal(t, "invalid api key", resp.Error)
+			}
+		})
+	}
+
+	msgs := ingester.messages()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, []string{"user@example.com"}, msgs[0].To())
+}
+
+func Test_AlertUserConfigsUnavailable(t *testing.T) {
+	srv, ingester := newTestServer(t)
+	ingester.cfgErr = errs.New("could not load user configs")
+
+	body := `{"from": "alertas@bancolombia.com", "text": "Bancolombia le informa compra", "idempotency_key": "1"}`
+	res, resp := postAlert(t, srv, "application/json", body, map[string]string{apiKeyHeader: testAPIKey})
+
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, statusFailed, resp.Status)
+	assert.Empty(t, ingester.messages())
+}
+
+func Test_AlertIdempotency(t *testing.T) {
+	srv, ingester := newTestServer(t)
+
+	headers := map[string]string{apiKeyHeader: testAPIKey}
+	body := `{"from": "alertas@bancolombia.com", "text": "Bancolombia le informa compra", "idempotency_key": "abc"}`
+
+	res, first := postAlert(t, srv, "application/json", body, headers)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get(replayedHeader))
+	assert.Equal(t, statusRegistered, first.Status)
+	assert.Equal(t, "EXITO", first.Description)
+	assert.Equal(t, 30000.0, first.Amount)
+
+	res, replayed := postAlert(t, srv, "application/json", body, headers)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "true", res.Header.Get(replayedHeader))
+	assert.Equal(t, first, replayed)
+
+	// the header takes precedence over the key in the body
+	headers[idempotencyKeyHeader] = "def"
+	res, _ = postAlert(t, srv, "application/json", body, headers)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Empty(t, res.Header.Get(replayedHeader))
+
+	assert.Len(t, ingester.messages(), 2)
+}
+
+func Test_AlertIdempotencyPerUser(t *testing.T) {
+	srv, ingester := newTestServer(t)
+	ingester.configs["other-key"] = userconfigserv.UserConfig{Email: "other@example.com"}
+
+	body := `{"from": "alertas@bancolombia.com", "text": "Bancolombia le informa compra", "idempotency_key": "abc"}`
+
+	res, _ := postAlert(t, srv, "application/json", body, map[string]string{apiKeyHeader: testAPIKey})
+	assert.Empty(t, res.Header.Get(replayedHeader))
+
+	res, _ = postAlert(t, srv, "application/json", body, map[string]string{apiKeyHeader: "other-key"})
+	assert.Empty(t, res.Header.Get(replayedHeader))
+
+	msgs := ingester.messages()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, []string{"other@example.com"}, msgs[1].To())
+}
+
+func Test_AlertBody(t *testing.T) {
+	date := time.Date(2024, time.March, 15, 14, 32, 0, 0, time.UTC)
+
+	form := url.Values{
+		"from":            {"alertas@bancolombia.com"},
+		"subject":         {"Alertas y Notificaciones"},
+		"text":            {"Bancolombia le informa compra"},
+		"date":            {date.Format(time.RFC3339)},
+		"idempotency_key": {"form-1"},
+	}
+
+	tests := []struct {
+		Name        string
+		ContentType string
+		Body        string
+		Code        int
+		Error       string
+	}{
+		{
+			Name:        "json",
+			ContentType: "application/json; charset=utf-8",
+			Body:        `{"from": "alertas@bancolombia.com", "subject": "Alertas y Notificaciones", "text": "Bancolombia le informa compra", "date": "2024-03-15T14:32:00Z", "idempotency_key": "json-1"}`,
+			Code:        http.StatusOK,
+		},
+		{
+			Name:        "form",
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        form.Encode(),
+			Code:        http.StatusOK,
+		},
+		{
+			Name:        "invalid json",
+			ContentType: "application/json",
+			Body:        `{"from": `,
+			Code:        http.StatusBadRequest,
+			Error:       "invalid json body",
+		},
+		{
+			Name:        "invalid form date",
+			ContentType: "application/x-www-form-urlencoded",
+			Body:        "from=alertas&text=compra&idempotency_key=1&date=15/03/2024",
+			Code:        http.StatusBadRequest,
+			Error:       "RFC3339",
+		},
+		{
+			Name:        "missing text",
+			ContentType: "application/json",
+			Body:        `{"from": "alertas@bancolombia.com", "idempotency_key": "1"}`,
+			Code:        http.StatusBadRequest,
+			Error:       "text should not be empty",
+		},
+		{
+			Name:        "missing idempotency key",
+			ContentType: "application/json",
+			Body:        `{"from": "alertas@bancolombia.com", "text": "compra"}`,
+			Code:        http.StatusBadRequest,
+			Error:       "idempotency key is required",
+		},
+		{
+			Name:        "not parsed",
+			ContentType: "application/json",
+			Body:        `{"from": "alertas@bancolombia.com", "text": "Bancolombia le informa", "idempotency_key": "2"}`,
+			Code:        http.StatusUnprocessableEntity,
+			Error:       "no bank matched",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			srv, ingester := newTestServer(t)
+
+			res, resp := postAlert(t, srv, tt.ContentType, tt.Body, map[string]string{apiKeyHeader: testAPIKey})
+			assert.Equal(t, tt.Code, res.StatusCode)
+			if tt.Error != "" {
+				assert.Contains(t, resp.Error, tt.Error)
+				return
+			}
+
+			msgs := ingester.messages()
+			require.Len(t, msgs, 1)
+			assert.Equal(t, []string{"alertas@bancolombia.com"}, msgs[0].From())
+			assert.Equal(t, "Alertas y Notificaciones", msgs[0].Subject())
+			assert.Equal(t, "Bancolombia le informa compra", string(msgs[0].Body()))
+			assert.True(t, date.Equal(msgs[0].Date()))
+		})
+	}
+}
+
+func Test_AlertMethod(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	res, err := srv.Client().Get(srv.URL + "/alerts")
+	require.NoError(t, err)
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+	assert.Equal(t, http.MethodPost, res.Header.Get("Allow"))
+}
@@ -0,0 +1,113 @@
+package webhook
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/bank/banktypes"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/logging"
+	"github.com/Philanthropists/toshl-email-autosync/v2/internal/services/userconfigserv"
+)
+
+const (
+	twilioSignatureHeader = "X-Twilio-Signature"
+	emptyTwiML            = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+)
+
+// handleTwilioSMS receives Twilio's inbound message webhook. Twilio cannot
+// send custom headers, so the API key goes in the "key" query parameter.
+func (s *Server) handleTwilioSMS(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logging.FromContext(ctx)
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case s.TwilioValidator != nil:
+		params := make(map[string]string, len(r.PostForm))
+		for k := range r.PostForm {
+			params[k] = r.PostForm.Get(k)
+		}
+
+		signedURL := s.PublicURL + r.URL.RequestURI()
+		if !s.TwilioValidator.ValidateSignature(signedURL, params, r.Header.Get(twilioSignatureHeader)) {
+			log.Warn("invalid twilio signature", logging.String("url", s.PublicURL+redactQuery(r.URL)))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+	case !s.AllowUnsignedSMS:
+		log.Warn("refusing inbound sms, twilio signatures can not be validated without a public url")
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	cfg, err := s.Ingester.GetUserConfigFromAPIKey(ctx, r.URL.Query().Get("key"))
+	if userconfigserv.ErrNotFound.Has(err) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		log.Error("could not read user configs", logging.Error(err))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	sid := r.PostForm.Get("MessageSid")
+	from := r.PostForm.Get("From")
+	body := r.PostForm.Get("Body")
+
+	if sid == "" || from == "" || body == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	msg := banktypes.SMSMessage{
+		TextMessage: banktypes.TextMessage{
+			Key:       sid,
+			Sender:    from,
+			Recipient: cfg.Email,
+			Sent:      time.Now(),
+			Text:      body,
+		},
+	}
+
+	code, resp, _ := s.ingestOnce(ctx, cfg, sid, msg)
+	log.Info("processed inbound sms",
+		logging.String("sid", sid),
+		logging.String("from", from),
+		logging.Int("code", code),
+		logging.String("status", resp.Status),
+	)
+
+	// Twilio would show any other status as an error in its console without
+	// retrying, so an empty TwiML response is sent for every processed message
+	// and the result is only logged
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(emptyTwiML))
+}
+
+// redactQuery returns the path of u with the values of its query redacted,
+// since the API key goes in the query.
+func redactQuery(u *url.URL) string {
+	q := u.Query()
+	for k := range q {
+		q.Set(k, "REDACTED")
+	}
+
+	redacted := *u
+	redacted.RawQuery = q.Encode()
+
+	return redacted.RequestURI()
+}
@@ -0,0 +1,38 @@
+package webhook
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_RedactQuery(t *testing.T) {
+	u, err := url.Parse("/sms/twilio?key=secret-api-key")
+	require.NoError(t, err)
+
+	redacted := redactQuery(u)
+	assert.Equal(t, "/sms/twilio?key=REDACTED", redacted)
+	assert.NotContains(t, redacted, "secret-api-key")
+}
+
+func Test_UnsignedSMSRefused(t *testing.T) {
+	srv := &Server{}
+
+	form := url.Values{
+		"MessageSid": {"SM123"},
+		"From":       {"85954"},
+		"Body":       {"Bancolombia le informa ..."},
+	}
+	r := httptest.NewRequest(http.MethodPost, "/sms/twilio?key=secret-api-key", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, r)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}